@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/bgzf"
 	"github.com/biogo/hts/sam"
 )
 
@@ -16,6 +17,8 @@ type BamAt struct {
 	idx  *bam.Index
 	fh   *os.File
 	Refs map[string]*sam.Reference
+	// the offset of the first record, after the header.
+	first bgzf.Offset
 }
 
 // New returns a BamAt from the given path to the indexed bam
@@ -50,6 +53,7 @@ func New(path string) (*BamAt, error) {
 		return nil, err
 	}
 	bamat.Reader = br
+	bamat.first = br.LastChunk().End
 	hdr := br.Header()
 	bamat.Refs = make(map[string]*sam.Reference, 40)
 	for _, r := range hdr.Refs() {
@@ -60,7 +64,12 @@ func New(path string) (*BamAt, error) {
 
 // Query the BamAt with 0-base half-open interval.
 func (b *BamAt) Query(chrom string, start int, end int) (*bam.Iterator, error) {
-	if chrom == "" { // stdin
+	if chrom == "" { // stdin or the whole file
+		if b.idx != nil {
+			if err := b.Reader.Seek(b.first); err != nil {
+				return nil, err
+			}
+		}
 		return bam.NewIterator(b.Reader, nil)
 	}
 	ref := b.Refs[chrom]
@@ -0,0 +1,234 @@
+package bigly
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CallerFields are the fields that the Caller uses. They must be computed by the Iterator.
+var CallerFields = []string{"chrom", "pos", "depth", "softstarts", "softends", "hardstarts", "hardends",
+	"splitters", "discordant", "discordantchrom", "orientationplusplus", "orientationminusminus",
+	"orientationminusplus", "orientationsplitter", "splitterpositions"}
+
+// CallerOptions sets how positions are grouped into breakpoint candidates.
+type CallerOptions struct {
+	// MinSupport is the number of clipped reads, splitters or discordant reads at a position
+	// for it to be part of a candidate.
+	MinSupport int
+	// MaxGap is the largest distance between supporting positions in a candidate. It is
+	// also the size of the flanks used for FlankDepth.
+	MaxGap int
+	// MinScore is the lowest Score of a candidate that is reported.
+	MinScore float64
+}
+
+// DefaultCallerOptions are the options used by bigly call. Start from them and change the
+// fields that are needed, as NewCaller uses the CallerOptions as they are.
+var DefaultCallerOptions = CallerOptions{MinSupport: 3, MaxGap: 50, MinScore: 5}
+
+// Support is the evidence for a breakpoint candidate. Clips are counted once, at the base next to
+// the clip, so they are summed over the candidate. Reads are counted at every base they cover so
+// the others are the largest value at any position.
+type Support struct {
+	// ClipStarts and ClipEnds count reads with a soft or hard clip after and before a base.
+	ClipStarts      int
+	ClipEnds        int
+	Splitters       int
+	Discordant      int
+	DiscordantChrom int
+	PlusPlus        int
+	MinusMinus      int
+	MinusPlus       int
+	// OppositeSplitters are splitters with the SA on the other strand from the read.
+	OppositeSplitters int
+	// Depth is the mean depth in the candidate and FlankDepth is the mean in the MaxGap bases on
+	// either side.
+	Depth      float64
+	FlankDepth float64
+}
+
+// Breakpoint is a candidate interval for a structural-variant breakpoint.
+type Breakpoint struct {
+	Chrom string
+	// Start and End are 0-based, half-open and cover the positions with support.
+	Start, End int
+	// Peak is the position with the most clipped reads or, without clips, the most other support.
+	Peak    int
+	Support Support
+	Score   float64
+	// Partners are the SA positions of the split reads at the Peak.
+	Partners []Position
+	// Opposite is, for each of Partners, whether the SA is on the other strand from the read.
+	// It is empty when that is not known, as for piles read from a file.
+	Opposite []bool
+}
+
+// Caller groups piles with clipped, split or discordant reads into breakpoint candidates.
+type Caller struct {
+	o    CallerOptions
+	bp   Breakpoint
+	done Breakpoint
+	open bool
+	peak int
+	// depths inside the candidate and of the positions after its End.
+	inSum, inN           int
+	pendingSum, pendingN int
+	// the depths of the positions before the candidate, for the left flank.
+	recent    []int
+	recentPos []int
+	leftSum   int
+	leftN     int
+}
+
+// NewCaller returns a Caller. A MinScore of 0 reports every candidate.
+func NewCaller(o CallerOptions) *Caller {
+	return &Caller{o: o}
+}
+
+func clips(p *Pile) int {
+	return int(p.SoftStarts + p.SoftEnds + p.HardStarts + p.HardEnds)
+}
+
+// supports reports whether p has enough evidence to be part of a candidate.
+func (c *Caller) supports(p *Pile) bool {
+	m := uint32(c.o.MinSupport)
+	return clips(p) >= c.o.MinSupport || p.Splitters >= m || p.Discordant+p.DiscordantChrom >= m
+}
+
+// Add adds the next pile. Piles must be in order. If p is past the end of the current candidate,
+// that candidate is returned if its Score is at least MinScore. It is only valid until the next
+// call to Add or Flush.
+func (c *Caller) Add(p *Pile) *Breakpoint {
+	var done *Breakpoint
+	if c.open && (p.Chrom != c.bp.Chrom || p.Pos >= c.bp.End+c.o.MaxGap) {
+		done = c.Flush()
+	}
+	if !c.supports(p) {
+		if c.open {
+			c.pendingSum += p.Depth
+			c.pendingN++
+		} else {
+			c.remember(p)
+		}
+		return done
+	}
+	if !c.open {
+		c.start(p)
+	}
+	c.inSum += c.pendingSum + p.Depth
+	c.inN += c.pendingN + 1
+	c.pendingSum, c.pendingN = 0, 0
+	c.bp.End = p.Pos + 1
+	s := &c.bp.Support
+	s.ClipStarts += int(p.SoftStarts + p.HardStarts)
+	s.ClipEnds += int(p.SoftEnds + p.HardEnds)
+	s.Splitters = max(s.Splitters, int(p.Splitters))
+	s.Discordant = max(s.Discordant, int(p.Discordant))
+	s.DiscordantChrom = max(s.DiscordantChrom, int(p.DiscordantChrom))
+	s.PlusPlus = max(s.PlusPlus, int(p.OrientationPlusPlus))
+	s.MinusMinus = max(s.MinusMinus, int(p.OrientationMinusMinus))
+	s.MinusPlus = max(s.MinusPlus, int(p.OrientationMinusPlus))
+	s.OppositeSplitters = max(s.OppositeSplitters, int(p.OrientationSplitter))
+	// clips are weighted so that they decide the peak when there are any.
+	if peak := 1000*clips(p) + int(p.Splitters+p.Discordant+p.DiscordantChrom); peak > c.peak {
+		c.peak = peak
+		c.bp.Peak = p.Pos
+		c.bp.Partners = append(c.bp.Partners[:0], p.SplitterPositions...)
+		c.bp.Opposite = append(c.bp.Opposite[:0], p.splitterOpposite...)
+	}
+	return done
+}
+
+// remember keeps the depths of the last MaxGap positions for the left flank.
+func (c *Caller) remember(p *Pile) {
+	if len(c.recent) > 0 && c.recentPos[len(c.recentPos)-1] > p.Pos {
+		c.recent, c.recentPos = c.recent[:0], c.recentPos[:0]
+	}
+	c.recent = append(c.recent, p.Depth)
+	c.recentPos = append(c.recentPos, p.Pos)
+	i := 0
+	for i < len(c.recentPos) && c.recentPos[i] < p.Pos-c.o.MaxGap {
+		i++
+	}
+	if i > 0 {
+		c.recent = append(c.recent[:0], c.recent[i:]...)
+		c.recentPos = append(c.recentPos[:0], c.recentPos[i:]...)
+	}
+}
+
+func (c *Caller) start(p *Pile) {
+	c.open = true
+	c.bp = Breakpoint{Chrom: p.Chrom, Start: p.Pos, Peak: p.Pos, Partners: c.bp.Partners[:0], Opposite: c.bp.Opposite[:0]}
+	c.peak = -1
+	c.inSum, c.inN, c.pendingSum, c.pendingN = 0, 0, 0, 0
+	c.leftSum, c.leftN = 0, 0
+	for i, pos := range c.recentPos {
+		if pos >= p.Pos-c.o.MaxGap {
+			c.leftSum += c.recent[i]
+			c.leftN++
+		}
+	}
+	c.recent, c.recentPos = c.recent[:0], c.recentPos[:0]
+}
+
+// Flush returns the current candidate, if any and if its Score is at least MinScore, and starts
+// again.
+func (c *Caller) Flush() *Breakpoint {
+	if !c.open {
+		return nil
+	}
+	c.open = false
+	s := &c.bp.Support
+	if c.inN > 0 {
+		s.Depth = float64(c.inSum) / float64(c.inN)
+	}
+	if n := c.leftN + c.pendingN; n > 0 {
+		s.FlankDepth = float64(c.leftSum+c.pendingSum) / float64(n)
+	}
+	c.bp.Score = s.score()
+	c.bp, c.done = c.done, c.bp
+	if c.done.Score < c.o.MinScore {
+		return nil
+	}
+	return &c.done
+}
+
+// score weights split reads, which give the exact breakpoint, above the other evidence.
+func (s *Support) score() float64 {
+	return float64(s.ClipStarts + s.ClipEnds + 2*s.Splitters + s.Discordant + s.DiscordantChrom +
+		s.PlusPlus + s.MinusMinus + s.MinusPlus)
+}
+
+// BreakpointHeader is the header for Breakpoint.AppendTab.
+const BreakpointHeader = "#chrom\tstart\tend\tpeak\tscore\tclipstarts\tclipends\tsplitters\tdiscordant\t" +
+	"discordantchrom\tplusplus\tminusminus\tminusplus\toppositesplitters\tdepth\tflankdepth\tpartners"
+
+// AppendTab appends the tab-delimited candidate to b. Start and End are 0-based, half-open and
+// Peak is 1-based.
+func (bp *Breakpoint) AppendTab(b []byte) []byte {
+	b = append(b, bp.Chrom...)
+	s := bp.Support
+	for _, v := range []int{bp.Start, bp.End, bp.Peak + 1} {
+		b = append(b, '\t')
+		b = strconv.AppendInt(b, int64(v), 10)
+	}
+	b = append(b, '\t')
+	b = strconv.AppendFloat(b, bp.Score, 'f', -1, 64)
+	for _, v := range []int{s.ClipStarts, s.ClipEnds, s.Splitters, s.Discordant, s.DiscordantChrom, s.PlusPlus, s.MinusMinus, s.MinusPlus, s.OppositeSplitters} {
+		b = append(b, '\t')
+		b = strconv.AppendInt(b, int64(v), 10)
+	}
+	for _, v := range []float64{s.Depth, s.FlankDepth} {
+		b = append(b, '\t')
+		b = strconv.AppendFloat(b, v, 'f', 2, 64)
+	}
+	b = append(b, '\t')
+	if len(bp.Partners) == 0 {
+		return append(b, '.')
+	}
+	ps := make([]string, len(bp.Partners))
+	for i, p := range bp.Partners {
+		ps[i] = p.String()
+	}
+	return append(b, strings.Join(ps, ",")...)
+}
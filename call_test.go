@@ -0,0 +1,77 @@
+package bigly_test
+
+import (
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type CallTest struct{}
+
+var _ = Suite(&CallTest{})
+
+func (t *CallTest) TestCaller(c *C) {
+	var piles []bigly.Pile
+	for pos := 100; pos < 200; pos++ {
+		piles = append(piles, bigly.Pile{Chrom: "chr1", Pos: pos, Depth: 20})
+	}
+	// a deletion-like breakpoint: clips at 150, discordant pairs and splitters around it.
+	for i := 140; i < 160; i++ {
+		piles[i-100].Discordant = 3
+		piles[i-100].Depth = 10
+	}
+	piles[148-100].SoftEnds = 4
+	piles[150-100].SoftStarts = 6
+	piles[150-100].Splitters = 3
+	piles[150-100].SplitterPositions = []bigly.Position{{Chrom: "chr1", Start: 5000, End: 5100}}
+	// weak signal, below MinScore.
+	piles[190-100].SoftStarts = 3
+	// a second chromosome ends the first candidate.
+	piles = append(piles, bigly.Pile{Chrom: "chr2", Pos: 10, Depth: 10, Splitters: 4})
+
+	call := func(o bigly.CallerOptions) []bigly.Breakpoint {
+		cl := bigly.NewCaller(o)
+		var got []bigly.Breakpoint
+		for i := range piles {
+			if bp := cl.Add(&piles[i]); bp != nil {
+				got = append(got, *bp)
+			}
+		}
+		if bp := cl.Flush(); bp != nil {
+			got = append(got, *bp)
+		}
+		c.Assert(cl.Flush(), IsNil)
+		return got
+	}
+	o := bigly.DefaultCallerOptions
+	o.MaxGap = 10
+	got := call(o)
+	c.Assert(got, HasLen, 2)
+
+	bp := got[0]
+	c.Assert(bp.Chrom, Equals, "chr1")
+	c.Assert(bp.Start, Equals, 140)
+	c.Assert(bp.End, Equals, 160)
+	c.Assert(bp.Peak, Equals, 150)
+	c.Assert(bp.Support.ClipStarts, Equals, 6)
+	c.Assert(bp.Support.ClipEnds, Equals, 4)
+	c.Assert(bp.Support.Splitters, Equals, 3)
+	c.Assert(bp.Support.Discordant, Equals, 3)
+	c.Assert(bp.Support.Depth, Equals, 10.0)
+	c.Assert(bp.Support.FlankDepth, Equals, 20.0)
+	c.Assert(bp.Score, Equals, 19.0)
+	c.Assert(bp.Partners, DeepEquals, []bigly.Position{{Chrom: "chr1", Start: 5000, End: 5100}})
+	c.Assert(string(bp.AppendTab(nil)), Equals,
+		"chr1\t140\t160\t151\t19\t6\t4\t3\t3\t0\t0\t0\t0\t0\t10.00\t20.00\tchr1:5001-5100")
+
+	bp = got[1]
+	c.Assert(bp.Chrom, Equals, "chr2")
+	c.Assert(bp.Score, Equals, 8.0)
+	c.Assert(bp.Partners, HasLen, 0)
+	c.Assert(string(bp.AppendTab(nil))[len(bp.AppendTab(nil))-2:], Equals, "\t.")
+
+	// a MinScore of 0 reports the weak signal too.
+	o.MinScore = 0
+	got = call(o)
+	c.Assert(got, HasLen, 3)
+	c.Assert(got[1].Peak, Equals, 190)
+}
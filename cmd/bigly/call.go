@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	arg "github.com/alexflint/go-arg"
+	"github.com/biogo/hts/sam"
+	"github.com/brentp/bigly"
+	"github.com/brentp/faidx"
+)
+
+type callarg struct {
+	bigly.Options
+	Type       string  `arg:"help:what to call: breakpoint for candidate breakpoints, DEL for deletions from depth and insert sizes INV for inversions from +/+ and -/- pairs, DUP for tandem duplications from -/+ pairs and depth or BND for translocations from pairs and splitters with mates on other chromosomes"`
+	MinSupport int     `arg:"help:clipped, split or discordant reads for a position to support a breakpoint"`
+	MaxGap     int     `arg:"help:join supporting positions that are at most this far apart"`
+	MinScore   float64 `arg:"help:only report candidates with at least this score"`
+	MinLength  int     `arg:"help:with --type DEL, the shortest deletion to report"`
+	MaxRatio   float64 `arg:"help:with --type DEL, the largest depth relative to the flanks for a deleted base"`
+	PairSlop   int     `arg:"help:with --type INV, DUP or BND, cluster pairs whose ends are within this many bases"`
+	MinPairs   int     `arg:"help:with --type INV, DUP or BND, the pairs needed in each cluster"`
+	MinSplits  int     `arg:"help:with --type BND, the split reads needed for a translocation. -1 to report without splitters"`
+	MinGain    float64 `arg:"help:with --type DUP, the lowest depth in the duplication relative to the flanks"`
+	VCF        bool    `arg:"help:write the calls as VCF instead of tsv"`
+	Slop       int     `arg:"help:with --vcf, join split-read partners within this many bases into one breakend"`
+	Reference  string  `arg:"-r,help:optional path to reference fasta for the REF bases"`
+	BamPath    string  `arg:"positional,required"`
+	Region     string  `arg:"positional,required,help:a region like chr1:1001-2000, a chromosome, NA for all reads or a .bed(.gz) of regions"`
+}
+
+// callOut writes calls as tab-delimited lines or as VCF.
+type callOut struct {
+	w   *bufio.Writer
+	vcf *bigly.VCFWriter
+	ref *faidx.Faidx
+	buf []byte
+}
+
+func (o *callOut) writeTab(appendTab func([]byte) []byte) {
+	o.buf = append(appendTab(o.buf[:0]), '\n')
+	o.w.Write(o.buf)
+}
+
+func (o *callOut) writeSV(sv *bigly.SV) {
+	if o.ref != nil {
+		if b, err := o.ref.At(sv.Chrom, sv.Pos); err == nil {
+			sv.Ref = strings.ToUpper(string(b))[0]
+		}
+	}
+	if err := o.vcf.Write(sv); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// callMain writes breakpoint candidates or structural variants.
+func callMain(args []string) {
+	d, dd, di := bigly.DefaultCallerOptions, bigly.DefaultDeletionOptions, bigly.DefaultInversionOptions
+	q := &callarg{Options: defaultOptions(), Type: "breakpoint", MinSupport: d.MinSupport, MaxGap: d.MaxGap,
+		MinScore: d.MinScore, MinLength: dd.MinLength, MaxRatio: dd.MaxRatio, PairSlop: di.Slop, MinPairs: di.MinPairs,
+		MinGain: bigly.DefaultDuplicationOptions.MinRatio, MinSplits: bigly.DefaultTranslocationOptions.MinSplits, Slop: 20}
+	// keep all SA positions to report the partners.
+	q.SplitterVerbosity = 2
+	parser, err := arg.NewParser(arg.Config{Program: "bigly call"}, q)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = parser.Parse(args); err == arg.ErrHelp {
+		parser.WriteHelp(os.Stdout)
+		os.Exit(0)
+	} else if err != nil {
+		parser.Fail(err.Error())
+	}
+	if q.MinSupport < 0 || q.MaxGap < 1 {
+		parser.Fail("minsupport must not be negative and maxgap must be positive")
+	}
+	if q.ExcludeFlag == 0 {
+		q.ExcludeFlag = uint16(sam.Unmapped | sam.QCFail | sam.Duplicate)
+	}
+
+	// add and flush pass the piles to the caller for the type and write what it finds. Callers that
+	// use the reads set called instead.
+	out := &callOut{}
+	var it *bigly.Iterator
+	var add func(p *bigly.Pile)
+	var flush func()
+	var called func(links []bigly.Link)
+	var header string
+	switch q.Type {
+	case "breakpoint":
+		q.Fields, header = bigly.CallerFields, bigly.BreakpointHeader
+		cl := bigly.NewCaller(bigly.CallerOptions{MinSupport: q.MinSupport, MaxGap: q.MaxGap, MinScore: q.MinScore})
+		write := func(bp *bigly.Breakpoint) {
+			if bp == nil {
+				return
+			}
+			if out.vcf == nil {
+				out.writeTab(bp.AppendTab)
+				return
+			}
+			for _, sv := range bigly.BreakendSVs(bp, q.Slop) {
+				out.writeSV(&sv)
+			}
+		}
+		add = func(p *bigly.Pile) { write(cl.Add(p)) }
+		flush = func() { write(cl.Flush()) }
+	case "DEL":
+		q.Fields, header = bigly.DeletionFields, bigly.DeletionHeader
+		dc := bigly.NewDeletionCaller(bigly.DeletionOptions{MinLength: q.MinLength, MaxRatio: q.MaxRatio})
+		write := func(d *bigly.Deletion) {
+			if d == nil {
+				return
+			}
+			if out.vcf == nil {
+				out.writeTab(d.AppendTab)
+				return
+			}
+			sv := d.SV()
+			out.writeSV(&sv)
+		}
+		add = func(p *bigly.Pile) { write(dc.Add(p)) }
+		flush = func() { write(dc.Flush()) }
+	case "INV":
+		q.Fields, header = []string{"chrom"}, bigly.InversionHeader
+		called = func(links []bigly.Link) {
+			for _, inv := range bigly.Inversions(links, bigly.InversionOptions{Slop: q.PairSlop, MinPairs: q.MinPairs}) {
+				if out.vcf == nil {
+					out.writeTab(inv.AppendTab)
+					continue
+				}
+				sv := inv.SV()
+				out.writeSV(&sv)
+			}
+		}
+	case "DUP":
+		q.Fields, header = []string{"chrom"}, bigly.DuplicationHeader
+		called = func(links []bigly.Link) {
+			dups, err := bigly.Duplications(links, it.MeanDepth, bigly.DuplicationOptions{Slop: q.PairSlop, MinPairs: q.MinPairs, MinRatio: q.MinGain})
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, dup := range dups {
+				if out.vcf == nil {
+					out.writeTab(dup.AppendTab)
+					continue
+				}
+				sv := dup.SV()
+				out.writeSV(&sv)
+			}
+		}
+	case "BND":
+		q.Fields, header = []string{"chrom"}, bigly.TranslocationHeader
+		called = func(links []bigly.Link) {
+			ts := bigly.Translocations(links, bigly.TranslocationOptions{Slop: q.PairSlop, MinPairs: q.MinPairs, MinSplits: q.MinSplits})
+			for i, t := range ts {
+				if out.vcf == nil {
+					out.writeTab(t.AppendTab)
+					continue
+				}
+				for _, sv := range t.SVs("bigly_tra" + strconv.Itoa(i+1)) {
+					out.writeSV(&sv)
+				}
+			}
+		}
+	default:
+		parser.Fail("type must be breakpoint, DEL, INV, DUP or BND")
+	}
+
+	positions, err := regions(q.Region)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(positions) == 0 {
+		return
+	}
+	if q.Reference != "" {
+		if out.ref, err = faidx.New(q.Reference); err != nil {
+			log.Fatal(err)
+		}
+	}
+	it = bigly.Up(q.BamPath, q.Options, positions[0], nil)
+	if err = it.Error(); err != nil {
+		log.Fatal(err)
+	}
+	defer it.Close()
+
+	out.w = bufio.NewWriter(os.Stdout)
+	defer out.w.Flush()
+	if q.VCF {
+		if out.vcf, err = bigly.NewVCFWriter(out.w, it.Header(), sampleName(it.Header(), q.BamPath)); err != nil {
+			log.Fatal(err)
+		}
+		defer out.vcf.Close()
+	} else {
+		out.w.WriteString(header + "\n")
+	}
+
+	if called != nil {
+		var links []bigly.Link
+		for _, pos := range positions {
+			ls, err := it.Links(resolve(pos, it.Header()))
+			if err != nil {
+				log.Fatal(err)
+			}
+			links = append(links, ls...)
+		}
+		called(links)
+		return
+	}
+	for i, pos := range positions {
+		if i > 0 {
+			if err = it.Seek(pos); err != nil {
+				log.Fatal(err)
+			}
+		}
+		for it.Next() {
+			add(it.Pile())
+		}
+		if err = it.Error(); err != nil {
+			log.Fatal(err)
+		}
+		// regions may overlap or be out of order so calls don't span them.
+		flush()
+	}
+}
+
+// sampleName returns the SM of the first read group or the name of the bam.
+func sampleName(h *sam.Header, path string) string {
+	for _, rg := range h.RGs() {
+		if sm := rg.Get(sam.NewTag("SM")); sm != "" {
+			return sm
+		}
+	}
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
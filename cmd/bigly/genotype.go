@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	arg "github.com/alexflint/go-arg"
+	"github.com/biogo/hts/sam"
+	"github.com/brentp/bigly"
+	"github.com/brentp/xopen"
+)
+
+type genotypearg struct {
+	bigly.Options
+	Slop       int     `arg:"help:how far from a breakpoint a clip or split read can be"`
+	Overlap    int     `arg:"help:aligned bases needed on each side of a breakpoint for a read to support the reference"`
+	PairWindow int     `arg:"help:how far from a breakpoint the reads of a pair can be"`
+	ErrorRate  float64 `arg:"help:chance that a read supports the wrong allele"`
+	Sample     string  `arg:"help:sample name for the output. default is the SM of the bam or its name"`
+	BamPath    string  `arg:"positional,required"`
+	VCF        string  `arg:"positional,required,help:SVs to genotype as VCF(.gz). - for stdin"`
+}
+
+// genotypeMain writes the VCF with the GT, GQ and AD of the sample for each SV.
+func genotypeMain(args []string) {
+	d := bigly.DefaultGenotypeOptions
+	q := &genotypearg{Options: defaultOptions(), Slop: d.Slop, Overlap: d.Overlap, PairWindow: d.PairWindow, ErrorRate: d.ErrorRate}
+	parser, err := arg.NewParser(arg.Config{Program: "bigly genotype"}, q)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = parser.Parse(args); err == arg.ErrHelp {
+		parser.WriteHelp(os.Stdout)
+		os.Exit(0)
+	} else if err != nil {
+		parser.Fail(err.Error())
+	}
+	if q.ExcludeFlag == 0 {
+		q.ExcludeFlag = uint16(sam.Unmapped | sam.QCFail | sam.Duplicate)
+	}
+	// depth is used for long DEL and DUP with few informative reads.
+	q.Fields = []string{"depth"}
+	o := bigly.GenotypeOptions{Slop: q.Slop, Overlap: q.Overlap, PairWindow: q.PairWindow, ErrorRate: q.ErrorRate}
+
+	rdr, err := xopen.Ropen(q.VCF)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rdr.Close()
+	// the bam is opened once and the Iterator is moved to each SV.
+	it := bigly.Up(q.BamPath, q.Options, bigly.Position{Start: -1, End: -1}, nil)
+	if err = it.Error(); err != nil {
+		log.Fatal(err)
+	}
+	defer it.Close()
+	if q.Sample == "" {
+		q.Sample = sampleName(it.Header(), q.BamPath)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	var buf []byte
+	for i := 1; ; i++ {
+		line, err := rdr.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return
+		}
+		if err != nil && err != io.EOF {
+			log.Fatal(err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			continue
+		// the old samples are replaced so their FORMAT lines are dropped.
+		case strings.HasPrefix(line, "##FORMAT="):
+			continue
+		case strings.HasPrefix(line, "##"):
+			w.WriteString(line + "\n")
+			continue
+		case strings.HasPrefix(line, "#"):
+			w.WriteString(bigly.GenotypeHeader)
+			w.WriteString("#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\t" + q.Sample + "\n")
+			continue
+		}
+		g := bigly.Genotype{GT: "./."}
+		sv, err := bigly.ParseSV(line)
+		if err != nil {
+			// a record that can't be parsed is kept with a missing genotype.
+			log.Printf("%s:%d: %s", q.VCF, i, err)
+		} else if g, err = it.Genotype(&sv, o); err != nil {
+			log.Fatalf("%s:%d: %s", q.VCF, i, err)
+		}
+		f := strings.SplitN(line, "\t", 9)
+		buf = append(buf[:0], strings.Join(f[:min(8, len(f))], "\t")...)
+		buf = append(buf, "\t"+bigly.GenotypeFormat+"\t"...)
+		buf = append(g.AppendFormat(buf), '\n')
+		w.Write(buf)
+	}
+}
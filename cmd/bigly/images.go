@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	arg "github.com/alexflint/go-arg"
+	"github.com/biogo/hts/sam"
+	"github.com/brentp/bigly"
+)
+
+type imagesarg struct {
+	bigly.Options
+	Width   int      `arg:"help:number of positions in each image"`
+	Height  int      `arg:"help:maximum number of reads in each image"`
+	OutDir  string   `arg:"-o,help:directory for the images"`
+	NoPNG   bool     `arg:"help:only write the .npy tensors"`
+	BamPath string   `arg:"positional,required"`
+	Sites   []string `arg:"positional,required,help:sites like chr1:12345, regions (the center is used) or a .bed(.gz) of regions"`
+}
+
+// parseSite returns the 0-based position for a site like chr1:12345.
+func parseSite(site string) (bigly.Position, error) {
+	i := strings.LastIndexByte(site, ':')
+	if i < 0 || strings.IndexByte(site[i:], '-') >= 0 {
+		return parseRegion(site)
+	}
+	p, err := strconv.Atoi(site[i+1:])
+	if err != nil {
+		return bigly.Position{}, fmt.Errorf("bad site: %s", site)
+	}
+	return bigly.Position{Chrom: site[:i], Start: p - 1, End: p}, nil
+}
+
+// imagesMain writes a pileup image as .png and .npy for each site.
+func imagesMain(args []string) {
+	q := &imagesarg{Options: defaultOptions(), Width: 221, Height: 100, OutDir: "."}
+	parser, err := arg.NewParser(arg.Config{Program: "bigly images"}, q)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = parser.Parse(args); err == arg.ErrHelp {
+		parser.WriteHelp(os.Stdout)
+		os.Exit(0)
+	} else if err != nil {
+		parser.Fail(err.Error())
+	}
+	if q.Width < 1 || q.Height < 1 {
+		parser.Fail("width and height must be positive")
+	}
+	if q.ExcludeFlag == 0 {
+		q.ExcludeFlag = uint16(sam.Unmapped | sam.QCFail | sam.Duplicate)
+	}
+	// only the reads are needed so no fields are calculated.
+	q.Fields = []string{"chrom"}
+
+	var sites []bigly.Position
+	for _, s := range q.Sites {
+		var ps []bigly.Position
+		if strings.HasSuffix(s, ".bed") || strings.HasSuffix(s, ".bed.gz") {
+			ps, err = regions(s)
+		} else {
+			var p bigly.Position
+			p, err = parseSite(s)
+			ps = []bigly.Position{p}
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		sites = append(sites, ps...)
+	}
+	if len(sites) == 0 {
+		return
+	}
+	if err = os.MkdirAll(q.OutDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	it := bigly.Up(q.BamPath, q.Options, sites[0], nil)
+	if err = it.Error(); err != nil {
+		log.Fatal(err)
+	}
+	defer it.Close()
+	for _, s := range sites {
+		if s.Chrom == "" || s.End < 0 {
+			log.Fatalf("sites must have a chromosome and position, got %s", s)
+		}
+		site := (s.Start + s.End) / 2
+		im, err := it.Image(s.Chrom, site, q.Width, q.Height)
+		if err != nil {
+			log.Fatal(err)
+		}
+		name := filepath.Join(q.OutDir, fmt.Sprintf("%s_%d", s.Chrom, site+1))
+		if err = writeImage(name+".npy", im.WriteNpy); err != nil {
+			log.Fatal(err)
+		}
+		if !q.NoPNG {
+			if err = writeImage(name+".png", im.WritePNG); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
+
+func writeImage(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"strconv"
+
+	arg "github.com/alexflint/go-arg"
+	"github.com/biogo/hts/sam"
+	"github.com/brentp/bigly"
+)
+
+type linksarg struct {
+	bigly.Options
+	Slop     int    `arg:"help:join links whose ends are within this many bases"`
+	MinReads int    `arg:"help:only report clusters with at least this many links"`
+	BamPath  string `arg:"positional,required"`
+	Region   string `arg:"positional,required,help:a region like chr1:1001-2000, a chromosome or a .bed(.gz) of regions"`
+}
+
+// linksMain writes clusters of split-read and discordant-pair links as BEDPE.
+func linksMain(args []string) {
+	q := &linksarg{Options: defaultOptions(), Slop: 200, MinReads: 2}
+	parser, err := arg.NewParser(arg.Config{Program: "bigly links"}, q)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = parser.Parse(args); err == arg.ErrHelp {
+		parser.WriteHelp(os.Stdout)
+		os.Exit(0)
+	} else if err != nil {
+		parser.Fail(err.Error())
+	}
+	if q.ExcludeFlag == 0 {
+		q.ExcludeFlag = uint16(sam.Unmapped | sam.QCFail | sam.Duplicate)
+	}
+	// only the reads are needed so no fields are calculated.
+	q.Fields = []string{"chrom"}
+
+	positions, err := regions(q.Region)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(positions) == 0 {
+		return
+	}
+	it := bigly.Up(q.BamPath, q.Options, positions[0], nil)
+	if err = it.Error(); err != nil {
+		log.Fatal(err)
+	}
+	defer it.Close()
+
+	var links []bigly.Link
+	for _, pos := range positions {
+		ls, err := it.Links(resolve(pos, it.Header()))
+		if err != nil {
+			log.Fatal(err)
+		}
+		links = append(links, ls...)
+	}
+
+	stdout := bufio.NewWriter(os.Stdout)
+	defer stdout.Flush()
+	stdout.WriteString(bigly.BEDPEHeader + "\n")
+	var buf []byte
+	n := 0
+	for _, c := range bigly.ClusterLinks(links, q.Slop) {
+		if c.Reads() < q.MinReads {
+			continue
+		}
+		n++
+		buf = append(c.AppendBEDPE(buf[:0], "link_"+strconv.Itoa(n)), '\n')
+		stdout.Write(buf)
+	}
+}
@@ -16,25 +16,142 @@ import (
 
 type cliarg struct {
 	bigly.Options
-	Reference string `arg:"-r,help:optional path to reference fasta."`
-	BamPath   string `arg:"positional,required"`
-	Region    string `arg:"positional,required"`
+	Reference        string   `arg:"-r,help:optional path to reference fasta."`
+	TagFilters       []string `arg:"-t,help:only use reads matching these tag expressions, e.g. NM<5 RG==lib1"`
+	MaxNM            int      `arg:"help:exclude reads with NM greater than this (-1 to disable)"`
+	MinASXS          int      `arg:"help:exclude reads where AS-XS is less than this (-1 to disable)"`
+	MinAlignedLength int      `arg:"help:exclude reads with fewer than this many aligned bases"`
+	ReadGroups       []string `arg:"help:only use reads from these read-groups"`
+	NoHeader         bool     `arg:"help:don't print the header line with the column names"`
+	Format           string   `arg:"help:output format. tsv, json (one object per line) or mpileup (samtools columns followed by any --fields)"`
+	Output           string   `arg:"-O,help:write bgzipped tsv with a tabix index to this path. read it with: bigly query"`
+	Tracks           []string `arg:"help:also write these numeric fields, e.g. depth,discordant, as bedGraph tracks"`
+	TrackPrefix      string   `arg:"help:tracks are written to $prefix.$field.bedgraph (or .bw)"`
+	BigWig           bool     `arg:"help:write the tracks as bigWig instead of bedGraph"`
+	Features         string   `arg:"help:write the numeric fields as NumPy float32 arrays to this .npz, with one array per region, or .npy"`
+	Shards           string   `arg:"help:write one gzipped file per chromosome or chunk to this directory. a rerun skips completed shards"`
+	ChunkSize        int      `arg:"help:with --shards, split chromosomes into chunks of this many bases"`
+	Runs             bool     `arg:"help:merge consecutive positions with the same values into chrom, start, end intervals"`
+	Tolerances       []string `arg:"help:with --runs, how much numeric fields may differ within an interval. e.g. depth=2"`
+	BamPath          string   `arg:"positional,required"`
+	Region           string   `arg:"positional,required,help:a region like chr1:1001-2000, a chromosome, NA for all reads or a .bed(.gz) of regions"`
+}
+
+// filters converts the read-filter arguments to bigly.ReadFilters.
+func (c *cliarg) filters() ([]bigly.ReadFilter, error) {
+	var fs []bigly.ReadFilter
+	for _, expr := range c.TagFilters {
+		f, err := bigly.TagFilter(expr)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	if c.MaxNM >= 0 {
+		fs = append(fs, bigly.MaxNM(c.MaxNM))
+	}
+	if c.MinASXS >= 0 {
+		fs = append(fs, bigly.MinASXS(c.MinASXS))
+	}
+	if c.MinAlignedLength > 0 {
+		fs = append(fs, bigly.MinAlignedLength(c.MinAlignedLength))
+	}
+	if len(c.ReadGroups) > 0 {
+		fs = append(fs, bigly.ReadGroups(c.ReadGroups...))
+	}
+	return fs, nil
 }
 
 func (c cliarg) Version() string {
 	return "bigly 0.3.1"
 }
 
+// parseRegion returns the 0-based position for a region like chr1:1001-2000, chr1 or NA for
+// the whole input.
+func parseRegion(region string) (bigly.Position, error) {
+	if region == "NA" {
+		return bigly.Position{Start: -1, End: -1}, nil
+	}
+	chromse := strings.Split(region, ":")
+	if len(chromse) == 1 {
+		return bigly.Position{Chrom: region, Start: 0, End: -1}, nil
+	}
+	se := strings.Split(chromse[1], "-")
+	if len(se) != 2 {
+		return bigly.Position{}, fmt.Errorf("bad region: %s", region)
+	}
+	start, err := strconv.Atoi(se[0])
+	if err != nil {
+		return bigly.Position{}, err
+	}
+	end, err := strconv.Atoi(se[1])
+	if err != nil {
+		return bigly.Position{}, err
+	}
+	return bigly.Position{Chrom: chromse[0], Start: start - 1, End: end}, nil
+}
+
+// defaultOptions returns the Options used unless they are changed on the command line.
+func defaultOptions() bigly.Options {
+	return bigly.Options{MinBaseQuality: 10, ConcordantCutoff: 10000, MinMappingQuality: 5, MinClipLength: 15,
+		// piles are used before the next call to Next() so they can be reused.
+		ReusePile: true}
+}
+
 func main() {
-	cli := &cliarg{}
-	cli.Options.MinBaseQuality = 10
-	cli.Options.ConcordantCutoff = 10000
-	cli.Options.MinMappingQuality = 5
-	cli.Options.MinClipLength = 15
-	arg.MustParse(cli)
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		queryMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "images" {
+		imagesMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "links" {
+		linksMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "call" {
+		callMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "genotype" {
+		genotypeMain(os.Args[2:])
+		return
+	}
+	cli := &cliarg{Options: defaultOptions()}
+	cli.MaxNM = -1
+	cli.MinASXS = -1
+	cli.Format = "tsv"
+	cli.TrackPrefix = "bigly"
+	parser := arg.MustParse(cli)
+	if cli.Format != "tsv" && cli.Format != "json" && cli.Format != "mpileup" {
+		parser.Fail("format must be tsv, json or mpileup")
+	}
+	if cli.Format == "mpileup" {
+		// mpileup has no header.
+		cli.Fields = append(append([]string{}, bigly.MpileupFields...), cli.Fields...)
+		cli.NoHeader = true
+	}
+	if cli.Runs && (cli.Format != "tsv" || cli.Output != "") {
+		parser.Fail("--runs is only supported for tsv output to stdout or --shards")
+	}
+	if cli.Shards != "" && (cli.Output != "" || cli.Features != "" || len(cli.Tracks) > 0) {
+		parser.Fail("--shards can not be used with -O, --features or --tracks")
+	}
+	if cli.Output != "" && cli.Format == "json" {
+		parser.Fail("indexed output (-O) must be tsv or mpileup")
+	}
 	if cli.ExcludeFlag == 0 {
 		cli.ExcludeFlag = uint16(sam.Unmapped | sam.QCFail | sam.Duplicate)
 	}
+	var err error
+	if cli.Filters, err = cli.filters(); err != nil {
+		log.Fatal(err)
+	}
+	if err = cli.Options.Prepare(); err != nil {
+		log.Fatal(err)
+	}
 	/*
 		f, err := os.Create("bigly.cpu.pprof")
 		if err != nil {
@@ -47,25 +164,12 @@ func main() {
 	stdout := bufio.NewWriter(os.Stdout)
 	defer stdout.Flush()
 
-	var chromse []string = []string{"", ""}
-	var start, end int
-	if cli.Region != "NA" {
-		chromse = strings.Split(cli.Region, ":")
-		if len(chromse) > 1 {
-			var err error
-			se := strings.Split(chromse[1], "-")
-
-			start, err = strconv.Atoi(se[0])
-			if err != nil {
-				log.Fatal(err)
-			}
-			end, err = strconv.Atoi(se[1])
-			if err != nil {
-				log.Fatal(err)
-			}
-		} else {
-			start = 1
-		}
+	positions, err := regions(cli.Region)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(positions) == 0 {
+		return
 	}
 	var ref *faidx.Faidx
 	if cli.Reference != "" {
@@ -75,17 +179,91 @@ func main() {
 			log.Fatal(err)
 		}
 	}
-	if end == 0 {
-		end = -1
+	var iw *bigly.IndexedWriter
+	if cli.Output != "" {
+		if iw, err = bigly.NewIndexedWriter(cli.Output, cli.Options); err != nil {
+			log.Fatal(err)
+		}
 	}
-
-	it := bigly.Up(cli.BamPath, cli.Options, bigly.Position{Chrom: chromse[0], Start: start - 1, End: end}, ref)
-	for it.Next() {
-		p := it.Pile()
-		fmt.Fprintln(stdout, p.TabString(cli.Options))
+	pr, err := cli.newPrinter(stdout)
+	if err != nil {
+		log.Fatal(err)
 	}
+	var fw *bigly.FeatureWriter
+	if cli.Features != "" {
+		if fw, err = bigly.NewFeatureWriter(cli.Features, cli.Options); err != nil {
+			log.Fatal(err)
+		}
+	}
+	it := bigly.Up(cli.BamPath, cli.Options, positions[0], ref)
 	if err := it.Error(); err != nil {
 		log.Fatal(err)
 	}
-
+	if cli.Shards != "" {
+		if err := cli.runShards(it, positions); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if iw == nil {
+		pr.header()
+	}
+	tracks, err := cli.openTracks(it.Header())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i, pos := range positions {
+		if i > 0 {
+			if err := it.Seek(pos); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if fw != nil {
+			if pos.Chrom == "" {
+				log.Fatal("--features needs a region")
+			}
+			if err := fw.Region(resolve(pos, it.Header())); err != nil {
+				log.Fatal(err)
+			}
+		}
+		for it.Next() {
+			p := it.Pile()
+			for _, t := range tracks {
+				if err := t.Write(p); err != nil {
+					log.Fatal(err)
+				}
+			}
+			if fw != nil {
+				if err := fw.Write(p); err != nil {
+					log.Fatal(err)
+				}
+			}
+			if iw != nil {
+				if err := iw.Write(p); err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				pr.write(p)
+			}
+		}
+		if err := it.Error(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if fw != nil {
+		if err := fw.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	pr.flush()
+	if iw != nil {
+		if err := iw.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, t := range tracks {
+		if err := t.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io"
+
+	"github.com/brentp/bigly"
+)
+
+// printer writes piles to w in the output format.
+type printer struct {
+	w    io.Writer
+	cli  *cliarg
+	runs *bigly.Runs
+	buf  []byte
+}
+
+func (c *cliarg) newPrinter(w io.Writer) (*printer, error) {
+	p := &printer{w: w, cli: c}
+	if c.Runs {
+		tol, err := bigly.ParseTolerances(c.Tolerances)
+		if err != nil {
+			return nil, err
+		}
+		if p.runs, err = bigly.NewRuns(c.Options, tol); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// header writes the header line unless it is turned off or the format has none.
+func (p *printer) header() {
+	if p.cli.NoHeader || p.cli.Format == "json" {
+		return
+	}
+	if p.runs != nil {
+		io.WriteString(p.w, p.runs.Header()+"\n")
+	} else {
+		io.WriteString(p.w, p.cli.Options.Header()+"\n")
+	}
+}
+
+func (p *printer) write(pl *bigly.Pile) {
+	if p.runs != nil {
+		if iv := p.runs.Add(pl); iv != nil {
+			p.buf = append(iv.AppendTab(p.buf[:0]), '\n')
+			p.w.Write(p.buf)
+		}
+	} else if p.cli.Format == "json" {
+		p.buf = append(pl.AppendJSON(p.buf[:0], p.cli.Options), '\n')
+		p.w.Write(p.buf)
+	} else {
+		p.buf = append(pl.AppendTab(p.buf[:0], p.cli.Options), '\n')
+		p.w.Write(p.buf)
+	}
+}
+
+// flush writes the last interval with --runs.
+func (p *printer) flush() {
+	if p.runs == nil {
+		return
+	}
+	if iv := p.runs.Flush(); iv != nil {
+		p.w.Write(append(iv.AppendTab(p.buf[:0]), '\n'))
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+
+	arg "github.com/alexflint/go-arg"
+	"github.com/brentp/bigly"
+)
+
+type queryarg struct {
+	Format   string   `arg:"help:output format. tsv or json (one object per line)"`
+	NoHeader bool     `arg:"help:don't print the header line with the column names"`
+	Path     string   `arg:"positional,required,help:bgzipped output from bigly -O"`
+	Regions  []string `arg:"positional,required,help:regions like chr1:1001-2000 or chr1"`
+}
+
+// queryMain prints the piles in each region from a file written with bigly -O.
+func queryMain(args []string) {
+	q := &queryarg{Format: "tsv"}
+	parser, err := arg.NewParser(arg.Config{Program: "bigly query"}, q)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = parser.Parse(args); err == arg.ErrHelp {
+		parser.WriteHelp(os.Stdout)
+		os.Exit(0)
+	} else if err != nil {
+		parser.Fail(err.Error())
+	}
+	if q.Format != "tsv" && q.Format != "json" {
+		parser.Fail("format must be tsv or json")
+	}
+
+	ir, err := bigly.OpenIndexed(q.Path, bigly.Options{ReusePile: true})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ir.Close()
+
+	stdout := bufio.NewWriter(os.Stdout)
+	defer stdout.Flush()
+
+	var opts bigly.Options
+	var started bool
+	var buf []byte
+	for _, region := range q.Regions {
+		pos, err := parseRegion(region)
+		if err != nil {
+			log.Fatal(err)
+		}
+		r, err := ir.Query(pos)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for r.Next() {
+			if !started {
+				// the columns of the file.
+				opts, started = r.Options(), true
+				if q.Format == "tsv" && !q.NoHeader {
+					fmt.Fprintln(stdout, opts.Header())
+				}
+			}
+			if q.Format == "json" {
+				buf = append(r.Pile().AppendJSON(buf[:0], opts), '\n')
+			} else {
+				buf = append(r.Pile().AppendTab(buf[:0], opts), '\n')
+			}
+			stdout.Write(buf)
+		}
+		if err := r.Error(); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/hts/sam"
+	"github.com/brentp/bigly"
+	"github.com/brentp/xopen"
+)
+
+// regions returns the positions for a region like chr1:1001-2000 or for each line of a
+// BED file if region ends in .bed or .bed.gz.
+func regions(region string) ([]bigly.Position, error) {
+	if !strings.HasSuffix(region, ".bed") && !strings.HasSuffix(region, ".bed.gz") {
+		pos, err := parseRegion(region)
+		return []bigly.Position{pos}, err
+	}
+	rdr, err := xopen.Ropen(region)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+	var ps []bigly.Position
+	for i := 1; ; i++ {
+		line, err := rdr.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return ps, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" || line[0] == '#' || strings.HasPrefix(line, "track") || strings.HasPrefix(line, "browser") {
+			continue
+		}
+		toks := strings.SplitN(line, "\t", 4)
+		if len(toks) < 3 {
+			return nil, fmt.Errorf("%s:%d: expected chrom, start and end", region, i)
+		}
+		p := bigly.Position{Chrom: toks[0]}
+		if p.Start, err = strconv.Atoi(toks[1]); err == nil {
+			p.End, err = strconv.Atoi(toks[2])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", region, i, err)
+		}
+		ps = append(ps, p)
+	}
+}
+
+// resolve sets the end of a position that covers a whole chromosome from the header.
+func resolve(p bigly.Position, h *sam.Header) bigly.Position {
+	if p.End >= 0 || h == nil {
+		return p
+	}
+	for _, r := range h.Refs() {
+		if r.Name() == p.Chrom {
+			p.End = r.Len()
+		}
+	}
+	return p
+}
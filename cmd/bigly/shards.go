@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/brentp/bigly"
+)
+
+// runShards writes each shard of the positions to its own file in the --shards directory and
+// skips those that are already complete.
+func (c *cliarg) runShards(it *bigly.Iterator, positions []bigly.Position) error {
+	h := it.Header()
+	var ps []bigly.Position
+	if len(positions) == 1 && positions[0].Chrom == "" {
+		for _, r := range h.Refs() {
+			ps = append(ps, bigly.Position{Chrom: r.Name(), Start: 0, End: r.Len()})
+		}
+	} else {
+		for _, p := range positions {
+			ps = append(ps, resolve(p, h))
+		}
+	}
+	m, err := bigly.OpenManifest(c.Shards, c.describe())
+	if err != nil {
+		return err
+	}
+	for _, s := range bigly.SplitShards(ps, c.ChunkSize) {
+		done, err := m.Done(s.Name)
+		if err != nil {
+			return err
+		}
+		if done {
+			log.Printf("skipping completed shard %s", s.Name)
+			continue
+		}
+		sw, err := m.Create(s, "."+c.Format+".gz")
+		if err != nil {
+			return err
+		}
+		if err = c.writeShard(sw, it, s); err != nil {
+			sw.Abort()
+			return err
+		}
+		if err = sw.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describe returns the arguments that change the output so that a rerun with different
+// options does not mix shards.
+func (c *cliarg) describe() string {
+	o := c.Options
+	return fmt.Sprintf("bam:%s ref:%s format:%s runs:%v tolerances:%s chunk:%d q:%d Q:%d F:%d f:%d c:%d b:%v s:%d o:%d "+
+		"filters:%s maxnm:%d minasxs:%d minalignedlength:%d readgroups:%s columns:%s",
+		filepath.Base(c.BamPath), filepath.Base(c.Reference), c.Format, c.Runs, strings.Join(c.Tolerances, ","), c.ChunkSize,
+		o.MinBaseQuality, o.MinMappingQuality, o.ExcludeFlag, o.IncludeFlag, o.MinClipLength, o.IncludeBases,
+		o.SplitterVerbosity, o.ConcordantCutoff, strings.Join(c.TagFilters, ","), c.MaxNM, c.MinASXS, c.MinAlignedLength,
+		strings.Join(c.ReadGroups, ","), o.Header())
+}
+
+func (c *cliarg) writeShard(sw *bigly.ShardWriter, it *bigly.Iterator, s bigly.Shard) error {
+	gz := gzip.NewWriter(sw)
+	bw := bufio.NewWriter(gz)
+	pr, err := c.newPrinter(bw)
+	if err != nil {
+		return err
+	}
+	pr.header()
+	if err = it.Seek(s.Position); err != nil {
+		return err
+	}
+	for it.Next() {
+		pr.write(it.Pile())
+	}
+	if err = it.Error(); err != nil {
+		return err
+	}
+	pr.flush()
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/biogo/hts/sam"
+	"github.com/brentp/bigly"
+	"github.com/brentp/bigly/track"
+)
+
+// fileTrack is a bigly.Track that closes its file.
+type fileTrack struct {
+	*bigly.Track
+	fh *os.File
+}
+
+func (t *fileTrack) Close() error {
+	if err := t.Track.Close(); err != nil {
+		t.fh.Close()
+		return err
+	}
+	return t.fh.Close()
+}
+
+// openTracks creates a file for each of the requested tracks.
+func (c *cliarg) openTracks(h *sam.Header) ([]*fileTrack, error) {
+	var tracks []*fileTrack
+	for _, f := range c.Tracks {
+		for _, name := range strings.Split(f, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			t, err := c.openTrack(name, h)
+			if err != nil {
+				for _, t := range tracks {
+					t.Close()
+				}
+				return nil, err
+			}
+			tracks = append(tracks, t)
+		}
+	}
+	return tracks, nil
+}
+
+func (c *cliarg) openTrack(name string, h *sam.Header) (*fileTrack, error) {
+	ext := ".bedgraph"
+	if c.BigWig {
+		ext = ".bw"
+	}
+	fh, err := os.Create(c.TrackPrefix + "." + name + ext)
+	if err != nil {
+		return nil, err
+	}
+	var w track.Writer
+	if c.BigWig {
+		w, err = track.NewBigWig(fh, bigly.Chroms(h))
+	} else {
+		w, err = track.NewBedGraph(fh, name)
+	}
+	if err == nil {
+		var t *bigly.Track
+		if t, err = bigly.NewTrack(name, w, c.Options); err == nil {
+			return &fileTrack{t, fh}, nil
+		}
+	}
+	fh.Close()
+	os.Remove(fh.Name())
+	return nil, err
+}
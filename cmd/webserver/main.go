@@ -10,9 +10,11 @@ import (
 	"math"
 	"net/http"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	arg "github.com/alexflint/go-arg"
 	"github.com/biogo/hts/bam"
@@ -38,13 +40,88 @@ const MinSoftClipProportion = 0.1
 type cliarg struct {
 	bigly.Options
 	Reference string       `arg:"-r,help:optional path to reference fasta."`
-	BamPath   []string     `arg:"positional,required"`
+	BamPath   []string     `arg:"positional,required,help:bams or precomputed output from bigly -O"`
 	ref       *faidx.Faidx `arg:"-"`
 	Port      int          `arg:"-p,help:server port"`
+	Tracks    []string     `arg:"help:bigWig (.bw) or bedGraph tracks from bigly --tracks to show in igv"`
 	// maps from sample id to bam path.
-	paths map[string]string `arg:"-"`
+	paths   map[string]string `arg:"-"`
+	samples []string          `arg:"-"`
 
 	bamStats *covstats.Stats `arg:"-"`
+
+	// open iterators by sample so the bam, index and fasta are reused across requests.
+	its *sampleIters `arg:"-"`
+}
+
+// sampleIter holds the iterator, or for precomputed output the reader, for a sample. The lock
+// must be held while it is used because the underlying file can not be queried concurrently.
+type sampleIter struct {
+	sync.Mutex
+	it *bigly.Iterator
+	ir *bigly.IndexedReader
+}
+
+// close closes and clears the iterator and reader.
+func (si *sampleIter) close() {
+	if si.it != nil {
+		si.it.Close()
+	}
+	if si.ir != nil {
+		si.ir.Close()
+	}
+	si.it, si.ir = nil, nil
+}
+
+// piles is implemented by bigly.Iterator and bigly.Reader.
+type piles interface {
+	Next() bool
+	Pile() *bigly.Pile
+	Error() error
+}
+
+// query returns the piles in pos from the bam or precomputed file at path.
+func (si *sampleIter) query(cli *cliarg, path string, pos bigly.Position) (piles, error) {
+	if isPrecomputed(path) {
+		if si.ir == nil {
+			var err error
+			if si.ir, err = bigly.OpenIndexed(path, bigly.Options{ReusePile: true}); err != nil {
+				return nil, err
+			}
+		}
+		return si.ir.Query(pos)
+	}
+	if si.it == nil {
+		si.it = bigly.Up(path, cli.Options, pos, cli.ref)
+	} else {
+		si.it.Seek(pos)
+	}
+	return si.it, si.it.Error()
+}
+
+// isPrecomputed is true for bgzipped, indexed bigly output.
+func isPrecomputed(path string) bool {
+	if !strings.HasSuffix(path, ".gz") {
+		return false
+	}
+	_, err := os.Stat(path + ".tbi")
+	return err == nil
+}
+
+type sampleIters struct {
+	sync.Mutex
+	m map[string]*sampleIter
+}
+
+func (s *sampleIters) get(name string) *sampleIter {
+	s.Lock()
+	defer s.Unlock()
+	si, ok := s.m[name]
+	if !ok {
+		si = &sampleIter{}
+		s.m[name] = si
+	}
+	return si
 }
 
 func mean(arr []int32) int {
@@ -65,6 +142,17 @@ type xy struct {
 	r []float64
 }
 
+// add adds a point for the depth at the start of the interval. If the previous depth was 0,
+// a point is added just before so that the line rises vertically.
+func (v *xy) add(iv *bigly.Interval) {
+	if len(v.y) != 0 && v.y[len(v.y)-1] == 0 {
+		v.y = append(v.y, 0)
+		v.x = append(v.x, float64(iv.Start-1))
+	}
+	v.y = append(v.y, float64(iv.Pile.Depth))
+	v.x = append(v.x, float64(iv.Start))
+}
+
 func (v xy) Xs() []float64 {
 	return v.x
 }
@@ -124,6 +212,38 @@ func parseRegion(region string) (chrom string, start, end int, err error) {
 type ifill struct {
 	SampleNames []string
 	Region      string
+	Tracks      []igvTrack
+}
+
+// igvTrack is a track file that is served to igv.
+type igvTrack struct {
+	Name   string
+	URL    string
+	Format string
+}
+
+func (cli *cliarg) igvTracks() []igvTrack {
+	tracks := make([]igvTrack, 0, len(cli.Tracks))
+	for i, p := range cli.Tracks {
+		t := igvTrack{Name: filepath.Base(p), URL: fmt.Sprintf("tracks/%d/%s", i, filepath.Base(p)), Format: "bedgraph"}
+		if strings.HasSuffix(p, ".bw") || strings.HasSuffix(p, ".bigwig") {
+			t.Format = "bigwig"
+		}
+		tracks = append(tracks, t)
+	}
+	return tracks
+}
+
+// ServeTrack serves the files in Tracks for igv. ServeFile handles the range requests igv
+// uses for bigWig.
+func (cli *cliarg) ServeTrack(w http.ResponseWriter, r *http.Request) {
+	po := strings.SplitN(r.URL.Path[len("/tracks/"):], "/", 2)
+	i, err := strconv.Atoi(po[0])
+	if err != nil || i < 0 || i >= len(cli.Tracks) {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, cli.Tracks[i])
 }
 
 func getRegion(region string) string {
@@ -133,20 +253,31 @@ func getRegion(region string) string {
 	return region
 }
 
+// setSamples names each bam or precomputed file. It is called once, before serving, so that
+// the paths and open iterators are shared by all requests.
+func (cli *cliarg) setSamples() {
+	cli.paths = make(map[string]string, len(cli.BamPath))
+	cli.its = &sampleIters{m: make(map[string]*sampleIter, len(cli.BamPath))}
+	cli.samples = make([]string, 0, len(cli.BamPath))
+	for _, p := range cli.BamPath {
+		var name string
+		if isPrecomputed(p) {
+			name = strings.SplitN(filepath.Base(p), ".", 2)[0]
+		} else {
+			name = getShortName(p)
+		}
+		cli.paths[name] = p
+		cli.samples = append(cli.samples, name)
+	}
+}
+
 func (cli *cliarg) ServeIndex(w http.ResponseWriter, r *http.Request) {
 	t, err := template.ParseFiles("templates/chartjs.tmpl")
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
 		log.Fatal(err)
 	}
-	cli.paths = make(map[string]string, len(cli.BamPath))
-	samples := make([]string, 0, len(cli.BamPath))
-	for _, p := range cli.BamPath {
-		name := getShortName(p)
-		cli.paths[name] = p
-		samples = append(samples, name)
-	}
-	if err = t.Execute(w, ifill{SampleNames: samples, Region: getRegion(r.FormValue("region"))}); err != nil {
+	if err = t.Execute(w, ifill{SampleNames: cli.samples, Region: getRegion(r.FormValue("region")), Tracks: cli.igvTracks()}); err != nil {
 		log.Fatal(err)
 	}
 	wtr, _ := xopen.Wopen("index.html")
@@ -225,14 +356,32 @@ func (cli *cliarg) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bamPath := cli.paths[name]
+	bamPath, ok := cli.paths[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown sample: %s", name), http.StatusNotFound)
+		return
+	}
 
-	it := bigly.Up(bamPath, cli.Options, bigly.Position{Chrom: chrom, Start: start, End: end}, cli.ref)
+	si := cli.its.get(name)
+	si.Lock()
+	defer si.Unlock()
+	it, err := si.query(cli, bamPath, bigly.Position{Chrom: chrom, Start: start, End: end})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Println(err)
+		si.close()
+		return
+	}
 	tf := tfill{Depths: xy{}, Splitters: xy{}, Inserts: xy{}, Softs: xy{}}
 	tf.Inserts.x = append(tf.Inserts.x, float64(start))
 	tf.Inserts.y = append(tf.Inserts.y, math.NaN())
 
 	splits := make(map[int]int)
+	depths, err := bigly.NewRuns(bigly.Options{Fields: []string{"depth"}}, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	for it.Next() {
 		p := it.Pile()
 		select {
@@ -242,13 +391,9 @@ func (cli *cliarg) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		default:
 		}
 
-		if len(tf.Depths.y) == 0 || abs(tf.Depths.y[len(tf.Depths.y)-1]-float64(p.Depth)) >= 1 {
-			if len(tf.Depths.y) != 0 && tf.Depths.y[len(tf.Depths.y)-1] == 0 {
-				tf.Depths.y = append(tf.Depths.y, 0)
-				tf.Depths.x = append(tf.Depths.x, float64(p.Pos-1))
-			}
-			tf.Depths.y = append(tf.Depths.y, float64(p.Depth))
-			tf.Depths.x = append(tf.Depths.x, float64(p.Pos))
+		// only add a point if depth changed.
+		if iv := depths.Add(p); iv != nil {
+			tf.Depths.add(iv)
 		}
 
 		if p.SoftStarts+p.SoftEnds >= MinSoftClips && float64(p.SoftStarts+p.SoftEnds)/float64(p.Depth) > MinSoftClipProportion {
@@ -284,6 +429,9 @@ func (cli *cliarg) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		tf.Inserts.x = append(tf.Inserts.x, float64(p.Pos))
 		tf.Inserts.y = append(tf.Inserts.y, float64(in))
 	}
+	if iv := depths.Flush(); iv != nil {
+		tf.Depths.add(iv)
+	}
 	//removeSoleOutliers(tf.Inserts)
 	max := 1
 	sites := make([]int, 0, len(splits))
@@ -317,9 +465,9 @@ func (cli *cliarg) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if err := it.Error(); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		log.Println(err)
+		si.close()
 		return
 	}
-	it.Close()
 	if err := writeChart(w, tf, start, end); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		log.Println(err)
@@ -401,16 +549,22 @@ func main() {
 	cli.Options.ConcordantCutoff = 10000
 	cli.Options.MinMappingQuality = 5
 	cli.Options.MinClipLength = 15
+	// piles are used before the next call to Next() so they can be reused.
+	cli.Options.ReusePile = true
 	cli.Options.SplitterVerbosity = 1
 	cli.Port = 5000
 	arg.MustParse(cli)
 	if cli.ExcludeFlag == 0 {
 		cli.ExcludeFlag = uint16(sam.Unmapped | sam.QCFail | sam.Duplicate)
 	}
+	cli.setSamples()
 
 	// a path like /data/sample/1:1234-5678
 	http.HandleFunc("/data/", cli.ServeHTTP)
 
+	// a path like /tracks/0/sample.depth.bw
+	http.HandleFunc("/tracks/", cli.ServeTrack)
+
 	// fills the template
 	http.HandleFunc("/", cli.ServeIndex)
 
@@ -0,0 +1,445 @@
+package bigly
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// work is a set of the computations that are needed to fill the requested fields.
+type work uint16
+
+const (
+	// proper-pairs, discordants and orientations.
+	workPairs work = 1 << iota
+	// the InsertSizeLPs and InsertSizeRMs slices.
+	workInserts
+	// the DiscordantChromEntropy.
+	workEntropy
+	// Splitters and Splitters1 from the SA tag.
+	workSplitters
+	// parsing the SA tag for SplitterPositions and OrientationSplitter.
+	workSAs
+	// Bases and Quals.
+	workBases
+	// GC and Duplicity
+	workGC
+	// ReadBases for mpileup output.
+	workReadBases
+)
+
+// Column is a single field of a Pile in the output. All output formats are built from the same
+// columns so that the names and order match.
+type Column struct {
+	Name string
+	// Type is one of "string", "int" or "float".
+	Type        string
+	Description string
+	work        work
+	// format appends the text for the column to b.
+	format func(b []byte, p *Pile, o Options) []byte
+	// parse sets the field in p from the text written by format.
+	parse func(p *Pile, s string) error
+	// late columns are parsed after the others.
+	late bool
+	// appendJSON and parseJSON are set for columns that are not a single JSON value.
+	appendJSON func(b []byte, p *Pile) []byte
+	parseJSON  func(p *Pile, raw []byte) error
+	// value, if set, returns the numeric value without formatting.
+	value func(p *Pile) float64
+}
+
+// Append appends the text value of the column for p to b.
+func (c Column) Append(b []byte, p *Pile, o Options) []byte { return c.format(b, p, o) }
+
+func appendUint(b []byte, v uint32) []byte { return strconv.AppendUint(b, uint64(v), 10) }
+
+func appendFloat(b []byte, v float32) []byte {
+	return strconv.AppendFloat(b, float64(v), 'f', 2, 32)
+}
+
+func parseUint(s string) (uint32, error) {
+	v, err := strconv.ParseUint(s, 10, 32)
+	return uint32(v), err
+}
+
+func parseFloat(s string) (float32, error) {
+	v, err := strconv.ParseFloat(s, 32)
+	return float32(v), err
+}
+
+func uintColumn(name string, w work, desc string, f func(p *Pile) *uint32) Column {
+	return Column{Name: name, Type: "int", Description: desc, work: w,
+		value:  func(p *Pile) float64 { return float64(*f(p)) },
+		format: func(b []byte, p *Pile, o Options) []byte { return appendUint(b, *f(p)) },
+		parse: func(p *Pile, s string) (err error) {
+			*f(p), err = parseUint(s)
+			return err
+		}}
+}
+
+func intColumn(name string, w work, desc string, f func(p *Pile) *int) Column {
+	return Column{Name: name, Type: "int", Description: desc, work: w,
+		value:  func(p *Pile) float64 { return float64(*f(p)) },
+		format: func(b []byte, p *Pile, o Options) []byte { return strconv.AppendInt(b, int64(*f(p)), 10) },
+		parse: func(p *Pile, s string) (err error) {
+			*f(p), err = strconv.Atoi(s)
+			return err
+		}}
+}
+
+// insertColumn outputs the mean of the insert sizes. When parsed, the mean is the only insert size.
+func insertColumn(name string, desc string, f func(p *Pile) *[]int32) Column {
+	return Column{Name: name, Type: "int", Description: desc, work: workPairs | workInserts,
+		format: func(b []byte, p *Pile, o Options) []byte { return strconv.AppendInt(b, int64(mean(*f(p))), 10) },
+		parse: func(p *Pile, s string) error {
+			v, err := strconv.Atoi(s)
+			*f(p) = (*f(p))[:0]
+			if v != 0 {
+				*f(p) = append(*f(p), int32(v))
+			}
+			return err
+		}}
+}
+
+// columns holds all of the fields that do not depend on the options, in the default order.
+// The GC and duplicity columns are added for each window by Options.Prepare.
+var columns = []Column{
+	{Name: "chrom", Type: "string", Description: "chromosome",
+		format: func(b []byte, p *Pile, o Options) []byte { return append(b, p.Chrom...) },
+		parse:  func(p *Pile, s string) error { p.Chrom = s; return nil }},
+	{Name: "pos", Type: "int", Description: "1-based position",
+		format: func(b []byte, p *Pile, o Options) []byte { return strconv.AppendInt(b, int64(p.Pos+1), 10) },
+		parse: func(p *Pile, s string) (err error) {
+			p.Pos, err = strconv.Atoi(s)
+			p.Pos--
+			return err
+		}},
+	intColumn("depth", 0, "number of reads covering the position", func(p *Pile) *int { return &p.Depth }),
+	{Name: "refbase", Type: "string", Description: "reference base or N without a reference",
+		format: func(b []byte, p *Pile, o Options) []byte { return append(b, p.RefBase) },
+		parse: func(p *Pile, s string) error {
+			if len(s) != 1 {
+				return fmt.Errorf("bigly: bad reference base: %q", s)
+			}
+			p.RefBase = s[0]
+			return nil
+		}},
+	uintColumn("mismatches", 0, "number of reads with a base that differs from the reference", func(p *Pile) *uint32 { return &p.MisMatches }),
+	intColumn("properpairs", workPairs, "number of reads flagged as proper pairs", func(p *Pile) *int { return &p.ProperPairs }),
+	uintColumn("softstarts", 0, "number of reads with a soft-clip ending at the position", func(p *Pile) *uint32 { return &p.SoftStarts }),
+	uintColumn("softends", 0, "number of reads with a soft-clip starting after the position", func(p *Pile) *uint32 { return &p.SoftEnds }),
+	uintColumn("hardstarts", 0, "number of reads with a hard-clip ending at the position", func(p *Pile) *uint32 { return &p.HardStarts }),
+	uintColumn("hardends", 0, "number of reads with a hard-clip starting after the position", func(p *Pile) *uint32 { return &p.HardEnds }),
+	uintColumn("insertionstarts", 0, "number of reads with an insertion following the position", func(p *Pile) *uint32 { return &p.InsertionStarts }),
+	uintColumn("insertionends", 0, "number of reads with an insertion preceding the position", func(p *Pile) *uint32 { return &p.InsertionEnds }),
+	uintColumn("deletions", 0, "number of reads with a deletion at the position", func(p *Pile) *uint32 { return &p.Deletions }),
+	uintColumn("splitters", workSplitters, "number of primary reads with an SA tag", func(p *Pile) *uint32 { return &p.Splitters }),
+	uintColumn("splitters1", workSplitters, "number of primary reads with exactly 1 SA", func(p *Pile) *uint32 { return &p.Splitters1 }),
+	insertColumn("meaninsertsizelp", "mean insert size of the left-most reads of pairs", func(p *Pile) *[]int32 { return &p.InsertSizeLPs }),
+	insertColumn("meaninsertsizerm", "mean insert size of the right-most reads of pairs", func(p *Pile) *[]int32 { return &p.InsertSizeRMs }),
+	{Name: "weird", Type: "int", Description: "number of pairs or splitters in an unexpected orientation", work: workPairs | workSplitters | workSAs,
+		format: func(b []byte, p *Pile, o Options) []byte { return appendUint(b, weird(p)) },
+		// the count that isn't in the orientation columns is put in OrientationSplitter.
+		late: true, parse: func(p *Pile, s string) error {
+			v, err := parseUint(s)
+			if w := weird(p); v > w {
+				p.OrientationSplitter += v - w
+			}
+			return err
+		}},
+	uintColumn("discordant", workPairs, "number of reads with an insert size above the concordant cutoff", func(p *Pile) *uint32 { return &p.Discordant }),
+	uintColumn("discordantchrom", workPairs, "number of reads with a mate on another chromosome", func(p *Pile) *uint32 { return &p.DiscordantChrom }),
+	{Name: "discordantchromentropy", Type: "float", Description: "entropy of the mate chromosomes; low when the mates are on the same chromosome", work: workPairs | workEntropy,
+		format: func(b []byte, p *Pile, o Options) []byte { return appendFloat(b, p.DiscordantChromEntropy) },
+		parse: func(p *Pile, s string) (err error) {
+			p.DiscordantChromEntropy, err = parseFloat(s)
+			return err
+		}},
+	// gc and duplicity columns go here.
+	{Name: "splitterpositions", Type: "string", Description: "positions of the other parts of split reads (see splitter-verbosity)", work: workSplitters | workSAs,
+		format: formatSplitters, parse: parseSplitters, appendJSON: splittersJSON, parseJSON: parseSplittersJSON},
+}
+
+// extraColumns are only output when requested in Options.Fields.
+var extraColumns = []Column{
+	uintColumn("heads", 0, "number of reads starting at the position", func(p *Pile) *uint32 { return &p.Heads }),
+	uintColumn("tails", 0, "number of reads ending at the position", func(p *Pile) *uint32 { return &p.Tails }),
+	uintColumn("orientationplusplus", workPairs, "number of pairs in +/+ orientation", func(p *Pile) *uint32 { return &p.OrientationPlusPlus }),
+	uintColumn("orientationminusminus", workPairs, "number of pairs in -/- orientation", func(p *Pile) *uint32 { return &p.OrientationMinusMinus }),
+	uintColumn("orientationminusplus", workPairs, "number of pairs in -/+ orientation", func(p *Pile) *uint32 { return &p.OrientationMinusPlus }),
+	uintColumn("orientationsplitter", workSplitters|workSAs, "number of splitters with parts on opposite strands", func(p *Pile) *uint32 { return &p.OrientationSplitter }),
+	{Name: "bases", Type: "string", Description: "bases of the reads covering the position", work: workBases,
+		format:     func(b []byte, p *Pile, o Options) []byte { return append(b, p.Bases...) },
+		parse:      func(p *Pile, s string) error { p.Bases = append(p.Bases[:0], s...); return nil },
+		appendJSON: basesJSON, parseJSON: parseBasesJSON},
+	{Name: "quals", Type: "string", Description: "base qualities of the reads covering the position (phred+33)", work: workBases,
+		format: func(b []byte, p *Pile, o Options) []byte { return append(b, formatQual(p.Quals)...) },
+		parse: func(p *Pile, s string) error {
+			p.Quals = p.Quals[:0]
+			for i := 0; i < len(s); i++ {
+				p.Quals = append(p.Quals, s[i]-33)
+			}
+			return nil
+		},
+		appendJSON: qualsJSON, parseJSON: parseQualsJSON},
+	{Name: "readbases", Type: "string", Description: "read bases as in samtools mpileup, with ^, $, +n and -n markers", work: workReadBases,
+		format: func(b []byte, p *Pile, o Options) []byte { return append(b, p.ReadBases...) },
+		parse:  func(p *Pile, s string) error { p.ReadBases = append(p.ReadBases[:0], s...); return nil }},
+}
+
+func formatSplitters(b []byte, p *Pile, o Options) []byte {
+	if o.SplitterVerbosity == 0 {
+		return b
+	}
+	if p.splitterSummary != "" {
+		return append(b, p.splitterSummary...)
+	}
+	if len(p.SplitterPositions) == 0 {
+		return b
+	}
+	if o.SplitterVerbosity == 1 {
+		m, c := pMode(p.SplitterPositions)
+		return append(b, fmt.Sprintf("%d/%d/%d", m, c, len(p.SplitterPositions))...)
+	}
+	for i, s := range p.SplitterPositions {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, s.String()...)
+	}
+	return b
+}
+
+func weird(p *Pile) uint32 {
+	return p.OrientationPlusPlus + p.OrientationMinusPlus + p.OrientationMinusMinus + p.OrientationSplitter
+}
+
+// setColumns sets the fields of p from the value for each column using set.
+func setColumns(p *Pile, cols []Column, set func(c Column, i int) error) error {
+	for _, late := range []bool{false, true} {
+		for i, c := range cols {
+			if c.late != late {
+				continue
+			}
+			if err := set(c, i); err != nil {
+				return fmt.Errorf("bad value for %s: %s", c.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseSplitters reads the splitter positions in any of the formats from formatSplitters.
+// The strand is not in the text so all positions are on the - strand. With SplitterVerbosity 1,
+// only the mode, its count and the number of positions are known so the summary is kept as
+// it is, to be written again, and there are no positions.
+func parseSplitters(p *Pile, s string) error {
+	p.SplitterPositions, p.splitterSummary, p.splitterOpposite = p.SplitterPositions[:0], "", p.splitterOpposite[:0]
+	if s == "" {
+		return nil
+	}
+	if f := strings.Split(s, "/"); len(f) == 3 {
+		var v [3]int
+		for i := range f {
+			var err error
+			if v[i], err = strconv.Atoi(f[i]); err != nil {
+				return err
+			}
+		}
+		if count, n := v[1], v[2]; count < 1 || count > 2*n {
+			return fmt.Errorf("bigly: bad splitter summary: %s", s)
+		}
+		p.splitterSummary = s
+		return nil
+	}
+	for _, ps := range strings.Split(s, ",") {
+		pos, err := parsePosition(ps)
+		if err != nil {
+			return err
+		}
+		p.SplitterPositions = append(p.SplitterPositions, pos)
+	}
+	return nil
+}
+
+// parsePosition reads a Position from the chrom:start-end format of Position.String.
+func parsePosition(s string) (Position, error) {
+	var p Position
+	i := strings.LastIndexByte(s, ':')
+	j := strings.LastIndexByte(s, '-')
+	if i < 1 || j < i {
+		return p, fmt.Errorf("bigly: bad position: %s", s)
+	}
+	var err error
+	p.Chrom = s[:i]
+	if p.Start, err = strconv.Atoi(s[i+1 : j]); err != nil {
+		return p, err
+	}
+	p.Start--
+	p.End, err = strconv.Atoi(s[j+1:])
+	return p, err
+}
+
+// gcColumns returns the GC and duplicity columns for each window.
+func gcColumns(windows []int) []Column {
+	cols := make([]Column, 0, 2*len(windows))
+	for i, w := range windows {
+		i := i
+		cols = append(cols, Column{Name: "gc" + strconv.Itoa(w), Type: "int", work: workGC,
+			Description: "number of G or C in the " + strconv.Itoa(w) + "bp window centered on the position",
+			format: func(b []byte, p *Pile, o Options) []byte {
+				var v uint32
+				if i < len(p.GC) {
+					v = p.GC[i]
+				}
+				return appendUint(b, v)
+			},
+			parse: func(p *Pile, s string) (err error) {
+				for len(p.GC) <= i {
+					p.GC = append(p.GC, 0)
+				}
+				p.GC[i], err = parseUint(s)
+				return err
+			}})
+	}
+	for i, w := range windows {
+		i := i
+		cols = append(cols, Column{Name: "duplicity" + strconv.Itoa(w), Type: "float", work: workGC,
+			Description: "repetitiveness of the " + strconv.Itoa(w) + "bp window; 1 for a single repeated base",
+			format: func(b []byte, p *Pile, o Options) []byte {
+				var d float32
+				if i < len(p.Duplicity) {
+					d = p.Duplicity[i]
+				}
+				return appendFloat(b, d)
+			},
+			parse: func(p *Pile, s string) (err error) {
+				for len(p.Duplicity) <= i {
+					p.Duplicity = append(p.Duplicity, 0)
+				}
+				p.Duplicity[i], err = parseFloat(s)
+				return err
+			}})
+	}
+	return cols
+}
+
+// AllColumns returns the default columns, including those for the GC windows, followed by
+// the columns that are only output when requested in Options.Fields.
+func (o Options) AllColumns() []Column {
+	n := len(columns) - 1
+	cols := append(append([]Column{}, columns[:n]...), gcColumns(o.gcWindows())...)
+	cols = append(cols, columns[n:]...)
+	return append(cols, extraColumns...)
+}
+
+// Prepare checks the requested Fields and caches the columns and the work they need.
+// It is called by Up and AtUp and must be called again if the Options are changed.
+// Unknown fields are left out of the columns and reported in the error.
+func (o *Options) Prepare() error {
+	all := o.AllColumns()
+	o.cols = nil
+	var err error
+	if len(o.Fields) == 0 {
+		o.cols = all[:len(all)-len(extraColumns)]
+	} else {
+		for _, f := range o.Fields {
+			for _, name := range strings.Split(f, ",") {
+				name = strings.TrimSpace(name)
+				if name == "" {
+					continue
+				}
+				var found bool
+				for _, c := range all {
+					if c.Name == name {
+						o.cols = append(o.cols, c)
+						found = true
+						break
+					}
+				}
+				if !found && err == nil {
+					err = fmt.Errorf("bigly: unknown field: %s", name)
+				}
+			}
+		}
+	}
+	o.work = 0
+	for _, c := range o.cols {
+		o.work |= c.work
+	}
+	if o.IncludeBases {
+		o.work |= workBases
+	}
+	o.prepared = err == nil
+	return err
+}
+
+// defaultPrepared holds the prepared columns and work for Options without Fields or GCWindows.
+var defaultPrepared = func() Options {
+	var o Options
+	if err := o.Prepare(); err != nil {
+		panic(err)
+	}
+	return o
+}()
+
+// prepare prepares Options that were not prepared. Without Fields or GCWindows, the cached
+// default columns are used so that Piles can be output without calling Prepare for each one.
+// The error is for unknown fields, which are left out of the columns.
+func (o *Options) prepare() error {
+	if o.prepared {
+		return nil
+	}
+	if len(o.Fields) != 0 || len(o.GCWindows) != 0 {
+		return o.Prepare()
+	}
+	o.cols, o.work, o.prepared = defaultPrepared.cols, defaultPrepared.work, true
+	if o.IncludeBases {
+		o.work |= workBases
+	}
+	return nil
+}
+
+// Columns returns the columns that are output with these options. Unknown fields are left out;
+// use Prepare to check for them.
+func (o Options) Columns() []Column {
+	o.prepare()
+	return o.cols
+}
+
+// Header returns the tab-delimited names of the output columns, prefixed with '#'.
+func (o Options) Header() string {
+	cols := o.Columns()
+	b := make([]byte, 0, 256)
+	b = append(b, '#')
+	for i, c := range cols {
+		if i > 0 {
+			b = append(b, '\t')
+		}
+		b = append(b, c.Name...)
+	}
+	return string(b)
+}
+
+// namedOptions returns Options that output the named columns in order, as read from a header.
+// The GC windows are taken from the names of the gc and duplicity columns.
+func namedOptions(names []string) (Options, error) {
+	o := Options{SplitterVerbosity: 2, Fields: names}
+	seen := make(map[int]bool)
+	for _, name := range names {
+		if name == "" || strings.Contains(name, ",") {
+			return o, fmt.Errorf("bigly: bad column name: %q", name)
+		}
+		for _, prefix := range []string{"gc", "duplicity"} {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			if w, err := strconv.Atoi(name[len(prefix):]); err == nil && !seen[w] {
+				seen[w] = true
+				o.GCWindows = append(o.GCWindows, w)
+			}
+		}
+	}
+	return o, o.Prepare()
+}
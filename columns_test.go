@@ -0,0 +1,111 @@
+package bigly_test
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type ColumnTest struct{}
+
+var _ = Suite(&ColumnTest{})
+
+var tpile = bigly.Pile{Chrom: "chr1", Pos: 99, Depth: 20, RefBase: 'A', MisMatches: 1, ProperPairs: 18,
+	SoftStarts: 2, SoftEnds: 3, HardStarts: 4, HardEnds: 5, InsertionStarts: 6, InsertionEnds: 7, Deletions: 8,
+	Splitters: 9, Splitters1: 10, InsertSizeLPs: []int32{300, 401}, InsertSizeRMs: []int32{250},
+	OrientationPlusPlus: 1, OrientationMinusMinus: 2, OrientationMinusPlus: 3, OrientationSplitter: 4,
+	Discordant: 11, DiscordantChrom: 12, DiscordantChromEntropy: 0.25, GC: []uint32{30, 120}, Duplicity: []float32{0.125, 0.5},
+	Heads: 13, Tails: 14, Bases: []byte("ACGT"), Quals: []uint8{30, 31, 32, 33},
+	SplitterPositions: []bigly.Position{{Chrom: "chr2", Start: 10, End: 20}, {Chrom: "chr2", Start: 10, End: 30}},
+}
+
+func (t *ColumnTest) TestDefault(c *C) {
+	o := bigly.Options{SplitterVerbosity: 2}
+	c.Assert(tpile.TabString(o), Equals, "chr1\t100\t20\tA\t1\t18\t2\t3\t4\t5\t6\t7\t8\t9\t10\t351\t250\t10\t11\t12\t0.25\t30\t120\t0.12\t0.50\tchr2:11-20,chr2:11-30")
+
+	o.SplitterVerbosity = 1
+	c.Assert(tpile.TabString(o), Equals, "chr1\t100\t20\tA\t1\t18\t2\t3\t4\t5\t6\t7\t8\t9\t10\t351\t250\t10\t11\t12\t0.25\t30\t120\t0.12\t0.50\t10/2/2")
+
+	// missing gc values are output as 0.
+	o.GCWindows = []int{65, 257, 1001}
+	exp := "chr1\t100\t20\tA\t1\t18\t2\t3\t4\t5\t6\t7\t8\t9\t10\t351\t250\t10\t11\t12\t0.25\t30\t120\t0\t0.12\t0.50\t0.00\t10/2/2"
+	// the Options are prepared as needed when Prepare was not called.
+	c.Assert(tpile.TabString(o), Equals, exp)
+	c.Assert(o.Prepare(), IsNil)
+	c.Assert(tpile.TabString(o), Equals, exp)
+}
+
+func (t *ColumnTest) TestFields(c *C) {
+	o := bigly.Options{Fields: []string{"pos,depth", "quals", "gc257", "bases", "heads"}}
+	c.Assert(o.Prepare(), IsNil)
+	c.Assert(tpile.TabString(o), Equals, "100\t20\t?@AB\t120\tACGT\t13")
+
+	// unknown fields are reported by Prepare and left out of the output.
+	o = bigly.Options{Fields: []string{"depth", "xxx"}}
+	c.Assert(tpile.TabString(o), Equals, "20")
+	c.Assert(o.Header(), Equals, "#depth")
+	_, err := bigly.ParseTab("20", o)
+	c.Assert(err, ErrorMatches, "bigly: unknown field: xxx")
+	c.Assert(o.Prepare(), ErrorMatches, "bigly: unknown field: xxx")
+
+	h, recs := refRecords()
+	path := filepath.Join(c.MkDir(), "fields.bam")
+	c.Assert(bigly.WriteIndexedBam(path, h, recs), IsNil)
+	it := bigly.Up(path, o, bigly.Position{Chrom: "ref", Start: 0, End: 45}, nil)
+	c.Assert(it.Error(), ErrorMatches, "bigly: unknown field: xxx")
+	c.Assert(it.Next(), Equals, false)
+}
+
+func (t *ColumnTest) TestSkipWork(c *C) {
+	o := bigly.Options{SplitterVerbosity: 2, Fields: []string{"depth", "softends"}}
+	c.Assert(o.Prepare(), IsNil)
+	p := &bigly.Pile{Chrom: "ref", Pos: 8}
+	p.Update(o, newAligns())
+	c.Assert(p.Depth, Equals, 3)
+	c.Assert(p.SoftEnds, Equals, uint32(2))
+
+	c.Assert(p.Splitters, Equals, uint32(0))
+	c.Assert(p.ProperPairs, Equals, 0)
+	c.Assert(p.SplitterPositions, IsNil)
+
+	o.Fields = []string{"splitters"}
+	c.Assert(o.Prepare(), IsNil)
+	p = &bigly.Pile{Chrom: "ref", Pos: 8}
+	p.Update(o, newAligns())
+	c.Assert(p.Splitters, Equals, uint32(1))
+	c.Assert(p.SplitterPositions, IsNil)
+	c.Assert(p.ProperPairs, Equals, 0)
+
+	o.Fields = nil
+	c.Assert(o.Prepare(), IsNil)
+	p = &bigly.Pile{Chrom: "ref", Pos: 8}
+	p.Update(o, newAligns())
+	c.Assert(p.ProperPairs, Equals, 1)
+	c.Assert(len(p.SplitterPositions), Equals, 1)
+
+	// Options with GCWindows that were not prepared are prepared as needed.
+	p = &bigly.Pile{Chrom: "ref", Pos: 8}
+	p.Update(bigly.Options{GCWindows: []int{101}}, newAligns())
+	c.Assert(p.Depth, Equals, 3)
+	c.Assert(strings.Contains(p.JSONString(bigly.Options{GCWindows: []int{101}}), `"gc101":`), Equals, true)
+}
+
+func (t *ColumnTest) TestHeader(c *C) {
+	o := bigly.Options{}
+	c.Assert(o.Header(), Equals, "#chrom\tpos\tdepth\trefbase\tmismatches\tproperpairs\tsoftstarts\tsoftends\thardstarts\thardends\tinsertionstarts\tinsertionends\tdeletions\tsplitters\tsplitters1\tmeaninsertsizelp\tmeaninsertsizerm\tweird\tdiscordant\tdiscordantchrom\tdiscordantchromentropy\tgc65\tgc257\tduplicity65\tduplicity257\tsplitterpositions")
+	// the header and the body have the same number of columns.
+	c.Assert(strings.Count(o.Header(), "\t"), Equals, strings.Count(tpile.TabString(o), "\t"))
+
+	o = bigly.Options{Fields: []string{"pos,depth", "quals"}, GCWindows: []int{101}}
+	c.Assert(o.Prepare(), IsNil)
+	c.Assert(o.Header(), Equals, "#pos\tdepth\tquals")
+
+	for _, col := range o.AllColumns() {
+		c.Assert(col.Name, Not(Equals), "")
+		c.Assert(col.Description, Not(Equals), "", Commentf(col.Name))
+		c.Assert(col.Type == "string" || col.Type == "int" || col.Type == "float", Equals, true, Commentf(col.Name))
+	}
+	c.Assert(len(o.AllColumns()), Equals, len(bigly.Options{}.AllColumns())-2)
+}
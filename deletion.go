@@ -0,0 +1,415 @@
+package bigly
+
+import (
+	"sort"
+	"strconv"
+)
+
+// DeletionFields are the fields that the DeletionCaller uses. They must be computed by the Iterator.
+var DeletionFields = []string{"chrom", "pos", "depth", "softstarts", "softends", "meaninsertsizelp", "meaninsertsizerm"}
+
+// DeletionOptions sets how the DeletionCaller finds deletions.
+type DeletionOptions struct {
+	// Flank is the number of bases on each side of a deletion used for the expected depth.
+	Flank int
+	// MaxRatio is the largest depth, as a fraction of the flanks, for a base to be in a deletion.
+	MaxRatio float64
+	// MinLength is the shortest deletion that is reported.
+	MinLength int
+	// MaxGap is the number of bases with higher depth that can interrupt a deletion.
+	MaxGap int
+	// MinDepth is the lowest flank depth where deletions are called.
+	MinDepth float64
+	// Slop is how far from the depth change the edges can be moved to clipped reads.
+	Slop int
+	// MinSpanning is the number of pairs with an insert size that spans the deletion needed to
+	// report it. If it is negative, deletions are reported without spanning pairs.
+	MinSpanning int
+}
+
+// DefaultDeletionOptions are used for any zero values in the DeletionOptions.
+var DefaultDeletionOptions = DeletionOptions{Flank: 500, MaxRatio: 0.7, MinLength: 50, MaxGap: 20, MinDepth: 5,
+	Slop: 20, MinSpanning: 2}
+
+// Zygosity is estimated from the depth left in a deletion.
+type Zygosity uint8
+
+const (
+	Heterozygous Zygosity = iota + 1
+	Homozygous
+)
+
+func (z Zygosity) String() string {
+	switch z {
+	case Heterozygous:
+		return "het"
+	case Homozygous:
+		return "hom"
+	}
+	return "unknown"
+}
+
+// GT returns the VCF genotype for the zygosity.
+func (z Zygosity) GT() string {
+	switch z {
+	case Heterozygous:
+		return "0/1"
+	case Homozygous:
+		return "1/1"
+	}
+	return "./."
+}
+
+// homRatio is the depth ratio below which a deletion is homozygous. A heterozygous deletion
+// leaves half of the depth.
+const homRatio = 0.25
+
+// Deletion is a deletion found from a drop in depth.
+type Deletion struct {
+	Chrom string
+	// Start and End are the 0-based, half-open deleted bases.
+	Start, End int
+	// Precise is true if both edges were set from clipped reads.
+	Precise bool
+	// ClipStarts and ClipEnds are the clipped reads at the left and right edges.
+	ClipStarts, ClipEnds int
+	// Depth is the mean depth in the deletion and FlankDepth is the mean depth of the flanks.
+	Depth, FlankDepth float64
+	// Spanning is the number of pairs with an insert size that spans the deletion.
+	Spanning int
+	Zygosity Zygosity
+	// the slop used for the confidence intervals of imprecise edges.
+	slop int
+}
+
+// clipAt holds the clips at a position near a deletion.
+type clipAt struct {
+	pos          int
+	starts, ends int
+}
+
+// flankPos is a position outside of a deletion.
+type flankPos struct {
+	depth  int
+	insert int32
+}
+
+const (
+	delIdle = iota
+	delIn
+	delRight
+)
+
+// DeletionCaller finds deletions in a stream of piles. A deletion is a run of positions with
+// depth below DeletionOptions.MaxRatio of the depth before it. The edges are moved to the clipped
+// reads nearby and it is reported if there are pairs with inserts that span it.
+type DeletionCaller struct {
+	o     DeletionOptions
+	state int
+	chrom string
+	last  int
+	// the positions before the current one that are not in a deletion.
+	ring    []flankPos
+	ri      int
+	ringSum int
+	// the insert sizes of the pile before the deletion and after it.
+	prevLPs, leftLPs, rightRMs []int32
+	prevClips                  []clipAt
+	clips                      []clipAt
+	del                        Deletion
+	done                       Deletion
+	left                       float64
+	lastLow                    int
+	inSum, inN                 int
+	pendSum, pendN             int
+	rightSum, rightN           int
+}
+
+// NewDeletionCaller returns a DeletionCaller. Zero values in o are taken from DefaultDeletionOptions.
+func NewDeletionCaller(o DeletionOptions) *DeletionCaller {
+	d := DefaultDeletionOptions
+	if o.Flank == 0 {
+		o.Flank = d.Flank
+	}
+	if o.MaxRatio == 0 {
+		o.MaxRatio = d.MaxRatio
+	}
+	if o.MinLength == 0 {
+		o.MinLength = d.MinLength
+	}
+	if o.MaxGap == 0 {
+		o.MaxGap = d.MaxGap
+	}
+	if o.MinDepth == 0 {
+		o.MinDepth = d.MinDepth
+	}
+	if o.Slop == 0 {
+		o.Slop = d.Slop
+	}
+	if o.MinSpanning == 0 {
+		o.MinSpanning = d.MinSpanning
+	}
+	return &DeletionCaller{o: o, ring: make([]flankPos, 0, o.Flank)}
+}
+
+func (c *DeletionCaller) baseline() float64 {
+	if len(c.ring) == 0 {
+		return 0
+	}
+	return float64(c.ringSum) / float64(len(c.ring))
+}
+
+// typicalInsert is the median of the insert sizes at the flank positions.
+func (c *DeletionCaller) typicalInsert() int32 {
+	ins := make([]int32, 0, len(c.ring))
+	for _, f := range c.ring {
+		if f.insert > 0 {
+			ins = append(ins, f.insert)
+		}
+	}
+	if len(ins) == 0 {
+		return 0
+	}
+	sort.Slice(ins, func(i, j int) bool { return ins[i] < ins[j] })
+	return ins[len(ins)/2]
+}
+
+func (c *DeletionCaller) push(p *Pile) {
+	f := flankPos{depth: p.Depth, insert: median(p.InsertSizeLPs)}
+	if len(c.ring) < cap(c.ring) {
+		c.ring = append(c.ring, f)
+	} else {
+		c.ringSum -= c.ring[c.ri].depth
+		c.ring[c.ri] = f
+		c.ri = (c.ri + 1) % len(c.ring)
+	}
+	c.ringSum += f.depth
+}
+
+func median(xs []int32) int32 {
+	if len(xs) == 0 {
+		return 0
+	}
+	s := append([]int32(nil), xs...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s[len(s)/2]
+}
+
+func (c *DeletionCaller) reset(chrom string) {
+	c.state = delIdle
+	c.chrom = chrom
+	c.ring, c.ri, c.ringSum = c.ring[:0], 0, 0
+	c.prevLPs, c.prevClips = c.prevLPs[:0], c.prevClips[:0]
+}
+
+func (c *DeletionCaller) low(depth int) bool {
+	return float64(depth) < c.o.MaxRatio*c.left
+}
+
+// Add adds the next pile. Piles must be in order; positions that are skipped have no depth. If
+// p ends a deletion, it is returned if it is confirmed. It is only valid until the next call to
+// Add or Flush.
+func (c *DeletionCaller) Add(p *Pile) *Deletion {
+	var done *Deletion
+	if p.Chrom != c.chrom || p.Pos <= c.last {
+		done = c.Flush()
+		c.reset(p.Chrom)
+	} else if gap := p.Pos - c.last - 1; gap > 0 {
+		// positions without reads.
+		if c.state == delRight {
+			done = c.Flush()
+		}
+		switch c.state {
+		case delIdle:
+			if b := c.baseline(); b >= c.o.MinDepth {
+				c.start(c.last+1, b)
+				c.addLow(p.Pos-1, 0, gap)
+			}
+		case delIn:
+			c.inSum += c.pendSum
+			c.inN += c.pendN
+			c.pendSum, c.pendN = 0, 0
+			c.addLow(p.Pos-1, 0, gap)
+		}
+	}
+	c.last = p.Pos
+
+	if c.state == delRight && c.low(p.Depth) {
+		// a second deletion starts before the flank is complete.
+		done = c.Flush()
+	}
+	switch c.state {
+	case delIdle:
+		if b := c.baseline(); b >= c.o.MinDepth && float64(p.Depth) < c.o.MaxRatio*b {
+			c.start(p.Pos, b)
+			c.addLow(p.Pos, p.Depth, 1)
+		} else {
+			c.push(p)
+			c.prevLPs = append(c.prevLPs[:0], p.InsertSizeLPs...)
+		}
+	case delIn:
+		if c.low(p.Depth) {
+			c.inSum += c.pendSum
+			c.inN += c.pendN
+			c.pendSum, c.pendN = 0, 0
+			c.addLow(p.Pos, p.Depth, 1)
+		} else {
+			if c.pendN == 0 {
+				c.rightRMs = append(c.rightRMs[:0], p.InsertSizeRMs...)
+			}
+			c.pendSum += p.Depth
+			c.pendN++
+			if p.Pos-c.lastLow > c.o.MaxGap {
+				c.state = delRight
+				c.rightSum, c.rightN = c.pendSum, c.pendN
+			}
+		}
+	case delRight:
+		c.push(p)
+		c.rightSum += p.Depth
+		c.rightN++
+	}
+	c.addClips(p)
+	if c.state == delRight && c.rightN >= c.o.Flank {
+		d := c.Flush()
+		if done == nil {
+			done = d
+		}
+	}
+	return done
+}
+
+// addClips keeps the clips near the deletion for the edges.
+func (c *DeletionCaller) addClips(p *Pile) {
+	if p.SoftStarts == 0 && p.SoftEnds == 0 {
+		return
+	}
+	ca := clipAt{pos: p.Pos, starts: int(p.SoftStarts), ends: int(p.SoftEnds)}
+	if c.state == delIdle {
+		// only the clips that can move the start of a deletion are needed.
+		i := 0
+		for i < len(c.prevClips) && c.prevClips[i].pos < p.Pos-c.o.Slop {
+			i++
+		}
+		c.prevClips = append(c.prevClips[:0], c.prevClips[i:]...)
+		c.prevClips = append(c.prevClips, ca)
+		return
+	}
+	if p.Pos <= c.lastLow+c.o.Slop+1 {
+		c.clips = append(c.clips, ca)
+	}
+}
+
+func (c *DeletionCaller) start(pos int, baseline float64) {
+	c.state = delIn
+	c.left = baseline
+	c.del = Deletion{Chrom: c.chrom, Start: pos, slop: c.o.Slop}
+	c.inSum, c.inN, c.pendSum, c.pendN, c.rightSum, c.rightN = 0, 0, 0, 0, 0, 0
+	c.leftLPs = append(c.leftLPs[:0], c.prevLPs...)
+	c.rightRMs = c.rightRMs[:0]
+	c.clips = append(c.clips[:0], c.prevClips...)
+	c.prevClips = c.prevClips[:0]
+}
+
+func (c *DeletionCaller) addLow(last, depth, n int) {
+	c.lastLow = last
+	c.inSum += depth * n
+	c.inN += n
+}
+
+// Flush returns the current deletion, if any and if it is confirmed, and starts again.
+func (c *DeletionCaller) Flush() *Deletion {
+	state := c.state
+	c.state = delIdle
+	c.prevLPs = c.prevLPs[:0]
+	if state == delIdle {
+		return nil
+	}
+	d := &c.del
+	d.End = c.lastLow + 1
+	d.Depth = float64(c.inSum) / float64(c.inN)
+	d.FlankDepth = c.left
+	if c.rightN > 0 {
+		d.FlankDepth = (c.left + float64(c.rightSum)/float64(c.rightN)) / 2
+	}
+	c.refine(d)
+	if d.End-d.Start < c.o.MinLength || d.FlankDepth < c.o.MinDepth {
+		return nil
+	}
+	// a pair spans the deletion if its insert is longer than usual by at least half of the length.
+	minInsert := c.typicalInsert() + int32(d.End-d.Start)/2
+	d.Spanning = max(countAtLeast(c.leftLPs, minInsert), countAtLeast(c.rightRMs, minInsert))
+	if d.Spanning < c.o.MinSpanning {
+		return nil
+	}
+	d.Zygosity = Heterozygous
+	if d.Depth < homRatio*d.FlankDepth {
+		d.Zygosity = Homozygous
+	}
+	c.del, c.done = c.done, c.del
+	return &c.done
+}
+
+// refine moves the edges of d to the positions with the most clipped reads within Slop.
+func (c *DeletionCaller) refine(d *Deletion) {
+	start, end := -1, -1
+	for _, ca := range c.clips {
+		// a clip after the last base before the deletion.
+		if ca.starts > d.ClipStarts && abs(ca.pos+1-d.Start) <= c.o.Slop {
+			d.ClipStarts, start = ca.starts, ca.pos+1
+		}
+		// a clip before the first base after the deletion.
+		if ca.ends > d.ClipEnds && abs(ca.pos-d.End) <= c.o.Slop {
+			d.ClipEnds, end = ca.ends, ca.pos
+		}
+	}
+	if start >= 0 {
+		d.Start = start
+	}
+	if end >= 0 {
+		d.End = end
+	}
+	d.Precise = start >= 0 && end >= 0
+}
+
+func countAtLeast(xs []int32, min int32) int {
+	n := 0
+	for _, x := range xs {
+		if x >= min {
+			n++
+		}
+	}
+	return n
+}
+
+// SV returns the deletion as a DEL for the VCFWriter.
+func (d *Deletion) SV() SV {
+	sv := SV{Chrom: d.Chrom, Pos: d.Start - 1, End: d.End - 1, Type: SVDel, PE: d.Spanning,
+		SC: d.ClipStarts + d.ClipEnds, DepthRatio: d.Depth / d.FlankDepth, GT: d.Zygosity.GT(),
+		Qual: float64(d.Spanning + d.ClipStarts + d.ClipEnds)}
+	if !d.Precise {
+		// imprecise edges are within the slop of the depth change.
+		sv.CIPos = [2]int{-d.slop, d.slop}
+		sv.CIEnd = sv.CIPos
+	}
+	return sv
+}
+
+// DeletionHeader is the header for Deletion.AppendTab.
+const DeletionHeader = "#chrom\tstart\tend\tlength\tzygosity\tdepth\tflankdepth\tspanning\tclipstarts\tclipends\tprecise"
+
+// AppendTab appends the tab-delimited deletion to b. Start and End are 0-based, half-open.
+func (d *Deletion) AppendTab(b []byte) []byte {
+	b = append(b, d.Chrom...)
+	for _, v := range []int{d.Start, d.End, d.End - d.Start} {
+		b = strconv.AppendInt(append(b, '\t'), int64(v), 10)
+	}
+	b = append(append(b, '\t'), d.Zygosity.String()...)
+	for _, v := range []float64{d.Depth, d.FlankDepth} {
+		b = strconv.AppendFloat(append(b, '\t'), v, 'f', 2, 64)
+	}
+	for _, v := range []int{d.Spanning, d.ClipStarts, d.ClipEnds} {
+		b = strconv.AppendInt(append(b, '\t'), int64(v), 10)
+	}
+	return strconv.AppendBool(append(b, '\t'), d.Precise)
+}
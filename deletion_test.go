@@ -0,0 +1,100 @@
+package bigly_test
+
+import (
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type DeletionTest struct{}
+
+var _ = Suite(&DeletionTest{})
+
+// delPiles returns piles for [0, n) with depth 30 and 300bp inserts. Positions where depth
+// returns -1 are left out as the Iterator does for positions without reads.
+func delPiles(chrom string, n int, depth func(pos int) int) []bigly.Pile {
+	var ps []bigly.Pile
+	for pos := 0; pos < n; pos++ {
+		d := depth(pos)
+		if d < 0 {
+			continue
+		}
+		ps = append(ps, bigly.Pile{Chrom: chrom, Pos: pos, Depth: d,
+			InsertSizeLPs: []int32{290, 300, 310}, InsertSizeRMs: []int32{300}})
+	}
+	return ps
+}
+
+func callDeletions(o bigly.DeletionOptions, piles []bigly.Pile) []bigly.Deletion {
+	dc := bigly.NewDeletionCaller(o)
+	var got []bigly.Deletion
+	for i := range piles {
+		if d := dc.Add(&piles[i]); d != nil {
+			got = append(got, *d)
+		}
+	}
+	if d := dc.Flush(); d != nil {
+		got = append(got, *d)
+	}
+	return got
+}
+
+func (t *DeletionTest) TestHomozygous(c *C) {
+	piles := delPiles("chr1", 3000, func(pos int) int {
+		if pos >= 1000 && pos < 1200 {
+			return -1
+		}
+		return 30
+	})
+	// the last base before the deletion has reads clipped after it and pairs that span it.
+	piles[999].SoftStarts = 5
+	piles[999].InsertSizeLPs = []int32{300, 500, 520, 510}
+	piles[1000].SoftEnds = 4
+	c.Assert(piles[1000].Pos, Equals, 1200)
+
+	got := callDeletions(bigly.DeletionOptions{}, piles)
+	c.Assert(got, HasLen, 1)
+	d := got[0]
+	c.Assert(d.Chrom, Equals, "chr1")
+	c.Assert(d.Start, Equals, 1000)
+	c.Assert(d.End, Equals, 1200)
+	c.Assert(d.Precise, Equals, true)
+	c.Assert(d.Spanning, Equals, 3)
+	c.Assert(d.Depth, Equals, 0.0)
+	c.Assert(d.FlankDepth, Equals, 30.0)
+	c.Assert(d.Zygosity, Equals, bigly.Homozygous)
+	c.Assert(string(d.AppendTab(nil)), Equals, "chr1\t1000\t1200\t200\thom\t0.00\t30.00\t3\t5\t4\ttrue")
+
+	sv := d.SV()
+	c.Assert(sv.Pos, Equals, 999)
+	c.Assert(sv.End, Equals, 1199)
+	c.Assert(sv.GT, Equals, "1/1")
+	c.Assert(sv.CIPos, Equals, [2]int{})
+}
+
+func (t *DeletionTest) TestHeterozygous(c *C) {
+	piles := delPiles("chr2", 1500, func(pos int) int {
+		switch {
+		case pos >= 1000 && pos < 1200:
+			return 15
+		// too short.
+		case pos >= 500 && pos < 510:
+			return 10
+		}
+		return 30
+	})
+	piles[1200].InsertSizeRMs = []int32{300, 500, 510}
+	got := callDeletions(bigly.DeletionOptions{}, piles)
+	c.Assert(got, HasLen, 1)
+	d := got[0]
+	c.Assert(d.Start, Equals, 1000)
+	c.Assert(d.End, Equals, 1200)
+	c.Assert(d.Precise, Equals, false)
+	c.Assert(d.Spanning, Equals, 2)
+	c.Assert(d.Zygosity, Equals, bigly.Heterozygous)
+	c.Assert(d.SV().CIPos, Equals, [2]int{-20, 20})
+
+	// without spanning pairs, it is not reported.
+	piles[1200].InsertSizeRMs = nil
+	c.Assert(callDeletions(bigly.DeletionOptions{}, piles), HasLen, 0)
+	c.Assert(callDeletions(bigly.DeletionOptions{MinSpanning: -1}, piles), HasLen, 1)
+}
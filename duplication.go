@@ -0,0 +1,179 @@
+package bigly
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// DuplicationOptions sets how tandem duplications are found from Links.
+type DuplicationOptions struct {
+	// Slop is the distance used to cluster the ends of pairs.
+	Slop int
+	// MaxDistance is how far from the pairs a breakpoint can be.
+	MaxDistance int
+	// MinPairs is the number of -/+ pairs needed.
+	MinPairs int
+	// MinRatio is the lowest ratio of the depth in the duplication to the depth of the flanks.
+	MinRatio float64
+	// Flank is the largest number of bases on each side used for the flank depth.
+	Flank int
+}
+
+// DefaultDuplicationOptions are used for any zero values in the DuplicationOptions.
+var DefaultDuplicationOptions = DuplicationOptions{Slop: 200, MaxDistance: 1000, MinPairs: 2, MinRatio: 1.3, Flank: 1000}
+
+// DepthFunc returns the mean depth in a region.
+type DepthFunc func(pos Position) (float64, error)
+
+// Duplication is a tandem duplication found from a -/+ cluster of pairs.
+type Duplication struct {
+	Chrom string
+	// Start and End are the 0-based, half-open duplicated bases.
+	Start, End int
+	// CIStart and CIEnd are the confidence intervals around Start and End. They are 0 if the
+	// breakpoints were set from splitters.
+	CIStart, CIEnd [2]int
+	// Pairs are the -/+ pairs and Splits are the split reads that join End to Start.
+	Pairs, Splits int
+	// Depth is the mean depth in the duplication and FlankDepth is the mean depth on either side.
+	Depth, FlankDepth float64
+}
+
+// Precise reports whether the breakpoints were set from splitters.
+func (dup *Duplication) Precise() bool {
+	return dup.CIStart == [2]int{} && dup.CIEnd == [2]int{}
+}
+
+// Duplications finds tandem duplications from the -/+ clusters of pairs in links. Split reads
+// with both parts on the same strand that join a position near the end of the cluster back to
+// one near its start set the breakpoints. If depth is not nil, the depth in the duplication must be at least MinRatio
+// of the flanks. Duplications are sorted by chromosome and Start.
+func Duplications(links []Link, depth DepthFunc, o DuplicationOptions) ([]Duplication, error) {
+	d := DefaultDuplicationOptions
+	if o.Slop == 0 {
+		o.Slop = d.Slop
+	}
+	if o.MaxDistance == 0 {
+		o.MaxDistance = d.MaxDistance
+	}
+	if o.MinPairs == 0 {
+		o.MinPairs = d.MinPairs
+	}
+	if o.MinRatio == 0 {
+		o.MinRatio = d.MinRatio
+	}
+	if o.Flank == 0 {
+		o.Flank = d.Flank
+	}
+	var pairs, splits []Link
+	for _, l := range links {
+		if l.A.Chrom != l.B.Chrom {
+			continue
+		}
+		l = l.ordered()
+		switch {
+		// the left-most read is reverse and its mate is forward.
+		case l.Type == LinkPair && !l.A.Strand && l.B.Strand:
+			pairs = append(pairs, l)
+		// the end of the duplication is joined to its start.
+		case l.Type == LinkSplit && l.A.Strand == l.B.Strand && !l.AEnd && l.BEnd:
+			splits = append(splits, l)
+		}
+	}
+
+	var dups []Duplication
+	for _, c := range ClusterLinks(pairs, o.Slop) {
+		if c.Pairs < o.MinPairs {
+			continue
+		}
+		// the reverse reads are just after the start and the forward mates are just before the end.
+		dup := Duplication{Chrom: c.A.Chrom, Pairs: c.Pairs}
+		var starts, ends []int
+		for _, s := range splits {
+			if s.A.Chrom == dup.Chrom && within(s.A.Start, c.A.Start-o.MaxDistance, c.A.End, 0) &&
+				within(s.B.End, c.B.Start, c.B.End+o.MaxDistance, 0) {
+				starts, ends = append(starts, s.A.Start), append(ends, s.B.End)
+			}
+		}
+		dup.Splits = len(starts)
+		if len(starts) > 0 {
+			dup.Start, dup.End = medianInt(starts), medianInt(ends)
+		} else {
+			dup.Start, dup.End = c.A.Start, c.B.End
+			dup.CIStart = [2]int{-o.Slop, 0}
+			dup.CIEnd = [2]int{0, o.Slop}
+		}
+		if dup.End <= dup.Start {
+			continue
+		}
+		if depth != nil {
+			var err error
+			if dup.Depth, err = depth(Position{Chrom: dup.Chrom, Start: dup.Start, End: dup.End}); err != nil {
+				return nil, err
+			}
+			f := min(dup.End-dup.Start, o.Flank)
+			left, err := depth(Position{Chrom: dup.Chrom, Start: max(dup.Start-f, 0), End: dup.Start})
+			if err != nil {
+				return nil, err
+			}
+			right, err := depth(Position{Chrom: dup.Chrom, Start: dup.End, End: dup.End + f})
+			if err != nil {
+				return nil, err
+			}
+			dup.FlankDepth = (left + right) / 2
+			if dup.Depth < o.MinRatio*dup.FlankDepth {
+				continue
+			}
+		}
+		dups = append(dups, dup)
+	}
+	sort.Slice(dups, func(i, j int) bool {
+		if dups[i].Chrom != dups[j].Chrom {
+			return dups[i].Chrom < dups[j].Chrom
+		}
+		return dups[i].Start < dups[j].Start
+	})
+	return dups, nil
+}
+
+// MeanDepth returns the mean depth of the piles in pos, counting positions without reads as 0.
+// The Iterator is moved to pos so Seek must be called to continue elsewhere.
+func (it *Iterator) MeanDepth(pos Position) (float64, error) {
+	if pos.End <= pos.Start {
+		return 0, nil
+	}
+	if err := it.Seek(pos); err != nil {
+		return 0, err
+	}
+	sum := 0
+	for it.Next() {
+		sum += it.Pile().Depth
+	}
+	return float64(sum) / float64(pos.End-pos.Start), it.Error()
+}
+
+// SV returns the duplication as a DUP for the VCFWriter.
+func (dup *Duplication) SV() SV {
+	sv := SV{Chrom: dup.Chrom, Pos: dup.Start - 1, End: dup.End - 1, Type: SVDup, CIPos: dup.CIStart, CIEnd: dup.CIEnd,
+		SR: dup.Splits, PE: dup.Pairs, Qual: float64(dup.Splits + dup.Pairs), DepthRatio: math.NaN()}
+	if dup.FlankDepth > 0 {
+		sv.DepthRatio = dup.Depth / dup.FlankDepth
+	}
+	return sv
+}
+
+// DuplicationHeader is the header for Duplication.AppendTab.
+const DuplicationHeader = "#chrom\tstart\tend\tlength\tpairs\tsplits\tdepth\tflankdepth\tprecise"
+
+// AppendTab appends the tab-delimited duplication to b. Start and End are 0-based, half-open.
+func (dup *Duplication) AppendTab(b []byte) []byte {
+	b = append(b, dup.Chrom...)
+	for _, v := range []int{dup.Start, dup.End, dup.End - dup.Start, dup.Pairs, dup.Splits} {
+		b = strconv.AppendInt(append(b, '\t'), int64(v), 10)
+	}
+	for _, v := range []float64{dup.Depth, dup.FlankDepth} {
+		b = strconv.AppendFloat(append(b, '\t'), v, 'f', 2, 64)
+	}
+	return strconv.AppendBool(append(b, '\t'), dup.Precise())
+}
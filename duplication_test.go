@@ -0,0 +1,74 @@
+package bigly_test
+
+import (
+	"fmt"
+
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type DuplicationTest struct{}
+
+var _ = Suite(&DuplicationTest{})
+
+// dupLinks returns the pairs for a tandem duplication of [10000, 12000).
+func dupLinks() []bigly.Link {
+	var links []bigly.Link
+	for i := 0; i < 3; i++ {
+		// reverse reads after the start with forward mates before the end.
+		links = append(links, link(bigly.LinkPair, 10050+50*i, false, 11700+50*i, true))
+	}
+	// normal orientation.
+	links = append(links, link(bigly.LinkPair, 20000, true, 30000, false), link(bigly.LinkPair, 20010, true, 30010, false))
+	return links
+}
+
+// dupDepth returns depth 30 with 45 in [10000, 12000).
+func dupDepth(pos bigly.Position) (float64, error) {
+	if pos.Chrom != "chr1" {
+		return 0, fmt.Errorf("unknown chrom %s", pos.Chrom)
+	}
+	if pos.Start >= 10000 && pos.End <= 12000 {
+		return 45, nil
+	}
+	return 30, nil
+}
+
+func (t *DuplicationTest) TestPrecise(c *C) {
+	links := append(dupLinks(),
+		// the end of the duplication joined to its start.
+		split(11900, true, true, 10000, true, false),
+		split(10000, false, false, 11900, false, true),
+		// a deletion-like split.
+		split(9900, true, true, 12000, true, false))
+	dups, err := bigly.Duplications(links, dupDepth, bigly.DuplicationOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(dups, HasLen, 1)
+	dup := dups[0]
+	c.Assert(dup.Start, Equals, 10000)
+	c.Assert(dup.End, Equals, 12000)
+	c.Assert(dup.Pairs, Equals, 3)
+	c.Assert(dup.Splits, Equals, 2)
+	c.Assert(dup.Precise(), Equals, true)
+	c.Assert(string(dup.AppendTab(nil)), Equals, "chr1\t10000\t12000\t2000\t3\t2\t45.00\t30.00\ttrue")
+
+	sv := dup.SV()
+	c.Assert(sv.Type, Equals, bigly.SVDup)
+	c.Assert(sv.Pos, Equals, 9999)
+	c.Assert(sv.DepthRatio, Equals, 1.5)
+}
+
+func (t *DuplicationTest) TestImprecise(c *C) {
+	dups, err := bigly.Duplications(dupLinks(), nil, bigly.DuplicationOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(dups, HasLen, 1)
+	c.Assert(dups[0].Start, Equals, 10050)
+	c.Assert(dups[0].End, Equals, 11900)
+	c.Assert(dups[0].CIStart, Equals, [2]int{-200, 0})
+	c.Assert(dups[0].Precise(), Equals, false)
+
+	// not enough gain in depth.
+	dups, err = bigly.Duplications(dupLinks(), dupDepth, bigly.DuplicationOptions{MinRatio: 2})
+	c.Assert(err, IsNil)
+	c.Assert(dups, HasLen, 0)
+}
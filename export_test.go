@@ -0,0 +1,52 @@
+package bigly
+
+import "github.com/biogo/hts/sam"
+
+// WriteIndexedBam writes recs to a bam at path with a .bai index.
+var WriteIndexedBam = writeIndexedBam
+
+// SweepPiles runs the sweep engine over alns and returns the piles for [start, end).
+// ref holds the reference base for each position.
+func SweepPiles(o Options, alns []*Align, chrom string, ref []byte, start, end int) []*Pile {
+	o.Prepare()
+	sw := newSweep(start)
+	for _, a := range alns {
+		sw.add(o, a)
+	}
+	piles := make([]*Pile, 0, end-start)
+	for pos := start; pos < end; pos++ {
+		p := &Pile{}
+		sw.next(pos, p)
+		p.Chrom, p.Pos, p.RefBase = chrom, pos, ref[pos]
+		sw.finish(o, p)
+		piles = append(piles, p)
+	}
+	return piles
+}
+
+// PileupImageOf returns the image of the records for the window around site.
+func PileupImageOf(o Options, recs []*sam.Record, chrom string, site, width, height int) *PileupImage {
+	o.Prepare()
+	return newPileupImage(o, recs, chrom, site, width, height)
+}
+
+// RecordLinks returns the links from recs.
+func RecordLinks(o Options, recs []*sam.Record) []Link {
+	var links []Link
+	pairs := make(map[string]bool)
+	for _, r := range recs {
+		links = recordLinks(o, r, links, pairs)
+	}
+	return links
+}
+
+// GenotypeReads returns the reference and alternate reads in recs for sv.
+func GenotypeReads(o Options, g GenotypeOptions, sv *SV, recs []*sam.Record) (ref, alt int) {
+	o.Prepare()
+	return genotypeReads(o, g.withDefaults(), svJunctions(sv), recs)
+}
+
+// DepthAlleles splits depth into reference and alternate reads.
+func DepthAlleles(t SVType, in, flank float64) (ref, alt int) {
+	return depthAlleles(t, in, flank)
+}
@@ -0,0 +1,182 @@
+package bigly
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/brentp/bigly/npy"
+)
+
+// FeatureWriter writes the numeric fields of piles as NumPy float32 arrays of positions x
+// fields, with one array per region. A JSON sidecar gives the column names and the regions.
+// There is a row for every position of a region so that row i is position Start+i. Positions
+// without a Pile, like those the Iterator skips where there is no coverage, get the values of
+// an empty Pile, except that the reference columns (gcN and duplicityN) are NaN as they are
+// not known without the Pile.
+type FeatureWriter struct {
+	path string
+	fh   *os.File
+	// npz is nil for a single .npy array.
+	npz  *npy.NpzWriter
+	cur  *npy.Writer
+	cols []Column
+	opts Options
+	row  []float32
+	meta featureMeta
+	// the current region and the position of the next row.
+	region Position
+	next   int
+}
+
+type featureMeta struct {
+	Columns []string       `json:"columns"`
+	Arrays  []featureArray `json:"arrays"`
+}
+
+type featureArray struct {
+	Name  string `json:"name"`
+	Chrom string `json:"chrom"`
+	// Start and End are 0-based, half-open.
+	Start int `json:"start"`
+	End   int `json:"end"`
+	Rows  int `json:"rows"`
+}
+
+// NewFeatureWriter creates an .npz file, or with a path ending in .npy, a single array. The
+// fields in o that are not numeric, like chrom, are left out. The sidecar is written to
+// path + ".json" by Close.
+func NewFeatureWriter(path string, o Options) (*FeatureWriter, error) {
+	if err := o.Prepare(); err != nil {
+		return nil, err
+	}
+	w := &FeatureWriter{path: path, opts: o}
+	for _, c := range o.cols {
+		if c.Type != "string" {
+			w.cols = append(w.cols, c)
+			w.meta.Columns = append(w.meta.Columns, c.Name)
+		}
+	}
+	if len(w.cols) == 0 {
+		return nil, fmt.Errorf("bigly: no numeric fields for feature output")
+	}
+	w.row = make([]float32, len(w.cols))
+	fh, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w.fh = fh
+	if !strings.HasSuffix(path, ".npy") {
+		w.npz = npy.NewNpzWriter(fh)
+	}
+	return w, nil
+}
+
+// Region starts a new array for the piles in pos. The array is named like chr1:1001-2000.
+// A .npy file can only hold a single region. The End must be set, e.g. from the bam header
+// for a whole chromosome, so that the array can be filled to it.
+func (w *FeatureWriter) Region(pos Position) error {
+	if err := w.finish(); err != nil {
+		return err
+	}
+	if pos.End <= pos.Start {
+		return fmt.Errorf("bigly: region %s must end after its start", pos)
+	}
+	name := pos.String()
+	var err error
+	if w.npz != nil {
+		w.cur, err = w.npz.Create(name, len(w.cols))
+	} else if len(w.meta.Arrays) > 0 {
+		return fmt.Errorf("bigly: a .npy file can only hold one region; use .npz")
+	} else {
+		w.cur, err = npy.NewWriter(w.fh, len(w.cols))
+	}
+	if err != nil {
+		return err
+	}
+	w.meta.Arrays = append(w.meta.Arrays, featureArray{Name: name, Chrom: pos.Chrom, Start: pos.Start, End: pos.End})
+	w.region, w.next = pos, pos.Start
+	return nil
+}
+
+// Write adds a row for p to the current array, after empty rows for any positions that were skipped.
+// Piles must be in order and in the region.
+func (w *FeatureWriter) Write(p *Pile) error {
+	if w.cur == nil {
+		return fmt.Errorf("bigly: Region must be called before Write")
+	}
+	if p.Chrom != w.region.Chrom || p.Pos < w.next || p.Pos >= w.region.End {
+		return fmt.Errorf("bigly: pile at %s:%d is out of order or outside of %s", p.Chrom, p.Pos+1, w.region)
+	}
+	if err := w.fill(p.Pos); err != nil {
+		return err
+	}
+	w.next = p.Pos + 1
+	return w.write(p, false)
+}
+
+// fill writes empty rows up to end.
+func (w *FeatureWriter) fill(end int) error {
+	for ; w.next < end; w.next++ {
+		if err := w.write(&Pile{Chrom: w.region.Chrom, Pos: w.next}, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes a row for p. For an empty row, the reference columns are NaN.
+func (w *FeatureWriter) write(p *Pile, empty bool) error {
+	for i, c := range w.cols {
+		if empty && c.work&workGC != 0 {
+			w.row[i] = float32(math.NaN())
+			continue
+		}
+		v, err := c.Value(p, w.opts)
+		if err != nil {
+			return err
+		}
+		w.row[i] = float32(v)
+	}
+	return w.cur.Write(w.row)
+}
+
+// finish fills the current array to the end of the region, closes it and records its number of rows.
+func (w *FeatureWriter) finish() error {
+	if w.cur == nil {
+		return nil
+	}
+	if err := w.fill(w.region.End); err != nil {
+		return err
+	}
+	w.meta.Arrays[len(w.meta.Arrays)-1].Rows = w.cur.Rows()
+	cur := w.cur
+	w.cur = nil
+	if w.npz != nil {
+		// the npz writer closes the array.
+		return nil
+	}
+	return cur.Close()
+}
+
+// Close finishes the arrays and writes the sidecar.
+func (w *FeatureWriter) Close() error {
+	err := w.finish()
+	if err == nil && w.npz != nil {
+		err = w.npz.Close()
+	}
+	if cerr := w.fh.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(w.meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(w.path+".json", append(b, '\n'), 0644)
+}
@@ -0,0 +1,164 @@
+package bigly_test
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/biogo/hts/sam"
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type FeatureTest struct {
+	dir string
+}
+
+var _ = Suite(&FeatureTest{})
+
+func (t *FeatureTest) SetUpTest(c *C) { t.dir = c.MkDir() }
+
+// npyValues returns the values after the header of an .npy file.
+func npyValues(b []byte) []float32 {
+	n := 10 + int(binary.LittleEndian.Uint16(b[8:]))
+	vs := make([]float32, (len(b)-n)/4)
+	for i := range vs {
+		vs[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[n+4*i:]))
+	}
+	return vs
+}
+
+type sidecar struct {
+	Columns []string
+	Arrays  []struct {
+		Name       string
+		Chrom      string
+		Start, End int
+		Rows       int
+	}
+}
+
+func readSidecar(c *C, path string) sidecar {
+	b, err := ioutil.ReadFile(path + ".json")
+	c.Assert(err, IsNil)
+	var s sidecar
+	c.Assert(json.Unmarshal(b, &s), IsNil)
+	return s
+}
+
+func (t *FeatureTest) TestNpz(c *C) {
+	path := filepath.Join(t.dir, "f.npz")
+	o := bigly.Options{Fields: []string{"chrom,pos,depth,discordantchromentropy"}}
+	w, err := bigly.NewFeatureWriter(path, o)
+	c.Assert(err, IsNil)
+	c.Assert(w.Write(&tpile), ErrorMatches, ".*Region must be called.*")
+	c.Assert(w.Region(bigly.Position{Chrom: "chr1", Start: 99, End: 101}), IsNil)
+	c.Assert(w.Write(&tpile), IsNil)
+	c.Assert(w.Write(&bigly.Pile{Chrom: "chr1", Pos: 100, Depth: 3}), IsNil)
+	c.Assert(w.Region(bigly.Position{Chrom: "chr2", Start: 0, End: 10}), IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	s := readSidecar(c, path)
+	c.Assert(s.Columns, DeepEquals, []string{"pos", "depth", "discordantchromentropy"})
+	c.Assert(s.Arrays, HasLen, 2)
+	c.Assert(s.Arrays[0].Name, Equals, "chr1:100-101")
+	c.Assert(s.Arrays[0].Rows, Equals, 2)
+	// the second region is filled with empty rows.
+	c.Assert(s.Arrays[1].Rows, Equals, 10)
+
+	zr, err := zip.OpenReader(path)
+	c.Assert(err, IsNil)
+	defer zr.Close()
+	c.Assert(zr.File, HasLen, 2)
+	c.Assert(zr.File[0].Name, Equals, "chr1:100-101.npy")
+	r, err := zr.File[0].Open()
+	c.Assert(err, IsNil)
+	b, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(npyValues(b), DeepEquals, []float32{100, 20, 0.25, 101, 3, 0})
+}
+
+func (t *FeatureTest) TestNpy(c *C) {
+	path := filepath.Join(t.dir, "f.npy")
+	w, err := bigly.NewFeatureWriter(path, bigly.Options{Fields: []string{"depth"}})
+	c.Assert(err, IsNil)
+	c.Assert(w.Region(bigly.Position{Chrom: "chr1", Start: 99, End: 101}), IsNil)
+	c.Assert(w.Write(&tpile), IsNil)
+	c.Assert(w.Write(&tpile), ErrorMatches, ".*out of order.*")
+	c.Assert(w.Write(&bigly.Pile{Chrom: "chr2", Pos: 100}), ErrorMatches, ".*outside of chr1:100-101")
+	c.Assert(w.Region(bigly.Position{Chrom: "chr2", Start: 99, End: 101}), ErrorMatches, ".*only hold one region.*")
+	c.Assert(w.Close(), IsNil)
+	b, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Assert(npyValues(b), DeepEquals, []float32{20, 0})
+	c.Assert(readSidecar(c, path).Arrays[0].Rows, Equals, 2)
+
+	_, err = bigly.NewFeatureWriter(path, bigly.Options{Fields: []string{"chrom"}})
+	c.Assert(err, ErrorMatches, ".*no numeric fields.*")
+	os.Remove(path)
+}
+
+func (t *FeatureTest) TestGap(c *C) {
+	ref, _ := sam.NewReference("ref", "", "", 50, nil, nil)
+	h, _ := sam.NewHeader(nil, []*sam.Reference{ref})
+	var recs []*sam.Record
+	for _, pos := range []int{5, 30} {
+		recs = append(recs, &sam.Record{Name: "r" + strconv.Itoa(pos), Ref: ref, Pos: pos, MapQ: 60,
+			Cigar: []sam.CigarOp{sam.NewCigarOp(sam.CigarMatch, 10)},
+			Seq:   sam.NewSeq([]byte("ACGTACGTAC")), Qual: []byte{30, 30, 30, 30, 30, 30, 30, 30, 30, 30}})
+	}
+	bam := filepath.Join(t.dir, "gap.bam")
+	c.Assert(bigly.WriteIndexedBam(bam, h, recs), IsNil)
+
+	o := bigly.Options{Fields: []string{"pos,depth,gc65"}}
+	region := bigly.Position{Chrom: "ref", Start: 2, End: 48}
+	path := filepath.Join(t.dir, "gap.npy")
+	w, err := bigly.NewFeatureWriter(path, o)
+	c.Assert(err, IsNil)
+	c.Assert(w.Region(region), IsNil)
+	it := bigly.Up(bam, o, region, nil)
+	c.Assert(it.Error(), IsNil)
+	var piles int
+	written := make(map[int]bool)
+	for it.Next() {
+		c.Assert(w.Write(it.Pile()), IsNil)
+		written[it.Pile().Pos] = true
+		piles++
+	}
+	c.Assert(it.Error(), IsNil)
+	c.Assert(it.Close(), IsNil)
+	c.Assert(w.Close(), IsNil)
+	// the iterator skips the gaps but the rows do not.
+	c.Assert(piles < region.End-region.Start, Equals, true)
+
+	b, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	vs := npyValues(b)
+	c.Assert(vs, HasLen, 3*(region.End-region.Start))
+	for i := 0; i < len(vs)/3; i++ {
+		pos := region.Start + i
+		// without a fasta, gc65 is 0 where there is a pile and NaN where the row is filled.
+		var depth float32
+		if pos >= 5 && pos < 15 || pos >= 30 && pos < 40 {
+			depth = 1
+		}
+		gc := float32(math.NaN())
+		if written[pos] {
+			gc = 0
+		}
+		row := vs[3*i : 3*i+3]
+		c.Assert(row[:2], DeepEquals, []float32{float32(pos + 1), depth}, Commentf("pos: %d", pos))
+		c.Assert(math.IsNaN(float64(row[2])), Equals, math.IsNaN(float64(gc)), Commentf("pos: %d", pos))
+	}
+	c.Assert(readSidecar(c, path).Arrays[0].Rows, Equals, region.End-region.Start)
+
+	w, err = bigly.NewFeatureWriter(filepath.Join(t.dir, "chrom.npy"), o)
+	c.Assert(err, IsNil)
+	c.Assert(w.Region(bigly.Position{Chrom: "ref"}), ErrorMatches, ".*must end after its start.*")
+	c.Assert(w.Close(), IsNil)
+}
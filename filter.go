@@ -0,0 +1,172 @@
+package bigly
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/hts/sam"
+)
+
+// ReadFilter reports whether a record should be used in the pileup.
+// Filters in Options.Filters are applied after the flag and mapping-quality checks.
+type ReadFilter func(r *sam.Record) bool
+
+// auxNumber returns the numeric value of an aux field.
+func auxNumber(a sam.Aux) (float64, bool) {
+	switch v := a.Value().(type) {
+	case int8:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// auxString returns the text value of an aux field.
+func auxString(a sam.Aux) string {
+	switch v := a.Value().(type) {
+	case string:
+		return v
+	case byte:
+		if a.Type() == 'A' {
+			return string(v)
+		}
+	}
+	return fmt.Sprint(a.Value())
+}
+
+// MaxNM excludes reads with an NM (edit distance) tag greater than n.
+// Reads without an NM tag are kept.
+func MaxNM(n int) ReadFilter {
+	return func(r *sam.Record) bool {
+		t, ok := r.Tag([]byte{'N', 'M'})
+		if !ok {
+			return true
+		}
+		v, ok := auxNumber(t)
+		return !ok || v <= float64(n)
+	}
+}
+
+// MinASXS excludes reads where the alignment score (AS) is less than margin more
+// than the best suboptimal score (XS). Reads lacking either tag are kept.
+func MinASXS(margin int) ReadFilter {
+	return func(r *sam.Record) bool {
+		as, ok := r.Tag([]byte{'A', 'S'})
+		if !ok {
+			return true
+		}
+		xs, ok := r.Tag([]byte{'X', 'S'})
+		if !ok {
+			return true
+		}
+		a, aok := auxNumber(as)
+		x, xok := auxNumber(xs)
+		return !(aok && xok) || a-x >= float64(margin)
+	}
+}
+
+// MinAlignedLength excludes reads with fewer than n bases aligned to the reference.
+func MinAlignedLength(n int) ReadFilter {
+	return func(r *sam.Record) bool {
+		var l int
+		for _, co := range r.Cigar {
+			con := co.Type().Consumes()
+			if con.Query != 0 && con.Reference != 0 {
+				l += co.Len()
+			}
+		}
+		return l >= n
+	}
+}
+
+// ReadGroups keeps only reads with an RG tag in the given list.
+func ReadGroups(ids ...string) ReadFilter {
+	m := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		m[id] = true
+	}
+	return func(r *sam.Record) bool {
+		t, ok := r.Tag([]byte{'R', 'G'})
+		return ok && m[auxString(t)]
+	}
+}
+
+var tagOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// TagFilter parses an expression like "NM<5" or "RG==lib1" into a ReadFilter.
+// Supported operators are ==, !=, <, <=, > and >=. If the value is numeric, the
+// comparison is numeric, otherwise only == and != are allowed. A read without the
+// tag fails every expression except those using !=.
+func TagFilter(expr string) (ReadFilter, error) {
+	expr = strings.TrimSpace(expr)
+	var op string
+	i := -1
+	for _, o := range tagOps {
+		if i = strings.Index(expr, o); i != -1 {
+			op = o
+			break
+		}
+	}
+	if i != 2 {
+		return nil, fmt.Errorf("bigly: expected a tag expression like NM<5 or RG==lib1. got %q", expr)
+	}
+	tag := []byte(expr[:2])
+	val := expr[2+len(op):]
+	num, err := strconv.ParseFloat(val, 64)
+	isNum := err == nil
+	if !isNum && op != "==" && op != "!=" {
+		return nil, fmt.Errorf("bigly: non-numeric value in tag expression %q", expr)
+	}
+
+	return func(r *sam.Record) bool {
+		t, ok := r.Tag(tag)
+		if !ok {
+			return op == "!="
+		}
+		if isNum {
+			v, ok := auxNumber(t)
+			if !ok {
+				return op == "!="
+			}
+			switch op {
+			case "==":
+				return v == num
+			case "!=":
+				return v != num
+			case "<":
+				return v < num
+			case "<=":
+				return v <= num
+			case ">":
+				return v > num
+			default:
+				return v >= num
+			}
+		}
+		if op == "==" {
+			return auxString(t) == val
+		}
+		return auxString(t) != val
+	}, nil
+}
@@ -0,0 +1,67 @@
+package bigly_test
+
+import (
+	"github.com/biogo/hts/sam"
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type FilterTest struct{}
+
+var _ = Suite(&FilterTest{})
+
+func frec(aux ...interface{}) *sam.Record {
+	r := &sam.Record{Name: "f", Pos: 10, MapQ: 30, Cigar: sam.Cigar{
+		sam.NewCigarOp(sam.CigarSoftClipped, 5),
+		sam.NewCigarOp(sam.CigarMatch, 20),
+	}}
+	for i := 0; i < len(aux); i += 2 {
+		r.AuxFields = append(r.AuxFields, mustAux(sam.NewAux(sam.NewTag(aux[i].(string)), aux[i+1])))
+	}
+	return r
+}
+
+func (t *FilterTest) TestTagFilter(c *C) {
+	f, err := bigly.TagFilter("NM<5")
+	c.Assert(err, IsNil)
+	c.Assert(f(frec("NM", 3)), Equals, true)
+	c.Assert(f(frec("NM", 5)), Equals, false)
+	c.Assert(f(frec()), Equals, false)
+
+	f, err = bigly.TagFilter("RG==lib1")
+	c.Assert(err, IsNil)
+	c.Assert(f(frec("RG", "lib1")), Equals, true)
+	c.Assert(f(frec("RG", "lib2")), Equals, false)
+
+	f, err = bigly.TagFilter("RG!=lib1")
+	c.Assert(err, IsNil)
+	c.Assert(f(frec("RG", "lib2")), Equals, true)
+	c.Assert(f(frec()), Equals, true)
+
+	f, err = bigly.TagFilter("NM>=2")
+	c.Assert(err, IsNil)
+	c.Assert(f(frec("NM", 2)), Equals, true)
+	c.Assert(f(frec("NM", 1)), Equals, false)
+
+	_, err = bigly.TagFilter("RG<lib1")
+	c.Assert(err, NotNil)
+	_, err = bigly.TagFilter("NM5")
+	c.Assert(err, NotNil)
+}
+
+func (t *FilterTest) TestBuiltins(c *C) {
+	c.Assert(bigly.MaxNM(2)(frec("NM", 2)), Equals, true)
+	c.Assert(bigly.MaxNM(2)(frec("NM", 3)), Equals, false)
+
+	c.Assert(bigly.MinASXS(3)(frec("AS", 5, "XS", 2)), Equals, true)
+	c.Assert(bigly.MinASXS(4)(frec("AS", 5, "XS", 2)), Equals, false)
+	c.Assert(bigly.MinASXS(4)(frec("AS", 5)), Equals, true)
+
+	c.Assert(bigly.MinAlignedLength(20)(frec()), Equals, true)
+	c.Assert(bigly.MinAlignedLength(21)(frec()), Equals, false)
+
+	rg := bigly.ReadGroups("a", "b")
+	c.Assert(rg(frec("RG", "b")), Equals, true)
+	c.Assert(rg(frec("RG", "c")), Equals, false)
+	c.Assert(rg(frec()), Equals, false)
+}
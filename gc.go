@@ -0,0 +1,200 @@
+package bigly
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/brentp/faidx"
+)
+
+// DefaultGCWindows are the window sizes used when Options.GCWindows is empty.
+var DefaultGCWindows = []int{65, 257}
+
+func (o Options) gcWindows() []int {
+	if len(o.GCWindows) == 0 {
+		return DefaultGCWindows
+	}
+	return o.GCWindows
+}
+
+// length of the k-mers used to calculate duplicity.
+const dupK = 3
+
+// refBases gives access to the reference sequence of a single chromosome.
+type refBases interface {
+	at(i int) (byte, error)
+	length() int
+}
+
+// refSeq holds a chunk of the reference sequence, fetching the next chunk
+// from the fasta as needed.
+type refSeq struct {
+	fai      *faidx.Faidx
+	chrom    string
+	clen     int
+	off      int
+	seq      string
+	lookback int
+}
+
+const refChunk = 1 << 16
+
+// newRefSeq returns a refSeq for chrom that keeps enough sequence behind the
+// current position for the largest of the window sizes.
+func newRefSeq(fai *faidx.Faidx, chrom string, clen int, sizes []int) *refSeq {
+	r := &refSeq{fai: fai, chrom: chrom, clen: clen}
+	for _, s := range sizes {
+		r.lookback = max(r.lookback, s)
+	}
+	return r
+}
+
+func (r *refSeq) length() int { return r.clen }
+
+func (r *refSeq) at(i int) (byte, error) {
+	if i < r.off || i >= r.off+len(r.seq) {
+		if i < 0 || i >= r.clen {
+			return 0, fmt.Errorf("bigly: position %d is outside of %s", i, r.chrom)
+		}
+		start := max(0, i-r.lookback)
+		s, err := r.fai.Get(r.chrom, start, min(r.clen, start+r.lookback+refChunk))
+		if err != nil {
+			return 0, err
+		}
+		r.off, r.seq = start, s
+	}
+	return r.seq[i-r.off], nil
+}
+
+// refWindow tracks the GC count and duplicity of the window of the reference
+// from pos-size/2 up to pos+size/2, the bounds of the faidx.FaPos that was used
+// before. The counts are updated as the window slides so each base is visited
+// twice, rather than once per position in the window.
+type refWindow struct {
+	half int
+	// current interval is [start, end)
+	start, end int
+	gc         int
+	// counts of each k-mer in the window and the sum of c*log(c) over those counts.
+	kmers [1 << (2 * dupK)]int
+	nk    int
+	clogc float64
+}
+
+func newRefWindows(sizes []int) []*refWindow {
+	ws := make([]*refWindow, len(sizes))
+	for i, s := range sizes {
+		ws[i] = &refWindow{half: s / 2}
+	}
+	return ws
+}
+
+var kmerCode = func() (t [256]int8) {
+	for i := range t {
+		t[i] = -1
+	}
+	for i, b := range []byte("ACGT") {
+		t[b] = int8(i)
+		t[b+'a'-'A'] = int8(i)
+	}
+	return t
+}()
+
+// kmer returns the index of the k-mer starting at i or -1 if it contains a non-ACGT base.
+func kmer(seq refBases, i int) (int, error) {
+	var k int
+	for j := i; j < i+dupK; j++ {
+		b, err := seq.at(j)
+		if err != nil {
+			return -1, err
+		}
+		c := kmerCode[b]
+		if c < 0 {
+			return -1, nil
+		}
+		k = k<<2 | int(c)
+	}
+	return k, nil
+}
+
+func xlogx(c int) float64 {
+	if c < 2 {
+		return 0
+	}
+	return float64(c) * math.Log(float64(c))
+}
+
+func (w *refWindow) count(k int, d int) {
+	if k < 0 {
+		return
+	}
+	c := w.kmers[k]
+	w.clogc += xlogx(c+d) - xlogx(c)
+	w.kmers[k] = c + d
+	w.nk += d
+}
+
+func isGC(b byte) bool {
+	return b == 'G' || b == 'C' || b == 'g' || b == 'c'
+}
+
+// move the window to be centered on pos, dropping the bases that leave it and
+// adding those that enter.
+func (w *refWindow) move(pos int, seq refBases) error {
+	start, end := max(0, pos-w.half), min(seq.length(), pos+w.half)
+	if start < w.start || start >= w.end {
+		// no overlap with the current window so start again.
+		*w = refWindow{half: w.half, start: start, end: start}
+	}
+	for ; w.start < start; w.start++ {
+		b, err := seq.at(w.start)
+		if err != nil {
+			return err
+		}
+		if isGC(b) {
+			w.gc--
+		}
+		if w.start+dupK <= w.end {
+			k, err := kmer(seq, w.start)
+			if err != nil {
+				return err
+			}
+			w.count(k, -1)
+		}
+	}
+	for ; w.end < end; w.end++ {
+		b, err := seq.at(w.end)
+		if err != nil {
+			return err
+		}
+		if isGC(b) {
+			w.gc++
+		}
+		if s := w.end - dupK + 1; s >= w.start {
+			k, err := kmer(seq, s)
+			if err != nil {
+				return err
+			}
+			w.count(k, 1)
+		}
+	}
+	return nil
+}
+
+// duplicity is a measure of the lack of sequence entropy in the window. It is 1 minus the
+// entropy of the k-mer distribution scaled by the maximum possible entropy; 0 means every
+// k-mer is different and 1 means the window is made of a single repeated k-mer.
+func (w *refWindow) duplicity() float32 {
+	if w.nk < 2 {
+		return 0
+	}
+	n := float64(w.nk)
+	h := math.Log(n) - w.clogc/n
+	hmax := math.Log(math.Min(n, float64(len(w.kmers))))
+	d := 1 - h/hmax
+	if d < 0 {
+		// avoid -0.00 from rounding.
+		d = 0
+	}
+	return float32(d)
+}
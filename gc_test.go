@@ -0,0 +1,176 @@
+package bigly
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brentp/faidx"
+	. "gopkg.in/check.v1"
+)
+
+type GCTest struct{}
+
+var _ = Suite(&GCTest{})
+
+type strBases string
+
+func (s strBases) at(i int) (byte, error) { return s[i], nil }
+func (s strBases) length() int            { return len(s) }
+
+// randomRef returns a sequence with soft-masked bases, Ns and a low-complexity stretch.
+func randomRef(n int) string {
+	r := rand.New(rand.NewSource(42))
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = "ACGTacgtN"[r.Intn(9)]
+	}
+	for i := n / 3; i < n/3+400 && i < n; i++ {
+		b[i] = "CA"[i%2]
+	}
+	return string(b)
+}
+
+// writeFasta writes seq as chrom to a fasta with a .fai index in dir and opens it.
+func writeFasta(dir, chrom, seq string) (*faidx.Faidx, error) {
+	const width = 60
+	path := filepath.Join(dir, "ref.fa")
+	var b strings.Builder
+	b.WriteString(">" + chrom + "\n")
+	for i := 0; i < len(seq); i += width {
+		b.WriteString(seq[i:min(len(seq), i+width)] + "\n")
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return nil, err
+	}
+	fai := fmt.Sprintf("%s\t%d\t%d\t%d\t%d\n", chrom, len(seq), len(chrom)+2, width, width+1)
+	if err := os.WriteFile(path+".fai", []byte(fai), 0644); err != nil {
+		return nil, err
+	}
+	return faidx.New(path)
+}
+
+// bruteWindow calculates the gc and duplicity of the window from scratch.
+func bruteWindow(seq string, pos, size int) (int, float32) {
+	w := &refWindow{half: size / 2}
+	start, end := max(0, pos-w.half), min(len(seq), pos+w.half)
+	for i := start; i < end; i++ {
+		if isGC(seq[i]) {
+			w.gc++
+		}
+		if i+dupK <= end {
+			k, _ := kmer(strBases(seq), i)
+			w.count(k, 1)
+		}
+	}
+	return w.gc, w.duplicity()
+}
+
+func (t *GCTest) TestSliding(c *C) {
+	seq := randomRef(3000)
+	r := rand.New(rand.NewSource(1))
+	for _, size := range []int{1, 4, 65, 257} {
+		w := newRefWindows([]int{size})[0]
+		for pos := 0; pos < len(seq); pos++ {
+			// skip some positions to check that the window can jump.
+			if pos%500 == 100 {
+				pos += 1 + r.Intn(size+10)
+			}
+			c.Assert(w.move(pos, strBases(seq)), IsNil)
+			gc, d := bruteWindow(seq, pos, size)
+			c.Assert(w.gc, Equals, gc, Commentf("size: %d pos: %d", size, pos))
+			c.Assert(math.Abs(float64(w.duplicity()-d)) < 1e-5, Equals, true, Commentf("size: %d pos: %d", size, pos))
+		}
+	}
+}
+
+func (t *GCTest) TestFaidx(c *C) {
+	seq := randomRef(3000)
+	fai, err := writeFasta(c.MkDir(), "chr1", seq)
+	c.Assert(err, IsNil)
+	sizes := []int{65, 257}
+	rs := newRefSeq(fai, "chr1", len(seq), sizes)
+	ws := newRefWindows(sizes)
+	fps := []*faidx.FaPos{{Chrom: "chr1"}, {Chrom: "chr1"}}
+	// the faidx windows are only compared where they are inside the chromosome.
+	for pos := 128; pos < len(seq)-128; pos++ {
+		if pos%1000 == 500 {
+			pos += 300
+		}
+		for i, w := range ws {
+			c.Assert(w.move(pos, rs), IsNil)
+			fps[i].Start, fps[i].End = pos-w.half, pos+w.half
+			gc, err := fai.Q(fps[i])
+			c.Assert(err, IsNil)
+			c.Assert(uint32(w.gc), Equals, gc, Commentf("size: %d pos: %d", sizes[i], pos))
+			c.Assert(math.Abs(float64(w.duplicity()-fps[i].Duplicity())) < 1e-5, Equals, true,
+				Commentf("size: %d pos: %d", sizes[i], pos))
+		}
+	}
+}
+
+func (t *GCTest) TestDuplicity(c *C) {
+	w := &refWindow{half: 32}
+	w.move(100, strBases(strings.Repeat("A", 300)))
+	c.Assert(w.gc, Equals, 0)
+	c.Assert(w.duplicity(), Equals, float32(1))
+
+	w = &refWindow{half: 32}
+	w.move(100, strBases(strings.Repeat("ACGTTGCAAGTC", 30)))
+	lo := w.duplicity()
+	w = &refWindow{half: 32}
+	w.move(100, strBases(strings.Repeat("CA", 150)))
+	c.Assert(w.duplicity() > lo, Equals, true)
+}
+
+func benchFasta(b *testing.B) (*faidx.Faidx, int) {
+	const n = 100000
+	fai, err := writeFasta(b.TempDir(), "chr1", randomRef(n))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return fai, n
+}
+
+// BenchmarkGCWindows slides the default windows along the reference. Like
+// BenchmarkGCWindowsQ, it stays away from the ends of the chromosome.
+func BenchmarkGCWindows(b *testing.B) {
+	fai, n := benchFasta(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rs := newRefSeq(fai, "chr1", n, DefaultGCWindows)
+		ws := newRefWindows(DefaultGCWindows)
+		for pos := 128; pos < n-128; pos++ {
+			for _, w := range ws {
+				if err := w.move(pos, rs); err != nil {
+					b.Fatal(err)
+				}
+				w.duplicity()
+			}
+		}
+	}
+}
+
+// BenchmarkGCWindowsQ calls faidx.Q and Duplicity for each window at each base as was done
+// before the windows slid.
+func BenchmarkGCWindowsQ(b *testing.B) {
+	fai, n := benchFasta(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fps := []*faidx.FaPos{{Chrom: "chr1"}, {Chrom: "chr1"}}
+		for pos := 128; pos < n-128; pos++ {
+			for j, fp := range fps {
+				half := DefaultGCWindows[j] / 2
+				fp.Start, fp.End = pos-half, pos+half
+				if _, err := fai.Q(fp); err != nil {
+					b.Fatal(err)
+				}
+				fp.Duplicity()
+			}
+		}
+	}
+}
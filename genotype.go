@@ -0,0 +1,357 @@
+package bigly
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/biogo/hts/sam"
+)
+
+// GenotypeOptions sets how reads are counted for the reference and the SV at each breakpoint.
+type GenotypeOptions struct {
+	// Slop is how far from a breakpoint a clip or the part of a split read can be.
+	Slop int
+	// Overlap is the number of aligned bases needed on each side of a breakpoint for a read
+	// that spans it to support the reference.
+	Overlap int
+	// PairWindow is how far from a breakpoint the reads of a pair can be. Pairs are not used for
+	// junctions that are closer than this on the reference.
+	PairWindow int
+	// MinReads is the number of informative reads below which a DEL or DUP of at least
+	// DepthLength bases is genotyped from depth instead.
+	MinReads    int
+	DepthLength int
+	// Flank is the largest number of bases on each side used for the flank depth.
+	Flank int
+	// ErrorRate is the chance that a read supports the wrong allele.
+	ErrorRate float64
+}
+
+// DefaultGenotypeOptions are used for any zero values in the GenotypeOptions.
+var DefaultGenotypeOptions = GenotypeOptions{Slop: 20, Overlap: 20, PairWindow: 1000, MinReads: 4,
+	DepthLength: 1000, Flank: 1000, ErrorRate: 0.05}
+
+// Genotype is the support for the reference and alternate alleles of an SV in a sample.
+type Genotype struct {
+	// Ref and Alt are the reads that support each allele.
+	Ref, Alt int
+	// GT is 0/0, 0/1, 1/1 or ./. if there is no support.
+	GT string
+	// GQ is the phred-scaled difference between the most likely genotype and the next.
+	GQ int
+}
+
+// GenotypeFormat is the FORMAT for Genotype.AppendFormat.
+const GenotypeFormat = "GT:GQ:AD"
+
+// GenotypeHeader has the FORMAT lines for GenotypeFormat.
+const GenotypeHeader = `##FORMAT=<ID=GT,Number=1,Type=String,Description="Genotype">
+##FORMAT=<ID=GQ,Number=1,Type=Integer,Description="Genotype quality">
+##FORMAT=<ID=AD,Number=R,Type=Integer,Description="Reads supporting the reference and alternate alleles">
+`
+
+// AppendFormat appends the GT:GQ:AD values to b.
+func (g *Genotype) AppendFormat(b []byte) []byte {
+	b = append(b, g.GT...)
+	b = strconv.AppendInt(append(b, ':'), int64(g.GQ), 10)
+	b = strconv.AppendInt(append(b, ':'), int64(g.Ref), 10)
+	return strconv.AppendInt(append(b, ','), int64(g.Alt), 10)
+}
+
+// CallGenotype returns the most likely genotype for ref and alt reads when each read supports
+// the wrong allele with probability errorRate.
+func CallGenotype(ref, alt int, errorRate float64) Genotype {
+	g := Genotype{Ref: ref, Alt: alt, GT: "./."}
+	if ref+alt == 0 {
+		return g
+	}
+	var pl [3]float64
+	for i, p := range [3]float64{errorRate, 0.5, 1 - errorRate} {
+		pl[i] = -10 * (float64(alt)*math.Log10(p) + float64(ref)*math.Log10(1-p))
+	}
+	best, next := 0, -1
+	for i := 1; i < 3; i++ {
+		if pl[i] < pl[best] {
+			best, next = i, best
+		} else if next < 0 || pl[i] < pl[next] {
+			next = i
+		}
+	}
+	g.GT = [3]string{"0/0", "0/1", "1/1"}[best]
+	g.GQ = int(math.Min(99, math.Round(pl[next]-pl[best])))
+	return g
+}
+
+// breakend is one side of a junction. boundary is between the last base to the left and the
+// first to the right. If left is true, the joined sequence is to the left of the boundary.
+type breakend struct {
+	chrom    string
+	boundary int
+	left     bool
+}
+
+// svJunction joins a to b. A single breakend has no b.chrom.
+type svJunction struct {
+	a, b breakend
+}
+
+// svJunctions returns the junctions of the SV or nil if it can't be genotyped.
+func svJunctions(sv *SV) []svJunction {
+	c, start, end := sv.Chrom, sv.Pos+1, sv.End+1
+	switch sv.Type {
+	case SVDel:
+		return []svJunction{{breakend{c, start, true}, breakend{c, end, false}}}
+	case SVDup:
+		return []svJunction{{breakend{c, end, true}, breakend{c, start, false}}}
+	case SVInv:
+		return []svJunction{{breakend{c, start, true}, breakend{c, end, true}},
+			{breakend{c, start, false}, breakend{c, end, false}}}
+	case SVBnd:
+		at := func(chrom string, pos int, strand byte) breakend {
+			if strand == '+' {
+				return breakend{chrom, pos + 1, true}
+			}
+			return breakend{chrom, pos, false}
+		}
+		j := svJunction{a: at(c, sv.Pos, sv.Strands[0])}
+		if sv.MateChrom != "" {
+			j.b = at(sv.MateChrom, sv.MatePos, sv.Strands[1])
+		}
+		return []svJunction{j}
+	}
+	return nil
+}
+
+// usePairs reports whether the sides of j are far enough apart on the reference that pairs
+// across it are not normal pairs.
+func (j svJunction) usePairs(window int) bool {
+	return j.b.chrom != "" && (j.a.chrom != j.b.chrom || abs(j.a.boundary-j.b.boundary) > window)
+}
+
+// Genotype counts the reads that support the reference and the SV at each of its breakpoints
+// and returns the most likely genotype. A read supports the SV if it is clipped at a breakpoint
+// with no SA or an SA at the other side, or if it is one of a pair that spans the junction.
+// It supports the reference if it is aligned across a breakpoint or is one of a normal pair
+// around it. A DEL or DUP of at least DepthLength with few informative reads is genotyped from
+// the depth in it relative to the flanks. SVs of other types or on a chromosome that is not in
+// the bam get ./.. The Iterator is moved so Seek must be called to continue elsewhere.
+func (it *Iterator) Genotype(sv *SV, o GenotypeOptions) (Genotype, error) {
+	o = o.withDefaults()
+	js := svJunctions(sv)
+	if js == nil {
+		return Genotype{GT: "./."}, nil
+	}
+	// there are no reads for a chromosome that is not in the bam.
+	if it.bamat != nil {
+		for _, j := range js {
+			for _, b := range []breakend{j.a, j.b} {
+				if b.chrom != "" && it.bamat.Refs[b.chrom] == nil {
+					return Genotype{GT: "./."}, nil
+				}
+			}
+		}
+	}
+	var recs []*sam.Record
+	w := max(o.PairWindow, o.Slop+o.Overlap)
+	for _, j := range js {
+		for _, b := range []breakend{j.a, j.b} {
+			if b.chrom == "" {
+				continue
+			}
+			err := it.eachRead(Position{Chrom: b.chrom, Start: max(b.boundary-w, 0), End: b.boundary + w},
+				func(r *sam.Record) { recs = append(recs, r) })
+			if err != nil {
+				return Genotype{}, err
+			}
+		}
+	}
+	ref, alt := genotypeReads(it.opts, o, js, recs)
+	if ref+alt < o.MinReads && (sv.Type == SVDel || sv.Type == SVDup) && sv.End-sv.Pos >= o.DepthLength {
+		var err error
+		if ref, alt, err = it.depthSupport(sv, o); err != nil {
+			return Genotype{}, err
+		}
+	}
+	return CallGenotype(ref, alt, o.ErrorRate), nil
+}
+
+func (o GenotypeOptions) withDefaults() GenotypeOptions {
+	d := DefaultGenotypeOptions
+	if o.Slop == 0 {
+		o.Slop = d.Slop
+	}
+	if o.Overlap == 0 {
+		o.Overlap = d.Overlap
+	}
+	if o.PairWindow == 0 {
+		o.PairWindow = d.PairWindow
+	}
+	if o.MinReads == 0 {
+		o.MinReads = d.MinReads
+	}
+	if o.DepthLength == 0 {
+		o.DepthLength = d.DepthLength
+	}
+	if o.Flank == 0 {
+		o.Flank = d.Flank
+	}
+	if o.ErrorRate == 0 {
+		o.ErrorRate = d.ErrorRate
+	}
+	return o
+}
+
+// genotypeReads returns the reads in recs that support the reference and the junctions. The
+// alternate reads are the mean over the junctions and the reference reads are the mean over the
+// breakpoints. Each read or pair is counted once for each.
+func genotypeReads(opts Options, o GenotypeOptions, js []svJunction, recs []*sam.Record) (ref, alt int) {
+	alts := make(map[string]bool)
+	altSum := 0
+	for _, j := range js {
+		names := make(map[string]bool)
+		pairs := j.usePairs(o.PairWindow)
+		for _, r := range recs {
+			if r.MapQ < opts.MinMappingQuality || r.Flags&(sam.Secondary|sam.Supplementary) != 0 {
+				continue
+			}
+			if supportsJunction(opts, o, r, j.a, j.b, pairs) || supportsJunction(opts, o, r, j.b, j.a, pairs) {
+				names[r.Name] = true
+				alts[r.Name] = true
+			}
+		}
+		altSum += len(names)
+	}
+
+	type point struct {
+		chrom    string
+		boundary int
+	}
+	var points []point
+	pairsAt := make(map[point]bool)
+	for _, j := range js {
+		for _, b := range []breakend{j.a, j.b} {
+			if b.chrom == "" {
+				continue
+			}
+			p := point{b.chrom, b.boundary}
+			if _, ok := pairsAt[p]; !ok {
+				points = append(points, p)
+			}
+			pairsAt[p] = pairsAt[p] || j.usePairs(o.PairWindow)
+		}
+	}
+	refSum := 0
+	for _, p := range points {
+		names := make(map[string]bool)
+		for _, r := range recs {
+			if r.MapQ < opts.MinMappingQuality || r.Flags&(sam.Secondary|sam.Supplementary) != 0 ||
+				alts[r.Name] || r.Ref.Name() != p.chrom {
+				continue
+			}
+			if spans(r, p.boundary, o.Overlap) || pairsAt[p] && normalPairAround(r, p.boundary, o.PairWindow) {
+				names[r.Name] = true
+			}
+		}
+		refSum += len(names)
+	}
+	if len(points) > 0 {
+		ref = int(math.Round(float64(refSum) / float64(len(points))))
+	}
+	return ref, int(math.Round(float64(altSum) / float64(len(js))))
+}
+
+// supportsJunction reports whether r is at a and supports its join to b.
+func supportsJunction(opts Options, o GenotypeOptions, r *sam.Record, a, b breakend, pairs bool) bool {
+	if r.Ref.Name() != a.chrom {
+		return false
+	}
+	before, after := clipLengths(r.Cigar)
+	minClip := max(opts.MinClipLength, 1)
+	clipped := a.left && after >= minClip && abs(r.End()-a.boundary) <= o.Slop ||
+		!a.left && before >= minClip && abs(r.Start()-a.boundary) <= o.Slop
+	if clipped {
+		tags, ok := r.Tag([]byte{'S', 'A'})
+		if !ok || b.chrom == "" {
+			return true
+		}
+		for _, sa := range ParseSAs(tags) {
+			if string(sa.Chrom) != b.chrom {
+				continue
+			}
+			if b.left && abs(sa.End()-b.boundary) <= o.Slop || !b.left && abs(sa.Pos-b.boundary) <= o.Slop {
+				return true
+			}
+		}
+		return false
+	}
+	if !pairs || r.Flags&sam.Paired == 0 || r.Flags&sam.MateUnmapped != 0 || r.MateRef == nil ||
+		r.MateRef.Name() != b.chrom || (r.Flags&sam.Reverse == 0) != a.left || (r.Flags&sam.MateReverse == 0) != b.left {
+		return false
+	}
+	// the read and its mate are on the joined sides of the breakpoints.
+	return sideOf(r.Start(), r.End(), a, o) && sideOf(r.MatePos, r.MatePos+r.Len(), b, o)
+}
+
+// sideOf reports whether [start, end) is on the joined side of b and within the PairWindow.
+func sideOf(start, end int, b breakend, o GenotypeOptions) bool {
+	if b.left {
+		return end <= b.boundary+o.Slop && start >= b.boundary-o.PairWindow
+	}
+	return start >= b.boundary-o.Slop && end <= b.boundary+o.PairWindow
+}
+
+// spans reports whether r is aligned across boundary with overlap bases on each side and no
+// deletion at it.
+func spans(r *sam.Record, boundary, overlap int) bool {
+	if r.Start() > boundary-overlap || r.End() < boundary+overlap {
+		return false
+	}
+	pos := r.Start()
+	for _, co := range r.Cigar {
+		n := co.Len() * co.Type().Consumes().Reference
+		if t := co.Type(); (t == sam.CigarDeletion || t == sam.CigarSkipped) && pos < boundary+1 && pos+n > boundary-1 {
+			return false
+		}
+		pos += n
+	}
+	return true
+}
+
+// normalPairAround reports whether r is the forward read of a normal pair with the mate after
+// boundary.
+func normalPairAround(r *sam.Record, boundary, window int) bool {
+	return r.Flags&sam.Paired != 0 && r.Flags&sam.MateUnmapped == 0 && r.MateRef != nil &&
+		r.MateRef.ID() == r.Ref.ID() && !oddOrientation(r) && r.Flags&sam.Reverse == 0 &&
+		r.End() <= boundary && r.MatePos >= boundary && r.MatePos-r.Start() <= window
+}
+
+// depthSupport returns the reference and alternate support for a DEL or DUP from the mean depth
+// in it and in its flanks.
+func (it *Iterator) depthSupport(sv *SV, o GenotypeOptions) (ref, alt int, err error) {
+	start, end := sv.Pos+1, sv.End+1
+	in, err := it.MeanDepth(Position{Chrom: sv.Chrom, Start: start, End: end})
+	if err != nil {
+		return 0, 0, err
+	}
+	f := min(end-start, o.Flank)
+	left, err := it.MeanDepth(Position{Chrom: sv.Chrom, Start: max(start-f, 0), End: start})
+	if err != nil {
+		return 0, 0, err
+	}
+	right, err := it.MeanDepth(Position{Chrom: sv.Chrom, Start: end, End: end + f})
+	if err != nil {
+		return 0, 0, err
+	}
+	ref, alt = depthAlleles(sv.Type, in, (left+right)/2)
+	return ref, alt, nil
+}
+
+// depthAlleles splits the depth into reads for each allele. Each copy of a deleted or duplicated
+// region has half of the flank depth.
+func depthAlleles(t SVType, in, flank float64) (ref, alt int) {
+	if t == SVDel {
+		return int(math.Round(in)), int(math.Round(math.Max(flank-in, 0)))
+	}
+	a := math.Max(in-flank, 0)
+	return int(math.Round(math.Max(flank-a, 0))), int(math.Round(a))
+}
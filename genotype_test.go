@@ -0,0 +1,130 @@
+package bigly_test
+
+import (
+	"path/filepath"
+	"strconv"
+
+	"github.com/biogo/hts/sam"
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type GenotypeTest struct{}
+
+var _ = Suite(&GenotypeTest{})
+
+func (t *GenotypeTest) TestCallGenotype(c *C) {
+	c.Assert(bigly.CallGenotype(0, 0, 0.05), Equals, bigly.Genotype{GT: "./."})
+	g := bigly.CallGenotype(20, 0, 0.05)
+	c.Assert(g.GT, Equals, "0/0")
+	c.Assert(g.GQ, Equals, 56)
+	c.Assert(bigly.CallGenotype(10, 9, 0.05).GT, Equals, "0/1")
+	g = bigly.CallGenotype(1, 30, 0.05)
+	c.Assert(g.GT, Equals, "1/1")
+	c.Assert(g.GQ, Equals, 74)
+	c.Assert(bigly.CallGenotype(0, 40, 0.05).GQ, Equals, 99)
+	c.Assert(string(g.AppendFormat(nil)), Equals, "1/1:74:1,30")
+}
+
+func (t *GenotypeTest) TestDepthAlleles(c *C) {
+	for _, v := range []struct {
+		t         bigly.SVType
+		in, flank float64
+		ref, alt  int
+	}{
+		{bigly.SVDel, 15, 30, 15, 15},
+		{bigly.SVDel, 0.4, 30, 0, 30},
+		{bigly.SVDel, 33, 30, 33, 0},
+		{bigly.SVDup, 45, 30, 15, 15},
+		{bigly.SVDup, 61, 30, 0, 31},
+		{bigly.SVDup, 29, 30, 30, 0},
+	} {
+		ref, alt := bigly.DepthAlleles(v.t, v.in, v.flank)
+		c.Assert([2]int{ref, alt}, Equals, [2]int{v.ref, v.alt}, Commentf("%v", v))
+	}
+}
+
+func (t *GenotypeTest) TestGenotypeReads(c *C) {
+	chr1, _ := sam.NewReference("chr1", "", "", 100000, nil, nil)
+	chr2, _ := sam.NewReference("chr2", "", "", 100000, nil, nil)
+	_, err := sam.NewHeader(nil, []*sam.Reference{chr1, chr2})
+	c.Assert(err, IsNil)
+	m := func(n int) sam.CigarOp { return sam.NewCigarOp(sam.CigarMatch, n) }
+	s := func(n int) sam.CigarOp { return sam.NewCigarOp(sam.CigarSoftClipped, n) }
+	sa := func(v string) []sam.Aux { return []sam.Aux{mustAux(sam.NewAux(sam.NewTag("SA"), v))} }
+	m100 := sam.Cigar{m(100)}
+	// a deletion of [1000, 3000).
+	recs := []*sam.Record{
+		// the pair spans the deletion.
+		{Name: "pair", Ref: chr1, Pos: 700, MapQ: 60, Cigar: m100, Flags: sam.Paired | sam.Read1 | sam.MateReverse, MateRef: chr1, MatePos: 3200},
+		// a normal pair around the first breakpoint.
+		{Name: "normal", Ref: chr1, Pos: 800, MapQ: 60, Cigar: m100, Flags: sam.Paired | sam.Read1 | sam.MateReverse, MateRef: chr1, MatePos: 1100},
+		// split across the deletion.
+		{Name: "split", Ref: chr1, Pos: 900, MapQ: 60, Cigar: sam.Cigar{m(100), s(50)}, AuxFields: sa("chr1,3001,+,100S50M,60,0;")},
+		// clipped at the deletion but with the rest elsewhere.
+		{Name: "elsewhere", Ref: chr1, Pos: 900, MapQ: 60, Cigar: sam.Cigar{m(100), s(50)}, AuxFields: sa("chr2,3001,+,100S50M,60,0;")},
+		// aligned across the first breakpoint.
+		{Name: "span1", Ref: chr1, Pos: 950, MapQ: 60, Cigar: m100},
+		// with a deletion at the breakpoint.
+		{Name: "indel", Ref: chr1, Pos: 950, MapQ: 60, Cigar: sam.Cigar{m(40), sam.NewCigarOp(sam.CigarDeletion, 10), m(60)}},
+		{Name: "lowmapq", Ref: chr1, Pos: 950, MapQ: 1, Cigar: m100},
+		{Name: "split", Ref: chr1, Pos: 3000, MapQ: 60, Cigar: sam.Cigar{s(100), m(50)}, Flags: sam.Supplementary},
+		// clipped without an SA.
+		{Name: "clip", Ref: chr1, Pos: 3000, MapQ: 60, Cigar: sam.Cigar{s(30), m(100)}},
+		{Name: "span2", Ref: chr1, Pos: 2960, MapQ: 60, Cigar: m100},
+		// too little on the left of the breakpoint.
+		{Name: "short", Ref: chr1, Pos: 2990, MapQ: 60, Cigar: m100},
+		{Name: "pair", Ref: chr1, Pos: 3200, MapQ: 60, Cigar: m100, Flags: sam.Paired | sam.Read2 | sam.Reverse, MateRef: chr1, MatePos: 700},
+	}
+	o := bigly.Options{MinMappingQuality: 5}
+	del := &bigly.SV{Chrom: "chr1", Pos: 999, End: 2999, Type: bigly.SVDel}
+	ref, alt := bigly.GenotypeReads(o, bigly.GenotypeOptions{}, del, recs)
+	// the mean of 2 and 1 reference reads at the breakpoints.
+	c.Assert([2]int{ref, alt}, Equals, [2]int{2, 3})
+
+	// a short deletion doesn't use pairs.
+	ref, alt = bigly.GenotypeReads(o, bigly.GenotypeOptions{PairWindow: 5000}, del, recs)
+	c.Assert([2]int{ref, alt}, Equals, [2]int{1, 2})
+
+	// the same join as a breakend.
+	bnd := &bigly.SV{Chrom: "chr1", Pos: 999, Type: bigly.SVBnd, MateChrom: "chr1", MatePos: 3000, Strands: [2]byte{'+', '-'}}
+	ref, alt = bigly.GenotypeReads(o, bigly.GenotypeOptions{}, bnd, recs)
+	c.Assert([2]int{ref, alt}, Equals, [2]int{2, 3})
+
+	// a duplication has no support here.
+	dup := &bigly.SV{Chrom: "chr1", Pos: 999, End: 2999, Type: bigly.SVDup}
+	ref, alt = bigly.GenotypeReads(o, bigly.GenotypeOptions{}, dup, recs)
+	c.Assert([2]int{ref, alt}, Equals, [2]int{2, 0})
+}
+
+func (t *GenotypeTest) TestIteratorGenotype(c *C) {
+	chr1, _ := sam.NewReference("chr1", "", "", 10000, nil, nil)
+	h, _ := sam.NewHeader(nil, []*sam.Reference{chr1})
+	var recs []*sam.Record
+	// reads aligned across both sides of a deletion of [1000, 3000) support the reference.
+	for _, pos := range []int{950, 951, 952, 953, 954, 2950, 2951, 2952, 2953, 2954} {
+		recs = append(recs, &sam.Record{Name: "r" + strconv.Itoa(pos), Ref: chr1, Pos: pos, MapQ: 60,
+			Cigar: sam.Cigar{sam.NewCigarOp(sam.CigarMatch, 100)}, Seq: sam.NewSeq(make([]byte, 100)), Qual: make([]byte, 100)})
+	}
+	path := filepath.Join(c.MkDir(), "genotype.bam")
+	c.Assert(bigly.WriteIndexedBam(path, h, recs), IsNil)
+	it := bigly.Up(path, bigly.Options{Fields: []string{"depth"}}, bigly.Position{Start: -1, End: -1}, nil)
+	c.Assert(it.Error(), IsNil)
+	defer it.Close()
+
+	g, err := it.Genotype(&bigly.SV{Chrom: "chr1", Pos: 999, End: 2999, Type: bigly.SVDel}, bigly.GenotypeOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(g.GT, Equals, "0/0")
+	// the reference reads are averaged over the breakpoints.
+	c.Assert(g.Ref, Equals, 5)
+
+	// chromosomes that are not in the bam get ./. rather than an error.
+	for _, sv := range []bigly.SV{
+		{Chrom: "chrUn", Pos: 999, End: 2999, Type: bigly.SVDel},
+		{Chrom: "chr1", Pos: 999, Type: bigly.SVBnd, MateChrom: "chrUn", MatePos: 10, Strands: [2]byte{'+', '-'}},
+	} {
+		g, err = it.Genotype(&sv, bigly.GenotypeOptions{})
+		c.Assert(err, IsNil)
+		c.Assert(g, Equals, bigly.Genotype{GT: "./."})
+	}
+}
@@ -0,0 +1,157 @@
+package bigly
+
+import (
+	"image"
+	"image/png"
+	"io"
+
+	"github.com/biogo/hts/sam"
+	"github.com/brentp/bigly/npy"
+)
+
+// The channels of a PileupImage.
+const (
+	// ChannelBase is 250, 30, 180 or 100 for A, C, G or T and 0 for other bases and deletions.
+	ChannelBase = iota
+	// ChannelBaseQuality is the base quality scaled from 0-40 to 0-254.
+	ChannelBaseQuality
+	// ChannelMappingQuality is the mapping quality scaled from 0-60 to 0-254.
+	ChannelMappingQuality
+	// ChannelStrand is 70 for the forward strand and 240 for the reverse.
+	ChannelStrand
+	// ChannelClip is 254 for bases next to a clip of at least Options.MinClipLength, 127 for
+	// other bases of a read with such a clip and 0 otherwise.
+	ChannelClip
+	// ChannelSA is 254 for reads with an SA tag.
+	ChannelSA
+	// ImageChannels is the number of channels.
+	ImageChannels
+)
+
+// PileupImage holds the reads around a site as rows of reads by columns of positions, with
+// ImageChannels values for each. Cells without a read are 0.
+type PileupImage struct {
+	Chrom string
+	// Start is the 0-based position of the first column.
+	Start  int
+	Width  int
+	Height int
+	// Data holds the value of channel k for row i and column j at (i*Width+j)*ImageChannels+k.
+	Data []uint8
+	// Reads is the number of reads in the window, which can be more than Height.
+	Reads int
+}
+
+var baseValues = func() (t [256]uint8) {
+	for b, v := range map[byte]uint8{'A': 250, 'C': 30, 'G': 180, 'T': 100} {
+		t[b], t[b+'a'-'A'] = v, v
+	}
+	return t
+}()
+
+func scale(v, max uint8) uint8 {
+	if v > max {
+		v = max
+	}
+	return uint8(int(v) * 254 / int(max))
+}
+
+func isClip(co sam.CigarOp, minLen int) bool {
+	t := co.Type()
+	return (t == sam.CigarSoftClipped || t == sam.CigarHardClipped) && co.Len() >= minLen
+}
+
+// Image returns the pileup image for the window of width bases centred on site (0-based) on
+// chrom. Rows are the reads that overlap the site and pass the Options, in order of their start.
+// When there are more than height, an evenly spaced subset of them is used.
+// The Iterator is moved to the site so Seek must be called to continue elsewhere.
+func (it *Iterator) Image(chrom string, site, width, height int) (*PileupImage, error) {
+	var recs []*sam.Record
+	if err := it.eachRead(Position{Chrom: chrom, Start: site, End: site + 1}, func(r *sam.Record) { recs = append(recs, r) }); err != nil {
+		return nil, err
+	}
+	return newPileupImage(it.opts, recs, chrom, site, width, height), nil
+}
+
+// newPileupImage returns the image of the reads in recs, which must be sorted by start, that
+// overlap site and pass the mapping-quality cutoff.
+func newPileupImage(o Options, recs []*sam.Record, chrom string, site, width, height int) *PileupImage {
+	start := max(site-width/2, 0)
+	im := &PileupImage{Chrom: chrom, Start: start, Width: width, Height: height,
+		Data: make([]uint8, width*height*ImageChannels)}
+	keep := recs[:0:0]
+	for _, r := range recs {
+		if r.Start() <= site && r.End() > site && r.MapQ >= o.MinMappingQuality {
+			keep = append(keep, r)
+		}
+	}
+	recs = keep
+	im.Reads = len(recs)
+	if len(recs) > height {
+		// downsample evenly rather than keep the reads that start first.
+		for i := 0; i < height; i++ {
+			recs[i] = recs[i*len(recs)/height]
+		}
+		recs = recs[:height]
+	}
+	var s CigarSummary
+	for i, rec := range recs {
+		// a new Align because the cursor of the cached one has moved past the window.
+		a := &Align{Record: rec}
+		row := im.Data[i*width*ImageChannels : (i+1)*width*ImageChannels]
+		var clipped, sa uint8
+		for _, co := range rec.Cigar {
+			if isClip(co, o.MinClipLength) {
+				clipped = 127
+			}
+		}
+		if _, ok := rec.Tag([]byte{'S', 'A'}); ok && rec.Flags&sam.Secondary == 0 {
+			sa = 254
+		}
+		strand := uint8(70)
+		if rec.Flags&sam.Reverse == sam.Reverse {
+			strand = 240
+		}
+		mapq := rec.MapQ
+		if mapq == 255 {
+			mapq = 0
+		}
+		for j := max(rec.Start()-start, 0); j < width && start+j < rec.End(); j++ {
+			if !a.at(start+j, &s) {
+				continue
+			}
+			px := row[j*ImageChannels : (j+1)*ImageChannels]
+			px[ChannelBase] = baseValues[s.Base]
+			if s.Qual != 0xff {
+				px[ChannelBaseQuality] = scale(s.Qual, 40)
+			}
+			px[ChannelMappingQuality] = scale(mapq, 60)
+			px[ChannelStrand] = strand
+			px[ChannelClip] = clipped
+			if isClip(s.Left, o.MinClipLength) || isClip(s.Right, o.MinClipLength) {
+				px[ChannelClip] = 254
+			}
+			px[ChannelSA] = sa
+		}
+	}
+	return im
+}
+
+// WriteNpy writes the image as a uint8 array of shape (Height, Width, ImageChannels).
+func (im *PileupImage) WriteNpy(w io.Writer) error {
+	return npy.WriteUint8(w, im.Data, im.Height, im.Width, ImageChannels)
+}
+
+// WritePNG writes the image as a grayscale PNG with the channels stacked from top to bottom.
+func (im *PileupImage) WritePNG(w io.Writer) error {
+	g := image.NewGray(image.Rect(0, 0, im.Width, im.Height*ImageChannels))
+	for k := 0; k < ImageChannels; k++ {
+		for i := 0; i < im.Height; i++ {
+			row := g.Pix[(k*im.Height+i)*g.Stride:]
+			for j := 0; j < im.Width; j++ {
+				row[j] = im.Data[(i*im.Width+j)*ImageChannels+k]
+			}
+		}
+	}
+	return png.Encode(w, g)
+}
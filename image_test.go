@@ -0,0 +1,87 @@
+package bigly_test
+
+import (
+	"bytes"
+	"image/png"
+	"path/filepath"
+	"strconv"
+
+	"github.com/biogo/hts/sam"
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type ImageTest struct{}
+
+var _ = Suite(&ImageTest{})
+
+func (t *ImageTest) TestImage(c *C) {
+	im := bigly.PileupImageOf(bigly.Options{}, precords, "ref", 10, 10, 4)
+	// r004 does not overlap the site.
+	c.Assert(im.Reads, Equals, 3)
+	c.Assert(im.Data, HasLen, 4*10*bigly.ImageChannels)
+	px := func(i, j int) []uint8 {
+		o := (i*im.Width + j) * bigly.ImageChannels
+		return im.Data[o : o+bigly.ImageChannels]
+	}
+	// r001 starts at 6.
+	c.Assert(px(0, 0), DeepEquals, []uint8{0, 0, 0, 0, 0, 0})
+	c.Assert(px(0, 1), DeepEquals, []uint8{100, 0, 127, 70, 0, 0})
+	// r003 is soft-clipped and has an SA tag.
+	c.Assert(px(2, 3), DeepEquals, []uint8{250, 0, 127, 70, 254, 254})
+	c.Assert(px(2, 4), DeepEquals, []uint8{180, 0, 127, 70, 127, 254})
+	// the last row is empty.
+	c.Assert(bytes.Count(im.Data[3*10*bigly.ImageChannels:], []byte{0}), Equals, 10*bigly.ImageChannels)
+
+	im = bigly.PileupImageOf(bigly.Options{}, []*sam.Record{precords[0], precords[1]}, "ref", 10, 10, 1)
+	c.Assert(im.Reads, Equals, 2)
+	c.Assert(im.Data, HasLen, 10*bigly.ImageChannels)
+
+	var buf bytes.Buffer
+	c.Assert(im.WritePNG(&buf), IsNil)
+	img, err := png.Decode(&buf)
+	c.Assert(err, IsNil)
+	c.Assert(img.Bounds().Dx(), Equals, 10)
+	c.Assert(img.Bounds().Dy(), Equals, bigly.ImageChannels)
+
+	buf.Reset()
+	c.Assert(im.WriteNpy(&buf), IsNil)
+	c.Assert(bytes.Contains(buf.Bytes(), []byte("'shape': (1, 10, 6)")), Equals, true)
+}
+
+func (t *ImageTest) TestIteratorImage(c *C) {
+	ref, _ := sam.NewReference("ref", "", "", 100, nil, nil)
+	h, _ := sam.NewHeader(nil, []*sam.Reference{ref})
+	var recs []*sam.Record
+	// 10bp reads starting at 30-55; those starting at 41-50 overlap the site at 50.
+	for pos := 30; pos <= 55; pos++ {
+		recs = append(recs, &sam.Record{Name: "r" + strconv.Itoa(pos), Ref: ref, Pos: pos, MapQ: 60,
+			Cigar: []sam.CigarOp{sam.NewCigarOp(sam.CigarMatch, 10)},
+			Seq:   sam.NewSeq([]byte("ACGTACGTAC")), Qual: []byte{30, 30, 30, 30, 30, 30, 30, 30, 30, 30}})
+	}
+	path := filepath.Join(c.MkDir(), "image.bam")
+	c.Assert(bigly.WriteIndexedBam(path, h, recs), IsNil)
+	it := bigly.Up(path, bigly.Options{}, bigly.Position{Chrom: "ref", Start: 0, End: 100}, nil)
+	c.Assert(it.Error(), IsNil)
+	defer it.Close()
+
+	im, err := it.Image("ref", 50, 30, 4)
+	c.Assert(err, IsNil)
+	c.Assert(im.Start, Equals, 35)
+	c.Assert(im.Reads, Equals, 10)
+	// the rows are spread over the reads at the site.
+	for i, start := range []int{41, 43, 46, 48} {
+		row := im.Data[i*im.Width*bigly.ImageChannels : (i+1)*im.Width*bigly.ImageChannels]
+		var first int
+		for first < im.Width && row[first*bigly.ImageChannels] == 0 {
+			first++
+		}
+		c.Assert(im.Start+first, Equals, start, Commentf("row: %d", i))
+	}
+	c.Assert(it.Next(), Equals, false)
+
+	// the iterator can be moved on with Seek.
+	c.Assert(it.Seek(bigly.Position{Chrom: "ref", Start: 50, End: 51}), IsNil)
+	c.Assert(it.Next(), Equals, true)
+	c.Assert(it.Pile().Depth, Equals, 10)
+}
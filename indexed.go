@@ -0,0 +1,117 @@
+package bigly
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/brentp/bigly/tabix"
+)
+
+// IndexedWriter writes piles as BGZF-compressed TSV with a header and a tabix index.
+type IndexedWriter struct {
+	path string
+	fh   *os.File
+	tw   *tabix.Writer
+	opts Options
+	buf  []byte
+}
+
+// NewIndexedWriter creates a BGZF-compressed TSV at path. The index is written to path + ".tbi"
+// by Close. The chrom and pos fields must be in the output and the piles must be written in order.
+func NewIndexedWriter(path string, opts Options) (*IndexedWriter, error) {
+	if err := opts.Prepare(); err != nil {
+		return nil, err
+	}
+	seq, beg := -1, -1
+	for i, c := range opts.cols {
+		switch c.Name {
+		case "chrom":
+			seq = i + 1
+		case "pos":
+			beg = i + 1
+		}
+	}
+	if seq < 0 || beg < 0 {
+		return nil, fmt.Errorf("bigly: indexed output must include the chrom and pos fields")
+	}
+	fh, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &IndexedWriter{path: path, fh: fh, opts: opts, tw: tabix.NewWriter(fh, tabix.Conf{Seq: seq, Begin: beg, Meta: '#'})}
+	if err = w.tw.WriteMeta([]byte(opts.Header())); err != nil {
+		fh.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write writes the pile.
+func (w *IndexedWriter) Write(p *Pile) error {
+	w.buf = p.AppendTab(w.buf[:0], w.opts)
+	return w.tw.Write(w.buf)
+}
+
+// Close finishes the file and writes the index.
+func (w *IndexedWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		w.fh.Close()
+		return err
+	}
+	if err := w.fh.Close(); err != nil {
+		return err
+	}
+	fi, err := os.Create(w.path + ".tbi")
+	if err != nil {
+		return err
+	}
+	if _, err = w.tw.Index().WriteTo(fi); err != nil {
+		fi.Close()
+		return err
+	}
+	return fi.Close()
+}
+
+// IndexedReader reads the piles in a region from a file written by IndexedWriter.
+type IndexedReader struct {
+	tr   *tabix.Reader
+	hdr  []byte
+	opts Options
+}
+
+// OpenIndexed opens a file written by IndexedWriter, or any tabix-indexed bigly TSV.
+// opts are used as for NewReader.
+func OpenIndexed(path string, opts Options) (*IndexedReader, error) {
+	if err := opts.Prepare(); err != nil {
+		return nil, err
+	}
+	tr, err := tabix.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	hdr, err := tr.Header()
+	if err != nil {
+		tr.Close()
+		return nil, err
+	}
+	return &IndexedReader{tr: tr, hdr: hdr, opts: opts}, nil
+}
+
+// Query returns a Reader of the piles in pos. If pos.End <= 0, it reads to the end of the chromosome.
+// Only one Reader from a query can be used at a time.
+func (r *IndexedReader) Query(pos Position) (*Reader, error) {
+	if pos.End <= 0 {
+		pos.End = math.MaxInt32
+	}
+	var rdr io.Reader = r.tr.Query(pos.Chrom, max(0, pos.Start), pos.End)
+	if len(r.hdr) > 0 {
+		rdr = io.MultiReader(bytes.NewReader(r.hdr), rdr)
+	}
+	return NewReader(rdr, r.opts)
+}
+
+// Close closes the file.
+func (r *IndexedReader) Close() error { return r.tr.Close() }
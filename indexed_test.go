@@ -0,0 +1,62 @@
+package bigly_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type IndexedTest struct{}
+
+var _ = Suite(&IndexedTest{})
+
+func (t *IndexedTest) TestRoundTrip(c *C) {
+	dir, err := ioutil.TempDir("", "bigly")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "t.bigly.gz")
+
+	o := bigly.Options{SplitterVerbosity: 2}
+	w, err := bigly.NewIndexedWriter(path, o)
+	c.Assert(err, IsNil)
+	var lines []string
+	for _, chrom := range []string{"chr1", "chr2"} {
+		for i := 0; i < 5000; i++ {
+			p := tpile.Clone()
+			p.Chrom, p.Pos, p.Depth = chrom, 3*i, i
+			c.Assert(w.Write(p), IsNil)
+			lines = append(lines, p.TabString(o))
+		}
+	}
+	c.Assert(w.Close(), IsNil)
+
+	r, err := bigly.OpenIndexed(path, bigly.Options{})
+	c.Assert(err, IsNil)
+	defer r.Close()
+	// 0-based positions 3000 to 3010 hold piles at 3000, 3003, 3006 and 3009.
+	for k := 0; k < 2; k++ {
+		q, err := r.Query(bigly.Position{Chrom: "chr2", Start: 3000, End: 3010})
+		c.Assert(err, IsNil)
+		var got []string
+		for q.Next() {
+			got = append(got, q.Pile().TabString(o))
+		}
+		c.Assert(q.Error(), IsNil)
+		c.Assert(got, DeepEquals, lines[6000:6004])
+	}
+
+	// to the end of the chromosome: 14991, 14994 and 14997.
+	q, err := r.Query(bigly.Position{Chrom: "chr1", Start: 14990})
+	c.Assert(err, IsNil)
+	var n int
+	for q.Next() {
+		n++
+	}
+	c.Assert(n, Equals, 3)
+
+	_, err = bigly.NewIndexedWriter(path, bigly.Options{Fields: []string{"depth"}})
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,168 @@
+package bigly
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// InversionOptions sets how inversions are found from Links.
+type InversionOptions struct {
+	// Slop is the distance used to cluster the ends of pairs and to match splitters to a breakpoint.
+	Slop int
+	// MaxDistance is the largest distance between the +/+ and -/- clusters at each breakpoint.
+	MaxDistance int
+	// MinPairs is the number of pairs needed in each of the +/+ and -/- clusters.
+	MinPairs int
+}
+
+// DefaultInversionOptions are used for any zero values in the InversionOptions.
+var DefaultInversionOptions = InversionOptions{Slop: 200, MaxDistance: 1000, MinPairs: 2}
+
+// InversionSide is the support for one of the junctions of an inversion. The +/+ junction joins
+// the sequence before the first breakpoint to the reverse of the sequence before the second.
+// The -/- junction joins the sequence after the first to the reverse of the sequence after the second.
+type InversionSide struct {
+	Pairs, Splits int
+}
+
+// Inversion is an inversion found from a +/+ and a -/- cluster of pairs.
+type Inversion struct {
+	Chrom string
+	// Start and End are the 0-based, half-open inverted bases.
+	Start, End int
+	// CIStart and CIEnd are the confidence intervals around Start and End. They are 0 for a
+	// breakpoint that was set from splitters.
+	CIStart, CIEnd [2]int
+	PlusPlus       InversionSide
+	MinusMinus     InversionSide
+}
+
+// Precise reports whether both breakpoints were set from splitters.
+func (inv *Inversion) Precise() bool {
+	return inv.CIStart == [2]int{} && inv.CIEnd == [2]int{}
+}
+
+// Inversions pairs the +/+ and -/- clusters of pairs in links to find inversions. Split reads
+// with the SA on the other strand from the read set the breakpoints when they agree with the pairs.
+// Inversions are sorted by chromosome and Start.
+func Inversions(links []Link, o InversionOptions) []Inversion {
+	d := DefaultInversionOptions
+	if o.Slop == 0 {
+		o.Slop = d.Slop
+	}
+	if o.MaxDistance == 0 {
+		o.MaxDistance = d.MaxDistance
+	}
+	if o.MinPairs == 0 {
+		o.MinPairs = d.MinPairs
+	}
+	var pairs, splits []Link
+	for _, l := range links {
+		if l.A.Chrom != l.B.Chrom {
+			continue
+		}
+		switch {
+		case l.Type == LinkPair && l.A.Strand == l.B.Strand:
+			pairs = append(pairs, l)
+		case l.Type == LinkSplit && l.A.Strand != l.B.Strand && l.AEnd == l.BEnd:
+			splits = append(splits, l.ordered())
+		}
+	}
+	var pp, mm []LinkCluster
+	for _, c := range ClusterLinks(pairs, o.Slop) {
+		if c.Pairs < o.MinPairs {
+			continue
+		}
+		if c.A.Strand {
+			pp = append(pp, c)
+		} else {
+			mm = append(mm, c)
+		}
+	}
+
+	var invs []Inversion
+	used := make([]bool, len(mm))
+	for _, p := range pp {
+		best := -1
+		for i, m := range mm {
+			// the -/- reads are after each breakpoint and the +/+ reads are before it.
+			if used[i] || m.A.Chrom != p.A.Chrom || abs(m.A.Start-p.A.End) > o.MaxDistance ||
+				abs(m.B.Start-p.B.End) > o.MaxDistance {
+				continue
+			}
+			if best < 0 || m.Pairs > mm[best].Pairs {
+				best = i
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		used[best] = true
+		m := mm[best]
+		inv := Inversion{Chrom: p.A.Chrom, PlusPlus: InversionSide{Pairs: p.Pairs}, MinusMinus: InversionSide{Pairs: m.Pairs}}
+		lo1, hi1 := min(p.A.End, m.A.Start), max(p.A.End, m.A.Start)
+		lo2, hi2 := min(p.B.End, m.B.Start), max(p.B.End, m.B.Start)
+		// a splitter through the +/+ junction is joined at the ends of both parts and one through the
+		// -/- junction at the starts.
+		var ends1, ends2 []int
+		for _, s := range splits {
+			if s.A.Chrom != inv.Chrom {
+				continue
+			}
+			if s.AEnd && within(s.A.End, lo1, hi1, o.Slop) && within(s.B.End, lo2, hi2, o.Slop) {
+				inv.PlusPlus.Splits++
+				ends1, ends2 = append(ends1, s.A.End), append(ends2, s.B.End)
+			} else if !s.AEnd && within(s.A.Start, lo1, hi1, o.Slop) && within(s.B.Start, lo2, hi2, o.Slop) {
+				inv.MinusMinus.Splits++
+				ends1, ends2 = append(ends1, s.A.Start), append(ends2, s.B.Start)
+			}
+		}
+		if len(ends1) > 0 {
+			inv.Start, inv.End = medianInt(ends1), medianInt(ends2)
+		} else {
+			inv.Start, inv.End = (lo1+hi1)/2, (lo2+hi2)/2
+			inv.CIStart = [2]int{lo1 - inv.Start, hi1 - inv.Start}
+			inv.CIEnd = [2]int{lo2 - inv.End, hi2 - inv.End}
+		}
+		invs = append(invs, inv)
+	}
+	sort.Slice(invs, func(i, j int) bool {
+		if invs[i].Chrom != invs[j].Chrom {
+			return invs[i].Chrom < invs[j].Chrom
+		}
+		return invs[i].Start < invs[j].Start
+	})
+	return invs
+}
+
+func within(v, lo, hi, slop int) bool {
+	return v >= lo-slop && v <= hi+slop
+}
+
+func medianInt(xs []int) int {
+	s := append([]int(nil), xs...)
+	sort.Ints(s)
+	return s[len(s)/2]
+}
+
+// SV returns the inversion as an INV for the VCFWriter.
+func (inv *Inversion) SV() SV {
+	return SV{Chrom: inv.Chrom, Pos: inv.Start - 1, End: inv.End - 1, Type: SVInv, CIPos: inv.CIStart, CIEnd: inv.CIEnd,
+		SR: inv.PlusPlus.Splits + inv.MinusMinus.Splits, PE: inv.PlusPlus.Pairs + inv.MinusMinus.Pairs,
+		Qual:       float64(inv.PlusPlus.Splits + inv.MinusMinus.Splits + inv.PlusPlus.Pairs + inv.MinusMinus.Pairs),
+		DepthRatio: math.NaN()}
+}
+
+// InversionHeader is the header for Inversion.AppendTab.
+const InversionHeader = "#chrom\tstart\tend\tlength\tpluspluspairs\tplusplussplits\tminusminuspairs\tminusminussplits\tprecise"
+
+// AppendTab appends the tab-delimited inversion to b. Start and End are 0-based, half-open.
+func (inv *Inversion) AppendTab(b []byte) []byte {
+	b = append(b, inv.Chrom...)
+	for _, v := range []int{inv.Start, inv.End, inv.End - inv.Start, inv.PlusPlus.Pairs, inv.PlusPlus.Splits,
+		inv.MinusMinus.Pairs, inv.MinusMinus.Splits} {
+		b = strconv.AppendInt(append(b, '\t'), int64(v), 10)
+	}
+	return strconv.AppendBool(append(b, '\t'), inv.Precise())
+}
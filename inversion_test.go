@@ -0,0 +1,79 @@
+package bigly_test
+
+import (
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type InversionTest struct{}
+
+var _ = Suite(&InversionTest{})
+
+func link(t bigly.LinkType, astart int, astrand bool, bstart int, bstrand bool) bigly.Link {
+	return bigly.Link{Type: t,
+		A: bigly.Position{Chrom: "chr1", Start: astart, End: astart + 100, Strand: astrand},
+		B: bigly.Position{Chrom: "chr1", Start: bstart, End: bstart + 100, Strand: bstrand}}
+}
+
+func split(astart int, astrand, aend bool, bstart int, bstrand, bend bool) bigly.Link {
+	l := link(bigly.LinkSplit, astart, astrand, bstart, bstrand)
+	l.AEnd, l.BEnd = aend, bend
+	return l
+}
+
+// invLinks returns the pairs for an inversion of [10000, 12000).
+func invLinks() []bigly.Link {
+	var links []bigly.Link
+	for i := 0; i < 3; i++ {
+		// +/+ reads before each breakpoint.
+		links = append(links, link(bigly.LinkPair, 9700+50*i, true, 11700+50*i, true))
+		// -/- reads after each breakpoint, found from the mate.
+		links = append(links, link(bigly.LinkPair, 12100+50*i, false, 10100+50*i, false))
+	}
+	// a +/+ cluster without a -/- cluster.
+	links = append(links, link(bigly.LinkPair, 50000, true, 60000, true), link(bigly.LinkPair, 50010, true, 60010, true))
+	return links
+}
+
+func (t *InversionTest) TestPrecise(c *C) {
+	links := append(invLinks(),
+		// through the +/+ junction, from the read in the inversion.
+		split(11900, false, true, 9900, true, true),
+		split(9890, true, true, 11890, false, true),
+		// through the -/- junction.
+		split(10000, true, false, 12000, false, false),
+		// same strand so not an inversion.
+		split(10000, true, false, 12000, true, false),
+		// joined at the end of one part and the start of the other.
+		split(9900, true, true, 12000, false, false))
+	invs := bigly.Inversions(links, bigly.InversionOptions{})
+	c.Assert(invs, HasLen, 1)
+	inv := invs[0]
+	c.Assert(inv.Start, Equals, 10000)
+	c.Assert(inv.End, Equals, 12000)
+	c.Assert(inv.Precise(), Equals, true)
+	c.Assert(inv.PlusPlus, Equals, bigly.InversionSide{Pairs: 3, Splits: 2})
+	c.Assert(inv.MinusMinus, Equals, bigly.InversionSide{Pairs: 3, Splits: 1})
+	c.Assert(string(inv.AppendTab(nil)), Equals, "chr1\t10000\t12000\t2000\t3\t2\t3\t1\ttrue")
+
+	sv := inv.SV()
+	c.Assert(sv.Type, Equals, bigly.SVInv)
+	c.Assert(sv.Pos, Equals, 9999)
+	c.Assert(sv.End, Equals, 11999)
+	c.Assert(sv.SR, Equals, 3)
+	c.Assert(sv.PE, Equals, 6)
+}
+
+func (t *InversionTest) TestImprecise(c *C) {
+	invs := bigly.Inversions(invLinks(), bigly.InversionOptions{})
+	c.Assert(invs, HasLen, 1)
+	inv := invs[0]
+	c.Assert(inv.Precise(), Equals, false)
+	// half-way between the +/+ and -/- reads.
+	c.Assert(inv.Start, Equals, 10000)
+	c.Assert(inv.CIStart, Equals, [2]int{-100, 100})
+	c.Assert(inv.End, Equals, 12000)
+	c.Assert(inv.CIEnd, Equals, [2]int{-100, 100})
+
+	c.Assert(bigly.Inversions(invLinks(), bigly.InversionOptions{MinPairs: 4}), HasLen, 0)
+}
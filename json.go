@@ -0,0 +1,208 @@
+package bigly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// appendJSONString appends s as a quoted JSON string.
+func appendJSONString(b []byte, s []byte) []byte {
+	q, _ := json.Marshal(string(s))
+	return append(b, q...)
+}
+
+// AppendJSON appends the JSON value of the column for p to b.
+func (c Column) AppendJSON(b []byte, p *Pile, o Options) []byte {
+	if c.appendJSON != nil {
+		return c.appendJSON(b, p)
+	}
+	if c.Type == "string" {
+		return appendJSONString(b, c.format(nil, p, o))
+	}
+	if c.Type == "float" {
+		if v := c.format(nil, p, o); bytes.Equal(v, []byte("NaN")) || bytes.Contains(v, []byte("Inf")) {
+			return append(b, "null"...)
+		}
+	}
+	return c.format(b, p, o)
+}
+
+// setJSON sets the field in p from the JSON value written by AppendJSON.
+func (c Column) setJSON(p *Pile, raw []byte) error {
+	if c.parseJSON != nil {
+		return c.parseJSON(p, raw)
+	}
+	if c.parse == nil || bytes.Equal(raw, []byte("null")) {
+		return nil
+	}
+	if c.Type == "string" {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		return c.parse(p, s)
+	}
+	return c.parse(p, string(raw))
+}
+
+func splittersJSON(b []byte, p *Pile) []byte {
+	if p.splitterSummary != "" {
+		return appendJSONString(b, []byte(p.splitterSummary))
+	}
+	if len(p.SplitterPositions) == 0 {
+		return append(b, "[]"...)
+	}
+	v, _ := json.Marshal(p.SplitterPositions)
+	return append(b, v...)
+}
+
+func parseSplittersJSON(p *Pile, raw []byte) error {
+	p.SplitterPositions, p.splitterSummary, p.splitterOpposite = p.SplitterPositions[:0], "", p.splitterOpposite[:0]
+	if len(raw) > 0 && raw[0] == '"' {
+		return json.Unmarshal(raw, &p.splitterSummary)
+	}
+	return json.Unmarshal(raw, &p.SplitterPositions)
+}
+
+func basesJSON(b []byte, p *Pile) []byte {
+	b = append(b, '[')
+	for i, base := range p.Bases {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, '"', base, '"')
+	}
+	return append(b, ']')
+}
+
+func parseBasesJSON(p *Pile, raw []byte) error {
+	var bases []string
+	if err := json.Unmarshal(raw, &bases); err != nil {
+		return err
+	}
+	p.Bases = p.Bases[:0]
+	for _, b := range bases {
+		if len(b) != 1 {
+			return fmt.Errorf("bigly: bad base: %q", b)
+		}
+		p.Bases = append(p.Bases, b[0])
+	}
+	return nil
+}
+
+func qualsJSON(b []byte, p *Pile) []byte {
+	b = append(b, '[')
+	for i, q := range p.Quals {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendUint(b, uint32(q))
+	}
+	return append(b, ']')
+}
+
+func parseQualsJSON(p *Pile, raw []byte) error {
+	var quals []int
+	if err := json.Unmarshal(raw, &quals); err != nil {
+		return err
+	}
+	p.Quals = p.Quals[:0]
+	for _, q := range quals {
+		if q < 0 || q > math.MaxUint8 {
+			return fmt.Errorf("bigly: bad base quality: %d", q)
+		}
+		p.Quals = append(p.Quals, uint8(q))
+	}
+	return nil
+}
+
+// jsonColumns returns the output columns along with bases and quals if Options.IncludeBases is set.
+func (o Options) jsonColumns() []Column {
+	cols := o.Columns()
+	if !o.IncludeBases {
+		return cols
+	}
+	has := make(map[string]bool)
+	for _, c := range cols {
+		has[c.Name] = true
+	}
+	for _, c := range extraColumns {
+		if c.work == workBases && !has[c.Name] {
+			cols = append(cols[:len(cols):len(cols)], c)
+		}
+	}
+	return cols
+}
+
+// AppendJSON appends the Pile to b as a JSON object with a key for each column in o.
+// SplitterPositions are an array of {chrom, start, end, strand} with 0-based, half-open
+// positions, or the summary string for piles read from SplitterVerbosity 1 output, and, with Options.IncludeBases, bases and quals are arrays.
+func (p *Pile) AppendJSON(b []byte, o Options) []byte {
+	b = append(b, '{')
+	for i, c := range o.jsonColumns() {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, '"')
+		b = append(b, c.Name...)
+		b = append(b, '"', ':')
+		b = c.AppendJSON(b, p, o)
+	}
+	return append(b, '}')
+}
+
+// JSONString returns the Pile as a JSON object; see AppendJSON. Unknown fields in the Options
+// are left out.
+func (p Pile) JSONString(o Options) string {
+	o.prepare()
+	return string(p.AppendJSON(make([]byte, 0, 256), o))
+}
+
+// MarshalJSON implements json.Marshaler. It outputs every column with the default GC windows.
+// Use AppendJSON to choose the columns.
+func (p Pile) MarshalJSON() ([]byte, error) {
+	o := Options{SplitterVerbosity: 2}
+	for _, c := range o.AllColumns() {
+		o.Fields = append(o.Fields, c.Name)
+	}
+	if err := o.Prepare(); err != nil {
+		return nil, err
+	}
+	return p.AppendJSON(nil, o), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler for the objects from AppendJSON and MarshalJSON.
+// The GC windows are taken from the names of the gc and duplicity keys.
+func (p *Pile) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if t, err := dec.Token(); err != nil {
+		return err
+	} else if t != json.Delim('{') {
+		return fmt.Errorf("bigly: expected a JSON object for a Pile")
+	}
+	var names []string
+	var values []json.RawMessage
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err != nil {
+			return err
+		}
+		names = append(names, t.(string))
+		values = append(values, raw)
+	}
+	o, err := namedOptions(names)
+	if err != nil {
+		return err
+	}
+	p.Reset()
+	if err = setColumns(p, o.cols, func(c Column, i int) error { return c.setJSON(p, values[i]) }); err != nil {
+		return fmt.Errorf("bigly: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package bigly_test
+
+import (
+	"encoding/json"
+
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type JSONTest struct{}
+
+var _ = Suite(&JSONTest{})
+
+func (t *JSONTest) TestAppendJSON(c *C) {
+	o := bigly.Options{Fields: []string{"chrom,pos,refbase,discordantchromentropy,gc257,splitterpositions"}}
+	c.Assert(o.Prepare(), IsNil)
+	c.Assert(tpile.JSONString(o), Equals, `{"chrom":"chr1","pos":100,"refbase":"A","discordantchromentropy":0.25,"gc257":120,`+
+		`"splitterpositions":[{"chrom":"chr2","start":10,"end":20,"strand":false},{"chrom":"chr2","start":10,"end":30,"strand":false}]}`)
+
+	o = bigly.Options{Fields: []string{"depth", "quals"}, IncludeBases: true}
+	c.Assert(o.Prepare(), IsNil)
+	c.Assert(tpile.JSONString(o), Equals, `{"depth":20,"quals":[30,31,32,33],"bases":["A","C","G","T"]}`)
+
+	var p bigly.Pile
+	c.Assert(o.Prepare(), IsNil)
+	c.Assert(p.JSONString(o), Equals, `{"depth":0,"quals":[],"bases":[]}`)
+}
+
+func (t *JSONTest) TestRoundTrip(c *C) {
+	b, err := json.Marshal(tpile)
+	c.Assert(err, IsNil)
+	var p bigly.Pile
+	c.Assert(json.Unmarshal(b, &p), IsNil)
+	c.Assert(p.Chrom, Equals, "chr1")
+	c.Assert(p.Pos, Equals, 99)
+	c.Assert(p.RefBase, Equals, byte('A'))
+	c.Assert(p.SplitterPositions, DeepEquals, tpile.SplitterPositions)
+	c.Assert(string(p.Bases), Equals, "ACGT")
+	c.Assert(p.Quals, DeepEquals, tpile.Quals)
+
+	o := bigly.Options{SplitterVerbosity: 2}
+	for _, col := range o.AllColumns() {
+		o.Fields = append(o.Fields, col.Name)
+	}
+	c.Assert(o.Prepare(), IsNil)
+	c.Assert(p.TabString(o), Equals, tpile.TabString(o))
+
+	// the gc windows come from the keys.
+	c.Assert(json.Unmarshal([]byte(`{"pos":5,"duplicity33":0.5,"gc101":7,"gc33":3}`), &p), IsNil)
+	c.Assert(p.Pos, Equals, 4)
+	c.Assert(p.Chrom, Equals, "")
+	c.Assert(p.GC, DeepEquals, []uint32{3, 7})
+	c.Assert(p.Duplicity, DeepEquals, []float32{0.5})
+
+	c.Assert(json.Unmarshal([]byte(`{"pos":5,"xxx":1}`), &p), NotNil)
+	c.Assert(json.Unmarshal([]byte(`{"pos":"5"}`), &p), NotNil)
+}
@@ -0,0 +1,233 @@
+package bigly
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/biogo/hts/sam"
+)
+
+// LinkType is the evidence for a Link.
+type LinkType uint8
+
+const (
+	// LinkSplit is from a read and a position in its SA tag.
+	LinkSplit LinkType = iota + 1
+	// LinkPair is from a read and its mate when they are discordant or in an unexpected orientation.
+	LinkPair
+)
+
+func (t LinkType) String() string {
+	switch t {
+	case LinkSplit:
+		return "split"
+	case LinkPair:
+		return "pair"
+	}
+	return "unknown"
+}
+
+// Link joins the loci of two parts of a read or of a pair. The Strand of each is that of the
+// alignment.
+type Link struct {
+	Type LinkType
+	A, B Position
+	// AEnd and BEnd are set for a LinkSplit if the rest of the read is joined at the end of A or B,
+	// rather than at the start, because the clip after the alignment is longer than the one before it.
+	AEnd, BEnd bool
+}
+
+// ordered returns l with A before B.
+func (l Link) ordered() Link {
+	if posLess(l.B, l.A) {
+		l.A, l.B = l.B, l.A
+		l.AEnd, l.BEnd = l.BEnd, l.AEnd
+	}
+	return l
+}
+
+// clippedAfter reports whether the clip after the alignment is longer than the one before it.
+func clippedAfter(c sam.Cigar) bool {
+	before, after := clipLengths(c)
+	return after > before
+}
+
+// clipLengths returns the lengths of the soft or hard clips before and after the alignment.
+func clipLengths(c sam.Cigar) (before, after int) {
+	clip := func(co sam.CigarOp) int {
+		if t := co.Type(); t == sam.CigarSoftClipped || t == sam.CigarHardClipped {
+			return co.Len()
+		}
+		return 0
+	}
+	if len(c) == 0 {
+		return 0, 0
+	}
+	return clip(c[0]), clip(c[len(c)-1])
+}
+
+// recordLinks appends the links from r to links. pairs holds the names of the reads with a pair
+// link so that a pair with both reads in a region is counted once.
+func recordLinks(o Options, r *sam.Record, links []Link, pairs map[string]bool) []Link {
+	if r.Ref == nil || r.MapQ < o.MinMappingQuality || r.Flags&(sam.Unmapped|sam.Secondary|sam.Supplementary) != 0 {
+		return links
+	}
+	a := Position{Chrom: r.Ref.Name(), Start: r.Start(), End: r.End(), Strand: r.Flags&sam.Reverse == 0}
+	if r.Flags&sam.Paired != 0 && r.Flags&sam.MateUnmapped == 0 && r.MateRef != nil &&
+		(r.MateRef.ID() != r.Ref.ID() || abs(r.Start()-r.MatePos) > o.ConcordantCutoff || oddOrientation(r)) && !pairs[r.Name] {
+		pairs[r.Name] = true
+		// the mate's cigar is not known so it is given the length of this read.
+		b := Position{Chrom: r.MateRef.Name(), Start: r.MatePos, End: r.MatePos + r.Len(), Strand: r.Flags&sam.MateReverse == 0}
+		links = append(links, Link{Type: LinkPair, A: a, B: b})
+	}
+	if tags, ok := r.Tag([]byte{'S', 'A'}); ok {
+		for _, sa := range ParseSAs(tags) {
+			if sa.MapQ >= o.MinMappingQuality {
+				b := Position{Chrom: string(sa.Chrom), Start: sa.Pos, End: sa.End(), Strand: sa.Strand}
+				links = append(links, Link{Type: LinkSplit, A: a, B: b, AEnd: clippedAfter(r.Cigar), BEnd: clippedAfter(sa.Parsed)})
+			}
+		}
+	}
+	return links
+}
+
+// oddOrientation reports whether a pair on one chromosome is not forward then reverse.
+func oddOrientation(r *sam.Record) bool {
+	rev, mateRev := r.Flags&sam.Reverse != 0, r.Flags&sam.MateReverse != 0
+	if rev == mateRev {
+		return true
+	}
+	if r.Start() == r.MatePos {
+		return false
+	}
+	// the left-most read should be forward.
+	return (r.Start() < r.MatePos) == rev
+}
+
+// Links returns the split-read and discordant-pair links of the reads that overlap pos and pass
+// the Options. The reads are taken from the bam without piling them up, and a pos without a Chrom
+// is the whole bam. The Iterator is moved to pos so Seek must be called to continue elsewhere.
+func (it *Iterator) Links(pos Position) ([]Link, error) {
+	var links []Link
+	pairs := make(map[string]bool)
+	err := it.eachRead(pos, func(r *sam.Record) {
+		links = recordLinks(it.opts, r, links, pairs)
+	})
+	return links, err
+}
+
+// LinkCluster is a group of Links whose ends are within the slop of each other and on the same
+// strands.
+type LinkCluster struct {
+	// A and B span the ends of the links. A is before B.
+	A, B Position
+	// Split and Pairs are the number of links of each type.
+	Split, Pairs int
+}
+
+// Reads returns the number of links in the cluster.
+func (c *LinkCluster) Reads() int { return c.Split + c.Pairs }
+
+func posLess(a, b Position) bool {
+	if a.Chrom != b.Chrom {
+		return a.Chrom < b.Chrom
+	}
+	return a.Start < b.Start
+}
+
+// near reports whether p is on the same chromosome and strand and within slop of c.
+func near(c, p Position, slop int) bool {
+	return c.Chrom == p.Chrom && c.Strand == p.Strand && p.Start <= c.End+slop && p.End >= c.Start-slop
+}
+
+func (c *Position) extend(p Position) {
+	c.Start = min(c.Start, p.Start)
+	c.End = max(c.End, p.End)
+}
+
+// ClusterLinks groups links where both ends are within slop bases of the cluster and on the
+// same strands. The ends of each link are ordered so that it joins the same cluster however it
+// was found. Clusters are sorted by A and then B.
+func ClusterLinks(links []Link, slop int) []LinkCluster {
+	ls := make([]Link, len(links))
+	for i, l := range links {
+		ls[i] = l.ordered()
+	}
+	sort.SliceStable(ls, func(i, j int) bool { return posLess(ls[i].A, ls[j].A) })
+
+	var done, open []LinkCluster
+	for _, l := range ls {
+		// clusters that can't get more links are finished.
+		k := 0
+		for _, c := range open {
+			if c.A.Chrom != l.A.Chrom || l.A.Start > c.A.End+slop {
+				done = append(done, c)
+			} else {
+				open[k] = c
+				k++
+			}
+		}
+		open = open[:k]
+		i := 0
+		for ; i < len(open); i++ {
+			if near(open[i].A, l.A, slop) && near(open[i].B, l.B, slop) {
+				break
+			}
+		}
+		if i == len(open) {
+			open = append(open, LinkCluster{A: l.A, B: l.B})
+		}
+		c := &open[i]
+		c.A.extend(l.A)
+		c.B.extend(l.B)
+		if l.Type == LinkSplit {
+			c.Split++
+		} else {
+			c.Pairs++
+		}
+	}
+	done = append(done, open...)
+	sort.Slice(done, func(i, j int) bool {
+		if done[i].A.Chrom == done[j].A.Chrom && done[i].A.Start == done[j].A.Start {
+			return posLess(done[i].B, done[j].B)
+		}
+		return posLess(done[i].A, done[j].A)
+	})
+	return done
+}
+
+// BEDPEHeader is the header for LinkCluster.AppendBEDPE.
+const BEDPEHeader = "#chrom1\tstart1\tend1\tchrom2\tstart2\tend2\tname\tscore\tstrand1\tstrand2\ttype\tsplit\tpairs"
+
+func strandByte(s bool) byte {
+	if s {
+		return '+'
+	}
+	return '-'
+}
+
+// AppendBEDPE appends the cluster as a BEDPE line, without a newline, to b. The score is the
+// number of links and the type is split, pair or split,pair.
+func (c *LinkCluster) AppendBEDPE(b []byte, name string) []byte {
+	for i, p := range []Position{c.A, c.B} {
+		if i > 0 {
+			b = append(b, '\t')
+		}
+		b = append(b, p.Chrom...)
+		b = strconv.AppendInt(append(b, '\t'), int64(p.Start), 10)
+		b = strconv.AppendInt(append(b, '\t'), int64(p.End), 10)
+	}
+	b = append(append(b, '\t'), name...)
+	b = strconv.AppendInt(append(b, '\t'), int64(c.Reads()), 10)
+	b = append(b, '\t', strandByte(c.A.Strand), '\t', strandByte(c.B.Strand), '\t')
+	switch {
+	case c.Split > 0 && c.Pairs > 0:
+		b = append(b, "split,pair"...)
+	case c.Split > 0:
+		b = append(b, LinkSplit.String()...)
+	default:
+		b = append(b, LinkPair.String()...)
+	}
+	b = strconv.AppendInt(append(b, '\t'), int64(c.Split), 10)
+	return strconv.AppendInt(append(b, '\t'), int64(c.Pairs), 10)
+}
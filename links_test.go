@@ -0,0 +1,123 @@
+package bigly_test
+
+import (
+	"path/filepath"
+
+	"github.com/biogo/hts/sam"
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type LinksTest struct{}
+
+var _ = Suite(&LinksTest{})
+
+func (t *LinksTest) TestRecordLinks(c *C) {
+	chr1, _ := sam.NewReference("chr1", "", "", 100000, nil, nil)
+	chr2, _ := sam.NewReference("chr2", "", "", 100000, nil, nil)
+	_, err := sam.NewHeader(nil, []*sam.Reference{chr1, chr2})
+	c.Assert(err, IsNil)
+	m10 := sam.Cigar{sam.NewCigarOp(sam.CigarMatch, 10)}
+	recs := []*sam.Record{
+		// a discordant pair with both reads in the region is counted once.
+		{Name: "p1", Ref: chr1, Pos: 100, MapQ: 60, Cigar: m10, Flags: sam.Paired | sam.Read1 | sam.MateReverse, MateRef: chr1, MatePos: 50000},
+		// concordant.
+		{Name: "p2", Ref: chr1, Pos: 110, MapQ: 60, Cigar: m10, Flags: sam.Paired | sam.Read1 | sam.MateReverse, MateRef: chr1, MatePos: 400},
+		{Name: "p3", Ref: chr1, Pos: 120, MapQ: 60, Cigar: m10, Flags: sam.Paired | sam.Read2 | sam.Reverse, MateRef: chr2, MatePos: 700},
+		// low mapping quality.
+		{Name: "p4", Ref: chr1, Pos: 130, MapQ: 1, Cigar: m10, Flags: sam.Paired | sam.Read1, MateRef: chr2, MatePos: 700},
+		{Name: "s1", Ref: chr1, Pos: 140, MapQ: 60, Cigar: m10, AuxFields: []sam.Aux{
+			mustAux(sam.NewAux(sam.NewTag("SA"), "chr2,1001,-,5S10M,60,0;chr1,9,+,10M5S,0,0;"))}},
+		// the rest of the read is after the alignment and before the SA.
+		{Name: "s2", Ref: chr1, Pos: 150, MapQ: 60, Cigar: sam.Cigar{sam.NewCigarOp(sam.CigarMatch, 10), sam.NewCigarOp(sam.CigarSoftClipped, 5)},
+			AuxFields: []sam.Aux{mustAux(sam.NewAux(sam.NewTag("SA"), "chr1,3001,+,10S5M,60,0;"))}},
+		// close but in +/+ and -/+ orientations.
+		{Name: "p5", Ref: chr1, Pos: 160, MapQ: 60, Cigar: m10, Flags: sam.Paired | sam.Read1, MateRef: chr1, MatePos: 500},
+		{Name: "p6", Ref: chr1, Pos: 170, MapQ: 60, Cigar: m10, Flags: sam.Paired | sam.Read1 | sam.Reverse, MateRef: chr1, MatePos: 500},
+		{Name: "p1", Ref: chr1, Pos: 50000, MapQ: 60, Cigar: m10, Flags: sam.Paired | sam.Read2 | sam.Reverse, MateRef: chr1, MatePos: 100},
+	}
+	links := bigly.RecordLinks(bigly.Options{MinMappingQuality: 5, ConcordantCutoff: 1000}, recs)
+	c.Assert(links, DeepEquals, []bigly.Link{
+		{Type: bigly.LinkPair, A: bigly.Position{Chrom: "chr1", Start: 100, End: 110, Strand: true},
+			B: bigly.Position{Chrom: "chr1", Start: 50000, End: 50010}},
+		{Type: bigly.LinkPair, A: bigly.Position{Chrom: "chr1", Start: 120, End: 130},
+			B: bigly.Position{Chrom: "chr2", Start: 700, End: 710, Strand: true}},
+		{Type: bigly.LinkSplit, A: bigly.Position{Chrom: "chr1", Start: 140, End: 150, Strand: true},
+			B: bigly.Position{Chrom: "chr2", Start: 1000, End: 1010}},
+		{Type: bigly.LinkSplit, A: bigly.Position{Chrom: "chr1", Start: 150, End: 160, Strand: true},
+			B: bigly.Position{Chrom: "chr1", Start: 3000, End: 3005, Strand: true}, AEnd: true},
+		{Type: bigly.LinkPair, A: bigly.Position{Chrom: "chr1", Start: 160, End: 170, Strand: true},
+			B: bigly.Position{Chrom: "chr1", Start: 500, End: 510, Strand: true}},
+		{Type: bigly.LinkPair, A: bigly.Position{Chrom: "chr1", Start: 170, End: 180},
+			B: bigly.Position{Chrom: "chr1", Start: 500, End: 510, Strand: true}},
+	})
+}
+
+func (t *LinksTest) TestIteratorLinks(c *C) {
+	chr1, _ := sam.NewReference("chr1", "", "", 10000, nil, nil)
+	chr2, _ := sam.NewReference("chr2", "", "", 10000, nil, nil)
+	h, _ := sam.NewHeader(nil, []*sam.Reference{chr1, chr2})
+	m10 := sam.Cigar{sam.NewCigarOp(sam.CigarMatch, 10)}
+	recs := []*sam.Record{
+		{Name: "p1", Ref: chr1, Pos: 100, MapQ: 60, Cigar: m10, Flags: sam.Paired | sam.Read1 | sam.MateReverse, MateRef: chr2, MatePos: 5000},
+		{Name: "p2", Ref: chr1, Pos: 3000, MapQ: 60, Cigar: m10, Flags: sam.Paired | sam.Read1 | sam.MateReverse, MateRef: chr1, MatePos: 3200},
+		{Name: "p1", Ref: chr2, Pos: 5000, MapQ: 60, Cigar: m10, Flags: sam.Paired | sam.Read2 | sam.Reverse, MateRef: chr1, MatePos: 100},
+		{Name: "s1", Ref: chr2, Pos: 6000, MapQ: 60, Cigar: m10, AuxFields: []sam.Aux{
+			mustAux(sam.NewAux(sam.NewTag("SA"), "chr1,8001,+,5S10M,60,0;"))}},
+		{Name: "u", Ref: nil, Pos: -1, MateRef: nil, MatePos: -1, Flags: sam.Unmapped},
+	}
+	for _, r := range recs {
+		r.Seq = sam.NewSeq([]byte("ACGTACGTAC"))
+		r.Qual = []byte{30, 30, 30, 30, 30, 30, 30, 30, 30, 30}
+	}
+	recs[4].Cigar = nil
+	path := filepath.Join(c.MkDir(), "links.bam")
+	c.Assert(bigly.WriteIndexedBam(path, h, recs), IsNil)
+	o := bigly.Options{MinMappingQuality: 5, ConcordantCutoff: 1000}
+	it := bigly.Up(path, o, bigly.Position{Chrom: "chr1", Start: 0, End: 10000}, nil)
+	c.Assert(it.Error(), IsNil)
+	defer it.Close()
+
+	links, err := it.Links(bigly.Position{Chrom: "chr2", Start: 5500, End: 10000})
+	c.Assert(err, IsNil)
+	c.Assert(links, HasLen, 1)
+	c.Assert(links[0].Type, Equals, bigly.LinkSplit)
+
+	// without a chrom, the links are from the whole bam and the pair is counted once.
+	links, err = it.Links(bigly.Position{Start: -1, End: -1})
+	c.Assert(err, IsNil)
+	c.Assert(links, HasLen, 2)
+	c.Assert(links[0].A, Equals, bigly.Position{Chrom: "chr1", Start: 100, End: 110, Strand: true})
+	c.Assert(links[1].B, Equals, bigly.Position{Chrom: "chr1", Start: 8000, End: 8010, Strand: true})
+
+	// as is the zero Position.
+	zero, err := it.Links(bigly.Position{})
+	c.Assert(err, IsNil)
+	c.Assert(zero, DeepEquals, links)
+}
+
+func (t *LinksTest) TestClusterLinks(c *C) {
+	pos := func(chrom string, start int, strand bool) bigly.Position {
+		return bigly.Position{Chrom: chrom, Start: start, End: start + 10, Strand: strand}
+	}
+	links := []bigly.Link{
+		{Type: bigly.LinkPair, A: pos("chr1", 100, true), B: pos("chr1", 5000, false)},
+		// found from the other end.
+		{Type: bigly.LinkPair, A: pos("chr1", 5020, false), B: pos("chr1", 115, true)},
+		{Type: bigly.LinkSplit, A: pos("chr1", 108, true), B: pos("chr1", 5030, false)},
+		// other strands.
+		{Type: bigly.LinkPair, A: pos("chr1", 110, false), B: pos("chr1", 5010, false)},
+		// too far.
+		{Type: bigly.LinkPair, A: pos("chr1", 100, true), B: pos("chr1", 9000, false)},
+		{Type: bigly.LinkSplit, A: pos("chr2", 10, true), B: pos("chr1", 100, true)},
+	}
+	cs := bigly.ClusterLinks(links, 20)
+	c.Assert(cs, HasLen, 4)
+	c.Assert(cs[0], DeepEquals, bigly.LinkCluster{A: bigly.Position{Chrom: "chr1", Start: 100, End: 125, Strand: true},
+		B: bigly.Position{Chrom: "chr1", Start: 5000, End: 5040}, Split: 1, Pairs: 2})
+	c.Assert(string(cs[0].AppendBEDPE(nil, "l1")), Equals, "chr1\t100\t125\tchr1\t5000\t5040\tl1\t3\t+\t-\tsplit,pair\t1\t2")
+	c.Assert(cs[1].B.Start, Equals, 9000)
+	c.Assert(cs[3].A.Strand, Equals, false)
+	// the ends are ordered by chromosome then position.
+	c.Assert(string(cs[2].AppendBEDPE(nil, ".")), Equals, "chr1\t100\t110\tchr2\t10\t20\t.\t1\t+\t+\tsplit\t1\t0")
+}
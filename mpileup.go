@@ -0,0 +1,94 @@
+package bigly
+
+import (
+	"strconv"
+
+	"github.com/biogo/hts/sam"
+)
+
+// MpileupFields are the fields that match the columns of samtools mpileup. Other fields can be
+// appended to them.
+var MpileupFields = []string{"chrom", "pos", "refbase", "depth", "readbases", "quals"}
+
+// strandBase returns b in lower case for reads on the reverse strand.
+func strandBase(b byte, reverse bool) byte {
+	if reverse && 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+// addReadBases appends the mpileup read bases for one alignment. Bases that match the
+// reference are replaced by markRefBases once the reference base is known.
+func (p *Pile) addReadBases(ri *readInfo, s *CigarSummary) {
+	b := p.ReadBases
+	if s.Head {
+		b = append(b, '^', byte(min(int(ri.mapq), 93)+33))
+	}
+	switch s.At.Type() {
+	case sam.CigarDeletion:
+		b = append(b, '*')
+	case sam.CigarSkipped:
+		if ri.reverse {
+			b = append(b, '<')
+		} else {
+			b = append(b, '>')
+		}
+	default:
+		b = append(b, strandBase(s.Base, ri.reverse))
+	}
+	switch s.Right.Type() {
+	case sam.CigarInsertion:
+		b = append(b, '+')
+		b = strconv.AppendInt(b, int64(len(s.Insertion)), 10)
+		for _, c := range s.Insertion {
+			b = append(b, strandBase(c, ri.reverse))
+		}
+	case sam.CigarDeletion:
+		if s.At.Type() != sam.CigarDeletion {
+			// the deleted reference bases are not known so they are written as N, as
+			// samtools does without a reference.
+			b = append(b, '-')
+			b = strconv.AppendInt(b, int64(s.Right.Len()), 10)
+			for i := 0; i < s.Right.Len(); i++ {
+				b = append(b, strandBase('N', ri.reverse))
+			}
+		}
+	case sam.CigarSoftClipped, sam.CigarHardClipped:
+		// clips are only at the ends so the read ends here.
+		b = append(b, '$')
+	}
+	if s.Tail {
+		b = append(b, '$')
+	}
+	p.ReadBases = b
+}
+
+// markRefBases replaces the read bases in b that match ref with '.' or, on the reverse
+// strand, ','. Markers and inserted or deleted bases are skipped.
+func markRefBases(b []byte, ref byte) {
+	if 'a' <= ref && ref <= 'z' {
+		ref -= 'a' - 'A'
+	}
+	if ref == 'N' {
+		return
+	}
+	upper, lower := ref, strandBase(ref, true)
+	for i := 0; i < len(b); i++ {
+		switch c := b[i]; c {
+		case '^':
+			i++
+		case '+', '-':
+			j := i + 1
+			n := 0
+			for ; j < len(b) && '0' <= b[j] && b[j] <= '9'; j++ {
+				n = 10*n + int(b[j]-'0')
+			}
+			i = j + n - 1
+		case upper:
+			b[i] = '.'
+		case lower:
+			b[i] = ','
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package bigly_test
+
+import (
+	"strings"
+
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type MpileupTest struct{}
+
+var _ = Suite(&MpileupTest{})
+
+func (t *MpileupTest) TestMpileup(c *C) {
+	opts := bigly.Options{Fields: bigly.MpileupFields}
+	c.Assert(opts.Prepare(), IsNil)
+	lines := make(map[int]string)
+	for pos := range ref {
+		p := &bigly.Pile{Chrom: "ref", Pos: pos, RefBase: ref[pos]}
+		p.Update(opts, newAligns())
+		lines[pos+1] = strings.Join(strings.Split(p.TabString(opts), "\t")[:5], " ")
+	}
+	// see the alignments in up_test.go.
+	c.Assert(lines[14], Equals, "ref 14 A 3 .+2AG..$")
+	c.Assert(lines[16], Equals, "ref 16 A 3 ..^?.")
+	c.Assert(lines[18], Equals, "ref 18 A 3 .-1N.$.")
+	c.Assert(lines[19], Equals, "ref 19 G 2 *.")
+	c.Assert(lines[22], Equals, "ref 22 G 2 .$>")
+	c.Assert(lines[29], Equals, "ref 29 T 2 >^2,")
+	c.Assert(lines[42], Equals, "ref 42 C 1 g")
+	c.Assert(lines[45], Equals, "ref 45 T 1 ,$")
+
+	// without the reference, bases are not replaced.
+	p := &bigly.Pile{Chrom: "ref", Pos: 13, RefBase: 'N'}
+	p.Update(opts, newAligns())
+	c.Assert(string(p.ReadBases), Equals, "A+2AGAA$")
+}
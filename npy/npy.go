@@ -0,0 +1,201 @@
+// Package npy writes 2-d float32 arrays in the NumPy .npy and .npz formats.
+package npy
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// headerSize is the size of the header. It leaves room for the shape, which is only known
+// when the array is closed.
+const headerSize = 128
+
+var errClosed = errors.New("npy: write to closed array")
+
+// header returns the .npy version 1.0 header for a little-endian float32 array.
+func header(rows, cols int) []byte { return arrayHeader("<f4", []int{rows, cols}) }
+
+// arrayHeader returns the .npy version 1.0 header for an array of the numpy type descr.
+func arrayHeader(descr string, shape []int) []byte {
+	dims := make([]string, len(shape))
+	for i, n := range shape {
+		dims[i] = strconv.Itoa(n)
+	}
+	tuple := strings.Join(dims, ", ")
+	if len(shape) == 1 {
+		tuple += ","
+	}
+	dict := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s), }", descr, tuple)
+	size := headerSize
+	for len(dict)+11 > size {
+		size += 64
+	}
+	h := make([]byte, size)
+	copy(h, "\x93NUMPY\x01\x00")
+	binary.LittleEndian.PutUint16(h[8:], uint16(size-10))
+	n := copy(h[10:], dict)
+	for i := 10 + n; i < size-1; i++ {
+		h[i] = ' '
+	}
+	h[size-1] = '\n'
+	return h
+}
+
+// WriteUint8 writes data as a complete .npy array of unsigned bytes with the given shape.
+func WriteUint8(w io.Writer, data []uint8, shape ...int) error {
+	n := 1
+	for _, d := range shape {
+		n *= d
+	}
+	if n != len(data) || len(shape) == 0 {
+		return fmt.Errorf("npy: shape %v does not match %d values", shape, len(data))
+	}
+	if _, err := w.Write(arrayHeader("|u1", shape)); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// Writer writes rows of a 2-d float32 array. The number of rows is written to the header by
+// Close so the underlying writer must be able to seek.
+type Writer struct {
+	w    io.WriteSeeker
+	cols int
+	rows int
+	buf  []byte
+	err  error
+}
+
+// NewWriter returns a Writer for an array with cols columns.
+func NewWriter(w io.WriteSeeker, cols int) (*Writer, error) {
+	if cols < 1 {
+		return nil, fmt.Errorf("npy: bad number of columns: %d", cols)
+	}
+	if _, err := w.Write(header(0, cols)); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, cols: cols, buf: make([]byte, 4*cols)}, nil
+}
+
+// Write adds a row. It must have one value for each column.
+func (w *Writer) Write(row []float32) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(row) != w.cols {
+		return fmt.Errorf("npy: expected %d values, got %d", w.cols, len(row))
+	}
+	for i, v := range row {
+		binary.LittleEndian.PutUint32(w.buf[4*i:], math.Float32bits(v))
+	}
+	if _, w.err = w.w.Write(w.buf); w.err == nil {
+		w.rows++
+	}
+	return w.err
+}
+
+// Rows returns the number of rows written.
+func (w *Writer) Rows() int { return w.rows }
+
+// Close writes the shape to the header. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = errClosed
+	end, err := w.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = w.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err = w.w.Write(header(w.rows, w.cols)); err != nil {
+		return err
+	}
+	_, err = w.w.Seek(end, io.SeekStart)
+	return err
+}
+
+// NpzWriter writes named arrays to a .npz file, which is a zip of .npy files. Each array is
+// written to a temporary file until it is complete.
+type NpzWriter struct {
+	zw   *zip.Writer
+	tmp  *os.File
+	cur  *Writer
+	name string
+}
+
+// NewNpzWriter returns an NpzWriter that writes to w.
+func NewNpzWriter(w io.Writer) *NpzWriter {
+	return &NpzWriter{zw: zip.NewWriter(w)}
+}
+
+// Create finishes any current array and starts a new one with the given name and number
+// of columns. The name is the key used by numpy.load.
+func (z *NpzWriter) Create(name string, cols int) (*Writer, error) {
+	if err := z.finish(); err != nil {
+		return nil, err
+	}
+	var err error
+	if z.tmp == nil {
+		if z.tmp, err = ioutil.TempFile("", "bigly-npz"); err != nil {
+			return nil, err
+		}
+	}
+	if err = z.tmp.Truncate(0); err != nil {
+		return nil, err
+	}
+	if _, err = z.tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if z.cur, err = NewWriter(z.tmp, cols); err != nil {
+		return nil, err
+	}
+	z.name = name
+	return z.cur, nil
+}
+
+// finish copies the current array into the zip.
+func (z *NpzWriter) finish() error {
+	if z.cur == nil {
+		return nil
+	}
+	cur := z.cur
+	z.cur = nil
+	if err := cur.Close(); err != nil {
+		return err
+	}
+	if _, err := z.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w, err := z.zw.CreateHeader(&zip.FileHeader{Name: z.name + ".npy", Method: zip.Deflate})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, z.tmp)
+	return err
+}
+
+// Close finishes the current array and the zip. It does not close the underlying writer.
+func (z *NpzWriter) Close() error {
+	err := z.finish()
+	if z.tmp != nil {
+		z.tmp.Close()
+		os.Remove(z.tmp.Name())
+		z.tmp = nil
+	}
+	if err != nil {
+		return err
+	}
+	return z.zw.Close()
+}
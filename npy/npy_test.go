@@ -0,0 +1,111 @@
+package npy
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type NpyTest struct{}
+
+var _ = Suite(&NpyTest{})
+
+// read checks the header of an .npy file and returns the values.
+func read(c *C, b []byte, rows, cols int) []float32 {
+	c.Assert(string(b[:8]), Equals, "\x93NUMPY\x01\x00")
+	n := int(binary.LittleEndian.Uint16(b[8:]))
+	c.Assert((10+n)%64, Equals, 0)
+	c.Assert(string(bytes.TrimRight(b[10:10+n], " \n")), Equals,
+		"{'descr': '<f4', 'fortran_order': False, 'shape': ("+strconv.Itoa(rows)+", "+strconv.Itoa(cols)+"), }")
+	data := b[10+n:]
+	c.Assert(len(data), Equals, 4*rows*cols)
+	vs := make([]float32, rows*cols)
+	for i := range vs {
+		vs[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return vs
+}
+
+func (t *NpyTest) TestWriter(c *C) {
+	f, err := ioutil.TempFile("", "bigly-npy")
+	c.Assert(err, IsNil)
+	defer os.Remove(f.Name())
+	w, err := NewWriter(f, 3)
+	c.Assert(err, IsNil)
+	for i := 0; i < 12; i++ {
+		c.Assert(w.Write([]float32{float32(i), float32(i) / 2, -1}), IsNil)
+	}
+	c.Assert(w.Write([]float32{1}), NotNil)
+	c.Assert(w.Rows(), Equals, 12)
+	c.Assert(w.Close(), IsNil)
+	c.Assert(w.Write([]float32{1, 2, 3}), NotNil)
+	f.Close()
+
+	b, err := ioutil.ReadFile(f.Name())
+	c.Assert(err, IsNil)
+	vs := read(c, b, 12, 3)
+	c.Assert(vs[:6], DeepEquals, []float32{0, 0, -1, 1, 0.5, -1})
+	c.Assert(vs[33:], DeepEquals, []float32{11, 5.5, -1})
+
+	_, err = NewWriter(f, 0)
+	c.Assert(err, NotNil)
+}
+
+func (t *NpyTest) TestNpz(c *C) {
+	var buf bytes.Buffer
+	z := NewNpzWriter(&buf)
+	w, err := z.Create("chr1:1-10", 2)
+	c.Assert(err, IsNil)
+	for i := 0; i < 10; i++ {
+		c.Assert(w.Write([]float32{float32(i), 1}), IsNil)
+	}
+	w, err = z.Create("chr2:1-2", 2)
+	c.Assert(err, IsNil)
+	c.Assert(w.Write([]float32{7, 8}), IsNil)
+	_, err = z.Create("empty", 4)
+	c.Assert(err, IsNil)
+	c.Assert(z.Close(), IsNil)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, IsNil)
+	c.Assert(zr.File, HasLen, 3)
+	exp := []struct {
+		name       string
+		rows, cols int
+	}{{"chr1:1-10.npy", 10, 2}, {"chr2:1-2.npy", 1, 2}, {"empty.npy", 0, 4}}
+	for i, f := range zr.File {
+		c.Assert(f.Name, Equals, exp[i].name)
+		r, err := f.Open()
+		c.Assert(err, IsNil)
+		b, err := ioutil.ReadAll(r)
+		c.Assert(err, IsNil)
+		vs := read(c, b, exp[i].rows, exp[i].cols)
+		if i == 1 {
+			c.Assert(vs, DeepEquals, []float32{7, 8})
+		}
+	}
+}
+
+func (t *NpyTest) TestWriteUint8(c *C) {
+	var buf bytes.Buffer
+	c.Assert(WriteUint8(&buf, []uint8{1, 2, 3, 4, 5, 6}, 1, 2, 3), IsNil)
+	b := buf.Bytes()
+	n := int(binary.LittleEndian.Uint16(b[8:]))
+	c.Assert((10+n)%64, Equals, 0)
+	c.Assert(string(bytes.TrimRight(b[10:10+n], " \n")), Equals, "{'descr': '|u1', 'fortran_order': False, 'shape': (1, 2, 3), }")
+	c.Assert(b[10+n:], DeepEquals, []byte{1, 2, 3, 4, 5, 6})
+
+	buf.Reset()
+	c.Assert(WriteUint8(&buf, []uint8{1, 2}, 2), IsNil)
+	c.Assert(bytes.Contains(buf.Bytes(), []byte("'shape': (2,)")), Equals, true)
+	c.Assert(WriteUint8(&buf, []uint8{1, 2}, 3), NotNil)
+}
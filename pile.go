@@ -2,10 +2,8 @@ package bigly
 
 import (
 	"bytes"
-	"fmt"
 	"log"
 	"strconv"
-	"strings"
 
 	"github.com/biogo/hts/sam"
 )
@@ -29,14 +27,26 @@ func max(a, b int) int {
 
 // Options holds information about what is reported in the Pile
 type Options struct {
-	MinBaseQuality    uint8  `arg:"-q,help:base quality threshold"`
-	MinMappingQuality uint8  `arg:"-Q,help:mapping quality threshold"`
-	ExcludeFlag       uint16 `arg:"-F"`
-	IncludeFlag       uint16 `arg:"-f"`
-	MinClipLength     int    `arg:"-c,help:only count H/S clips of at least this length"`
-	IncludeBases      bool   `arg:"-b,help:output each base and base quality score"`
-	SplitterVerbosity int    `arg:"-s,help:0-only count; 1:count and single most frequent; 2:all SAs; 3:dont shorten positions"`
-	ConcordantCutoff  int    `arg:"-o,help:distance beyond which mates are called discordant"`
+	MinBaseQuality    uint8    `arg:"-q,help:base quality threshold"`
+	MinMappingQuality uint8    `arg:"-Q,help:mapping quality threshold"`
+	ExcludeFlag       uint16   `arg:"-F"`
+	IncludeFlag       uint16   `arg:"-f"`
+	MinClipLength     int      `arg:"-c,help:only count H/S clips of at least this length"`
+	IncludeBases      bool     `arg:"-b,help:output each base and base quality score"`
+	SplitterVerbosity int      `arg:"-s,help:0-only count; 1:count and single most frequent; 2:all SAs; 3:dont shorten positions"`
+	ConcordantCutoff  int      `arg:"-o,help:distance beyond which mates are called discordant"`
+	PerPosition       bool     `arg:"help:decode every read at each position it covers rather than once as it is seen. slower, for checking"`
+	GCWindows         []int    `arg:"-w,help:window sizes for GC content and duplicity (with -r). default: 65 257"`
+	Fields            []string `arg:"help:only calculate and output these fields. e.g. --fields depth softstarts softends"`
+	// ReusePile makes the Iterator reuse a single Pile; see Iterator.Pile.
+	ReusePile bool `arg:"-"`
+	// Filters are applied to each read that passes the flag and mapping-quality checks.
+	Filters []ReadFilter `arg:"-"`
+
+	// set by Prepare.
+	prepared bool
+	cols     []Column
+	work     work
 }
 
 // Pile holds the information about a single base.
@@ -74,14 +84,20 @@ type Pile struct {
 		Duplicates             uint32  // reads counted as duplicates
 		Supplementary          uint32  // reads counted as supplementary
 	*/
-	Discordant             uint32  // Number of reads with insert size > ConcordantCutoff
-	DiscordantChrom        uint32  // Number of reads mapping on different chroms
-	DiscordantChromEntropy float32 // high value means all discordants came from same chrom.
-	GC65                   uint32
-	GC257                  uint32
-	Duplicity65            float32 // measure of lack of sequence entropy.
-	Duplicity257           float32 // measure of lack of sequence entropy.
+	Discordant             uint32    // Number of reads with insert size > ConcordantCutoff
+	DiscordantChrom        uint32    // Number of reads mapping on different chroms
+	DiscordantChromEntropy float32   // high value means all discordants came from same chrom.
+	GC                     []uint32  // count of G and C in each of Options.GCWindows centered on this base.
+	Duplicity              []float32 // measure of lack of sequence entropy in each window.
 	SplitterPositions      []Position
+	// the mode/count/number summary of the SplitterPositions when they are read from
+	// output written with SplitterVerbosity 1.
+	splitterSummary string
+	// for each of SplitterPositions, whether it is on the other strand from the read. It is
+	// not kept in the output so it is empty for piles that are read back.
+	splitterOpposite []bool
+	// ReadBases holds the read bases in the format of samtools mpileup.
+	ReadBases []byte
 }
 
 // from biogo/hts
@@ -120,42 +136,68 @@ func mean(arr []int32) int {
 	return int(0.5 + s/float64(len(arr)))
 }
 
-// TabString prints a tab-delimited version of the Pile
+// TabString prints a tab-delimited version of the Pile. Unknown fields in the Options are left out.
 func (p Pile) TabString(o Options) string {
-	spl := ""
-	if o.SplitterVerbosity > 0 && len(p.SplitterPositions) > 0 {
-		if o.SplitterVerbosity == 1 {
-			m, c := pMode(p.SplitterPositions)
-			spl = fmt.Sprintf("%d/%d/%d", m, c, len(p.SplitterPositions))
-		} else {
-			aspl := make([]string, len(p.SplitterPositions))
-			for i, s := range p.SplitterPositions {
-				aspl[i] = s.String()
-			}
-			spl = strings.Join(aspl, ",")
+	o.prepare()
+	return string(p.AppendTab(make([]byte, 0, 128), o))
+}
+
+// AppendTab appends the tab-delimited version of the Pile to b. Prepare the Options once
+// beforehand when there are Fields or GCWindows so they are not prepared for each Pile.
+func (p *Pile) AppendTab(b []byte, o Options) []byte {
+	o.prepare()
+	for i, c := range o.cols {
+		if i > 0 {
+			b = append(b, '\t')
 		}
+		b = c.Append(b, p, o)
+	}
+	return b
+}
+
+// Reset clears the Pile, keeping the memory allocated for its slices.
+func (p *Pile) Reset() {
+	*p = Pile{
+		Bases:             p.Bases[:0],
+		Quals:             p.Quals[:0],
+		InsertSizeLPs:     p.InsertSizeLPs[:0],
+		InsertSizeRMs:     p.InsertSizeRMs[:0],
+		GC:                p.GC[:0],
+		Duplicity:         p.Duplicity[:0],
+		SplitterPositions: p.SplitterPositions[:0],
+		splitterOpposite:  p.splitterOpposite[:0],
+		ReadBases:         p.ReadBases[:0],
 	}
-	return fmt.Sprintf("%s\t%d\t%d\t%c\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%.2f\t%d\t%d\t%.2f\t%.2f\t%s",
-		p.Chrom,
-		p.Pos+1, p.Depth, p.RefBase, p.MisMatches,
-		p.ProperPairs, p.SoftStarts, p.SoftEnds,
-		p.HardStarts, p.HardEnds, p.InsertionStarts, p.InsertionEnds, p.Deletions,
-		//p.Heads, p.Tails,
-		p.Splitters,
-		p.Splitters1,
-		// string(p.RefBase), string(p.Bases), string(formatQual(p.Quals)),
-		mean(p.InsertSizeLPs),
-		mean(p.InsertSizeRMs),
-		p.OrientationPlusPlus+p.OrientationMinusPlus+p.OrientationMinusMinus+p.OrientationSplitter,
-		p.Discordant,
-		p.DiscordantChrom,
-		p.DiscordantChromEntropy,
-		p.GC65,
-		p.GC257,
-		p.Duplicity65,
-		p.Duplicity257,
-		spl,
-	)
+}
+
+// Clone returns a copy of the Pile that shares no memory with the original.
+func (p *Pile) Clone() *Pile {
+	c := *p
+	c.Bases = append([]byte(nil), p.Bases...)
+	c.Quals = append([]uint8(nil), p.Quals...)
+	c.InsertSizeLPs = append([]int32(nil), p.InsertSizeLPs...)
+	c.InsertSizeRMs = append([]int32(nil), p.InsertSizeRMs...)
+	c.GC = append([]uint32(nil), p.GC...)
+	c.Duplicity = append([]float32(nil), p.Duplicity...)
+	c.SplitterPositions = append([]Position(nil), p.SplitterPositions...)
+	c.splitterOpposite = append([]bool(nil), p.splitterOpposite...)
+	c.ReadBases = append([]byte(nil), p.ReadBases...)
+	return &c
+}
+
+// copyFrom sets p to a copy of q, reusing the memory for the slices of p.
+func (p *Pile) copyFrom(q *Pile) {
+	c := *q
+	c.Bases = append(p.Bases[:0], q.Bases...)
+	c.Quals = append(p.Quals[:0], q.Quals...)
+	c.InsertSizeLPs = append(p.InsertSizeLPs[:0], q.InsertSizeLPs...)
+	c.InsertSizeRMs = append(p.InsertSizeRMs[:0], q.InsertSizeRMs...)
+	c.GC = append(p.GC[:0], q.GC...)
+	c.Duplicity = append(p.Duplicity[:0], q.Duplicity...)
+	c.SplitterPositions = append(p.SplitterPositions[:0], q.SplitterPositions...)
+	c.splitterOpposite = append(p.splitterOpposite[:0], q.splitterOpposite...)
+	c.ReadBases = append(p.ReadBases[:0], q.ReadBases...)
+	*p = c
 }
 
 func abs(a int) int {
@@ -165,11 +207,90 @@ func abs(a int) int {
 	return a
 }
 
+// readInfo holds the values from an alignment that are the same at every position
+// that it covers.
+type readInfo struct {
+	properPair  bool
+	discordant  bool
+	discChrom   bool
+	mateRef     int
+	insertLP    int32 // 0 unless this is the left-most of a pair on the same chrom.
+	insertRM    int32 // 0 unless this is the right-most of a pair on the same chrom.
+	orientation uint8 // 0: none, 1: +/+, 2: -/-, 3: -/+
+	splitter    bool
+	splitter1   bool
+	// SA positions, whether each is on a different strand than the read, and whether any is.
+	splitters           []Position
+	splitterOpposite    []bool
+	orientationSplitter bool
+	// used for the mpileup read bases.
+	reverse bool
+	mapq    uint8
+}
+
+func (ri *readInfo) set(o Options, a *Align) {
+	*ri = readInfo{}
+	if o.work&workReadBases != 0 {
+		ri.reverse = a.Flags&sam.Reverse == sam.Reverse
+		ri.mapq = a.MapQ
+	}
+	if o.work&workPairs != 0 && a.Flags&sam.Paired == sam.Paired {
+		ri.properPair = a.Flags&sam.ProperPair == sam.ProperPair
+		ri.discordant = abs(a.Start()-a.MatePos) > o.ConcordantCutoff
+		if a.MateRef.ID() != a.Ref.ID() {
+			ri.discChrom = true
+			ri.mateRef = a.MateRef.ID()
+		} else {
+			// same chromosome.
+			if a.Start() < a.MatePos && a.Flags&sam.Reverse != sam.Reverse {
+				ri.insertLP = int32(a.MatePos - a.Start())
+			} else if a.Start() > a.MatePos && a.Flags&sam.Reverse == sam.Reverse {
+				ri.insertRM = int32(float64(a.Start() - a.MatePos))
+			} else {
+				if a.Flags&sam.Reverse == sam.Reverse && a.Flags&sam.MateReverse == sam.MateReverse {
+					ri.orientation = 2
+				} else if 0 == a.Flags&sam.Reverse && 0 == a.Flags&sam.MateReverse {
+					ri.orientation = 1
+				} else {
+					ri.orientation = 3
+				}
+			}
+		}
+	}
+	if o.work&workSplitters != 0 && a.Flags&sam.Secondary == 0 {
+		if tags, ok := a.Record.Tag([]byte{'S', 'A'}); ok {
+			ri.splitter = true
+			ri.splitter1 = bytes.Count([]byte(tags), []byte{';'}) <= 1
+			if o.work&workSAs != 0 {
+				ri.setSplitters(o, tags, a.Strand() != -1)
+			}
+		}
+	}
+}
+
+// track the actual positions of the splitters and check the orientation.
+func (ri *readInfo) setSplitters(o Options, tags []byte, readStrand bool) {
+	if o.SplitterVerbosity == 0 {
+		return
+	}
+	sas := ParseSAs(tags)
+	for _, sa := range sas {
+		if sa.MapQ >= o.MinMappingQuality {
+			ri.splitters = append(ri.splitters, Position{Chrom: string(sa.Chrom), Start: sa.Pos, End: sa.End(), Strand: sa.Strand})
+			ri.splitterOpposite = append(ri.splitterOpposite, readStrand != sa.Strand)
+			if readStrand != sa.Strand {
+				// if there is an orientation change, we only want to count it once.
+				ri.orientationSplitter = true
+			}
+		}
+	}
+}
+
 // Update the Pile with info from the Alignment if it meets the requirements in Options
 func (p *Pile) Update(o Options, alns []*Align) {
-	// the Total values hold the sum of 1 / val so we can calc harmonic Mean
-	// with less susceptiblity to outliers.
+	o.prepare()
 	var discMates []int
+	var ri readInfo
 	for _, a := range alns {
 		if a.MapQ < o.MinMappingQuality {
 			continue
@@ -178,123 +299,118 @@ func (p *Pile) Update(o Options, alns []*Align) {
 		if s == nil || s.Qual < o.MinBaseQuality {
 			continue
 		}
-
-		if a.Flags&sam.Paired == sam.Paired {
-			if a.Flags&sam.ProperPair == sam.ProperPair {
-				p.ProperPairs++
-			}
-			if abs(a.Start()-a.MatePos) > o.ConcordantCutoff {
-				p.Discordant++
-			}
-			if a.MateRef.ID() != a.Ref.ID() {
-				p.DiscordantChrom++
-				discMates = append(discMates, a.MateRef.ID())
-			} else {
-				// same chromosome.
-				if a.Start() < a.MatePos && a.Flags&sam.Reverse != sam.Reverse {
-					p.InsertSizeLPs = append(p.InsertSizeLPs, int32(a.MatePos-a.Start()))
-				} else if a.Start() > a.MatePos && a.Flags&sam.Reverse == sam.Reverse {
-					p.InsertSizeRMs = append(p.InsertSizeRMs, int32(float64(a.Start()-a.MatePos)))
-				} else {
-					if a.Flags&sam.Reverse == sam.Reverse && a.Flags&sam.MateReverse == sam.MateReverse {
-						p.OrientationMinusMinus++
-					} else if 0 == a.Flags&sam.Reverse && 0 == a.Flags&sam.MateReverse {
-						p.OrientationPlusPlus++
-					} else {
-						p.OrientationMinusPlus++
-					}
-				}
-			}
-
+		ri.set(o, a)
+		discMates = p.add(o, &ri, s, discMates)
+		if s.Base != p.RefBase {
+			p.MisMatches++
 		}
-		if a.Flags&sam.Secondary == 0 {
-			if tags, ok := a.Record.Tag([]byte{'S', 'A'}); ok {
-				p.Splitters++
-				if bytes.Count([]byte(tags), []byte{';'}) <= 1 {
-					p.Splitters1++
-				}
+	}
+	p.finish(o, discMates)
+}
 
-				p.updateSplitters(o, tags, a.Strand() != -1)
-			}
+// add the contribution of a single alignment, summarized by ri and s. It returns discMates
+// with the mate's chromosome appended if the mate maps to a different chromosome.
+func (p *Pile) add(o Options, ri *readInfo, s *CigarSummary, discMates []int) []int {
+	if ri.properPair {
+		p.ProperPairs++
+	}
+	if ri.discordant {
+		p.Discordant++
+	}
+	if ri.discChrom {
+		p.DiscordantChrom++
+		if o.work&workEntropy != 0 {
+			discMates = append(discMates, ri.mateRef)
 		}
-
-		p.Depth++
-
-		switch s.Right.Type() {
-		case sam.CigarMatch:
-			break
-		case sam.CigarInsertion:
-			p.InsertionStarts++
-		case sam.CigarSoftClipped:
-			if s.Right.Len() >= o.MinClipLength {
-				p.SoftStarts++
-			}
-		case sam.CigarHardClipped:
-			if s.Right.Len() >= o.MinClipLength {
-				p.HardStarts++
-			}
+	}
+	if o.work&workInserts != 0 {
+		if ri.insertLP != 0 {
+			p.InsertSizeLPs = append(p.InsertSizeLPs, ri.insertLP)
+		} else if ri.insertRM != 0 {
+			p.InsertSizeRMs = append(p.InsertSizeRMs, ri.insertRM)
 		}
-
-		switch s.Left.Type() {
-		case sam.CigarMatch:
-			break
-		case sam.CigarInsertion:
-			p.InsertionEnds++
-		case sam.CigarSoftClipped:
-			if s.Left.Len() >= o.MinClipLength {
-				p.SoftEnds++
-			}
-		case sam.CigarHardClipped:
-			if s.Left.Len() >= o.MinClipLength {
-				p.HardEnds++
-			}
+	}
+	switch ri.orientation {
+	case 1:
+		p.OrientationPlusPlus++
+	case 2:
+		p.OrientationMinusMinus++
+	case 3:
+		p.OrientationMinusPlus++
+	}
+	if ri.splitter {
+		p.Splitters++
+		if ri.splitter1 {
+			p.Splitters1++
 		}
-
-		if s.Head {
-			p.Heads++
-		} else if s.Tail {
-			p.Tails++
+		p.SplitterPositions = append(p.SplitterPositions, ri.splitters...)
+		p.splitterOpposite = append(p.splitterOpposite, ri.splitterOpposite...)
+		if ri.orientationSplitter {
+			p.OrientationSplitter++
 		}
+	}
+
+	p.Depth++
 
-		if s.At.Type() == sam.CigarDeletion {
-			p.Deletions++
+	switch s.Right.Type() {
+	case sam.CigarMatch:
+		break
+	case sam.CigarInsertion:
+		p.InsertionStarts++
+	case sam.CigarSoftClipped:
+		if s.Right.Len() >= o.MinClipLength {
+			p.SoftStarts++
 		}
-		if o.IncludeBases {
-			p.Bases = append(p.Bases, s.Base)
-			p.Quals = append(p.Quals, s.Qual)
+	case sam.CigarHardClipped:
+		if s.Right.Len() >= o.MinClipLength {
+			p.HardStarts++
 		}
-		if s.Base != p.RefBase {
-			p.MisMatches++
+	}
+
+	switch s.Left.Type() {
+	case sam.CigarMatch:
+		break
+	case sam.CigarInsertion:
+		p.InsertionEnds++
+	case sam.CigarSoftClipped:
+		if s.Left.Len() >= o.MinClipLength {
+			p.SoftEnds++
+		}
+	case sam.CigarHardClipped:
+		if s.Left.Len() >= o.MinClipLength {
+			p.HardEnds++
 		}
 	}
 
-	if p.DiscordantChrom > 1 {
-		p.DiscordantChromEntropy = float32(entropy(discMates))
+	if s.Head {
+		p.Heads++
+	} else if s.Tail {
+		p.Tails++
 	}
-	// don't set this if we don't know the reference base.
-	if p.RefBase == 'N' {
-		p.MisMatches = 0
+
+	if s.At.Type() == sam.CigarDeletion {
+		p.Deletions++
 	}
+	if o.work&workBases != 0 {
+		p.Bases = append(p.Bases, s.Base)
+		p.Quals = append(p.Quals, s.Qual)
+	}
+	if o.work&workReadBases != 0 {
+		p.addReadBases(ri, s)
+	}
+	return discMates
 }
 
-// track the actual positions of the splitters and check the orientation.
-func (p *Pile) updateSplitters(o Options, tags []byte, readStrand bool) {
-	if o.SplitterVerbosity == 0 {
-		return
-	}
-	sas := ParseSAs(tags)
-	// if there is an orientation change, we only want to count it once.
-	var orientationChange bool
-	for _, sa := range sas {
-		if sa.MapQ >= o.MinMappingQuality {
-			p.SplitterPositions = append(p.SplitterPositions, Position{Chrom: string(sa.Chrom), Start: sa.Pos, End: sa.End(), Strand: sa.Strand})
-			if readStrand != sa.Strand {
-				orientationChange = true
-			}
-		}
+// finish sets the values that depend on all alignments at the position.
+func (p *Pile) finish(o Options, discMates []int) {
+	if p.DiscordantChrom > 1 && o.work&workEntropy != 0 {
+		p.DiscordantChromEntropy = float32(entropy(discMates))
 	}
-	if orientationChange {
-		p.OrientationSplitter++
+	// don't set this if we don't know the reference base.
+	if p.RefBase == 'N' {
+		p.MisMatches = 0
+	} else if o.work&workReadBases != 0 {
+		markRefBases(p.ReadBases, p.RefBase)
 	}
 }
 
@@ -328,20 +444,29 @@ type CigarSummary struct {
 
 // At returns the CigarOp for a particular genomic position of the given read.
 func (a *Align) At(pos0 int) *CigarSummary {
+	res := &CigarSummary{}
+	if !a.at(pos0, res) {
+		return nil
+	}
+	return res
+}
+
+// at fills res for the genomic position and reports whether the read covers it.
+func (a *Align) at(pos0 int, res *CigarSummary) bool {
 	if pos0+1 <= a.lastPos {
 		log.Fatal("can't use align on the same position or lower position's that previous calls")
 	}
 	a.lastPos = pos0 + 1
 	pos := a.Pos + a.CursorPos
 	if pos0 < pos || len(a.Cigar) == 0 {
-		return nil
+		return false
 	}
 
 	if a.Sequence == nil {
 		a.Sequence = a.Seq.Expand()
 	}
 
-	res := &CigarSummary{Left: a.Cigar[max(a.CursorCigar-1, 0)]}
+	*res = CigarSummary{Left: a.Cigar[max(a.CursorCigar-1, 0)]}
 	res.Head = pos0 == pos && a.CursorPos == 0
 
 	for _, co := range a.Cigar[a.CursorCigar:] {
@@ -385,7 +510,7 @@ func (a *Align) At(pos0 int) *CigarSummary {
 				res.Insertion = a.Sequence[readi+1 : readi+1+right.Len()]
 			}
 
-			return res
+			return true
 		}
 		res.Left = co
 		a.CursorCigar++
@@ -393,5 +518,5 @@ func (a *Align) At(pos0 int) *CigarSummary {
 		a.CursorRead += lq
 		pos += lr
 	}
-	return nil
+	return false
 }
@@ -1,6 +1,8 @@
 package bigly_test
 
 import (
+	"path/filepath"
+	"strconv"
 	"testing"
 
 	"github.com/biogo/hts/sam"
@@ -143,3 +145,101 @@ func (t *PileTest) TestIndelBases(c *C) {
 	c.Assert(cig.At.Type(), Equals, sam.CigarDeletion)
 	c.Assert(cig.Base, Equals, byte('*'))
 }
+
+func (t *PileTest) TestResetClone(c *C) {
+	opts := bigly.Options{IncludeBases: true, SplitterVerbosity: 2}
+	p := update(c, opts, precords, 9)
+	c.Assert(p.Depth, Equals, 3)
+	cl := p.Clone()
+	c.Assert(cl, DeepEquals, p)
+
+	bases := p.Bases
+	p.Reset()
+	c.Assert(p.Depth, Equals, 0)
+	c.Assert(len(p.Bases), Equals, 0)
+	c.Assert(cap(p.Bases), Equals, cap(bases))
+	c.Assert(cl.Depth, Equals, 3)
+	c.Assert(string(cl.Bases), Equals, "GGG")
+}
+
+func benchmarkPiles(b *testing.B, reuse bool) {
+	opts := bigly.Options{IncludeBases: true, SplitterVerbosity: 2}
+	opts.Prepare()
+	alns := make([]bigly.Align, len(precords))
+	ptrs := make([]*bigly.Align, len(precords))
+	seqs := make([][]byte, len(precords))
+	for i, r := range precords {
+		seqs[i] = r.Seq.Expand()
+		ptrs[i] = &alns[i]
+	}
+	p := &bigly.Pile{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, r := range precords {
+			alns[j] = bigly.Align{Record: r, Sequence: seqs[j]}
+		}
+		for pos := 0; pos < 45; pos++ {
+			if reuse {
+				p.Reset()
+			} else {
+				p = &bigly.Pile{}
+			}
+			p.Chrom, p.Pos = "ref", pos
+			p.Update(opts, ptrs)
+		}
+	}
+}
+
+func BenchmarkPileNew(b *testing.B)   { benchmarkPiles(b, false) }
+func BenchmarkPileReuse(b *testing.B) { benchmarkPiles(b, true) }
+
+// benchBam writes an indexed bam of 100bp reads tiled every 5 bases along a 16kb reference.
+// The reference is kept within one 16kb index tile as hts can't index reads that cross into
+// a new tile when every earlier tile is covered.
+func benchBam(b *testing.B) string {
+	ref, _ := sam.NewReference("ref", "", "", 16000, nil, nil)
+	h, _ := sam.NewHeader(nil, []*sam.Reference{ref})
+	seq := make([]byte, 100)
+	qual := make([]byte, 100)
+	for i := range seq {
+		seq[i], qual[i] = "ACGT"[i%4], 30
+	}
+	var recs []*sam.Record
+	for pos := 0; pos+100 < ref.Len(); pos += 5 {
+		recs = append(recs, &sam.Record{Name: "r" + strconv.Itoa(pos), Ref: ref, Pos: pos, MapQ: 60,
+			Cigar: []sam.CigarOp{sam.NewCigarOp(sam.CigarMatch, 100)},
+			Flags: sam.Paired | sam.ProperPair | sam.MateReverse | sam.Read1, MateRef: ref, MatePos: pos + 200, TempLen: 300,
+			Seq: sam.NewSeq(seq), Qual: qual})
+	}
+	path := filepath.Join(b.TempDir(), "bench.bam")
+	if err := bigly.WriteIndexedBam(path, h, recs); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+func benchmarkIterator(b *testing.B, reuse bool) {
+	path := benchBam(b)
+	opts := bigly.Options{IncludeBases: true, ReusePile: reuse}
+	it := bigly.Up(path, opts, bigly.Position{Chrom: "ref", Start: 0, End: 16000}, nil)
+	if err := it.Error(); err != nil {
+		b.Fatal(err)
+	}
+	defer it.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := it.Seek(bigly.Position{Chrom: "ref", Start: 0, End: 16000}); err != nil {
+			b.Fatal(err)
+		}
+		for it.Next() {
+		}
+		if err := it.Error(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIteratorNew(b *testing.B)   { benchmarkIterator(b, false) }
+func BenchmarkIteratorReuse(b *testing.B) { benchmarkIterator(b, true) }
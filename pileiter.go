@@ -1,11 +1,10 @@
 package bigly
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"math"
-	"os"
 	"strconv"
 
 	"github.com/biogo/hts/bam"
@@ -26,23 +25,34 @@ type Iterator struct {
 	err   error
 	// pile gets created and set on each call to Next()
 	pile *Pile
-	opts Options
+	// with Options.ReusePile, spare is reset and returned from each call to Next()
+	spare *Pile
+	opts  Options
 	// track current genomic position
 	pos int
 	// hold all the alignments we (might) need to look at given the current pos
-	cache   []*Align
+	cache []*Align
+	// alignments are decoded once as they are added to the cache unless Options.PerPosition is set.
+	sweep   *sweep
 	hasMore bool
 	end     int
 	fai     *faidx.Faidx
-	gcs     [2]*faidx.FaPos
+	// the reference sequence near pos and the GC windows that slide along it.
+	seq     *refSeq
+	windows []*refWindow
+	// last record seen, used to check that input is sorted.
+	seen     bool
+	lastRef  *sam.Reference
+	lastPos  int
+	lastName string
 }
 
 // Position is a chrom, start, end (0-based, half-open)
 type Position struct {
-	Chrom  string
-	Start  int
-	End    int
-	Strand bool // + == True
+	Chrom  string `json:"chrom"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Strand bool   `json:"strand"` // + == True
 }
 
 func (p Position) String() string {
@@ -50,47 +60,76 @@ func (p Position) String() string {
 }
 
 // AtUp performs the pileup given a BamAt object.
+// The BamAt is not closed if there is an error; use Iterator.Close for that.
 func AtUp(b *bamat.BamAt, opts Options, pos Position, fai *faidx.Faidx) *Iterator {
-	if pos.End < 0 && pos.Start < 0 {
+	if err := opts.Prepare(); err != nil {
+		return &Iterator{bamat: b, err: err}
+	}
+	if so := b.Header().SortOrder; so == sam.Unsorted || so == sam.QueryName {
+		return &Iterator{bamat: b, err: fmt.Errorf("bigly: input must be coordinate-sorted. header has SO:%s", so)}
+	}
+	it := &Iterator{bamat: b, opts: opts, fai: fai, cache: make([]*Align, 0, 32)}
+	it.Seek(pos)
+	return it
+}
+
+// Seek moves the Iterator to a new position so that the next call to Next returns the
+// first pile in pos. A pos without a Chrom is the whole bam. The open bam, index and
+// fasta are reused. Any error is also available from Error.
+// When reading from stdin, the iterator can not go back to earlier records.
+func (it *Iterator) Seek(pos Position) error {
+	b := it.bamat
+	if b == nil {
+		// Up could not open the bam and the error is kept.
+		if it.err == nil {
+			it.err = errors.New("bigly: no bam is open")
+		}
+		return it.err
+	}
+	if pos.Chrom != "" && b.Refs[pos.Chrom] == nil {
+		it.err = fmt.Errorf("bigly: chromosome %s not found in bam header", pos.Chrom)
+		return it.err
+	}
+	if pos.Chrom == "" || pos.End < 0 && pos.Start < 0 {
 		pos.Start = 0
 		pos.End = int(math.MaxUint32)
 	} else if pos.End <= 0 {
 		pos.End = b.Refs[pos.Chrom].Len() - 1
 	}
-	bit, err := b.Query(pos.Chrom, pos.Start, pos.End)
-	if err != nil {
-		b.Close()
-		return &Iterator{err: err}
+	if it.bit != nil {
+		it.bit.Close()
+		it.bit = nil
+	}
+	for i := range it.cache {
+		it.cache[i] = nil
 	}
+	it.cache = it.cache[:0]
+	it.pile, it.err, it.seen = nil, nil, false
+	it.pos, it.chrom, it.end, it.hasMore = pos.Start, pos.Chrom, pos.End, true
 
-	it := &Iterator{bit: bit, bamat: b, pos: pos.Start, chrom: pos.Chrom, opts: opts, hasMore: true, end: pos.End}
-	it.cache = make([]*Align, 0, 32)
+	if it.bit, it.err = b.Query(pos.Chrom, pos.Start, pos.End); it.err != nil {
+		return it.err
+	}
+	if !it.opts.PerPosition {
+		it.sweep = newSweep(it.pos)
+	}
+	if it.fai != nil {
+		var clen int
+		if ref := b.Refs[pos.Chrom]; ref != nil {
+			clen = ref.Len()
+		}
+		it.seq = newRefSeq(it.fai, pos.Chrom, clen, it.opts.gcWindows())
+		it.windows = newRefWindows(it.opts.gcWindows())
+	}
 
 	// prime the cache and potentially advance it to the start of the first read.
-	for bit.Next() {
-		fmt.Fprintln(os.Stderr, "next")
-		rec := it.bit.Record()
-		if !passes(rec, opts) {
-			continue
-		}
-		it.cache = append(it.cache, &Align{Record: rec})
+	if rec := it.nextRecord(); rec != nil {
+		it.push(rec)
 		if it.cache[0].Start() > it.pos {
 			it.pos = it.cache[0].Start()
 		}
-		break
 	}
-	if bit.Error() != nil {
-		log.Fatal(err)
-	}
-	if fai != nil {
-		it.fai = fai
-		it.gcs = [2]*faidx.FaPos{
-			&faidx.FaPos{Chrom: pos.Chrom}, // 65
-			&faidx.FaPos{Chrom: pos.Chrom}, // 256
-		}
-	}
-
-	return it
+	return it.Error()
 }
 
 // Up performs the pileup given a path to a bam
@@ -99,7 +138,12 @@ func Up(bampath string, opts Options, pos Position, fai *faidx.Faidx) *Iterator
 	if err != nil {
 		return &Iterator{err: err}
 	}
-	return AtUp(b, opts, pos, fai)
+	it := AtUp(b, opts, pos, fai)
+	if it.Error() != nil {
+		b.Close()
+		it.bamat = nil
+	}
+	return it
 }
 
 // Error returns any error encountered by the Iterator
@@ -117,7 +161,85 @@ func passes(r *sam.Record, o Options) bool {
 	if uint16(r.Flags)&o.ExcludeFlag != 0 {
 		return false
 	}
-	return r.MapQ >= o.MinMappingQuality
+	if r.MapQ < o.MinMappingQuality {
+		return false
+	}
+	for _, f := range o.Filters {
+		if !f(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// nextRecord returns the next record from the bam that passes the filters.
+// It returns nil when the bam is exhausted or on error, including when the
+// records are not in coordinate order.
+func (it *Iterator) nextRecord() *sam.Record {
+	for it.bit.Next() {
+		rec := it.bit.Record()
+		if it.err = it.checkOrder(rec); it.err != nil {
+			return nil
+		}
+		if passes(rec, it.opts) {
+			return rec
+		}
+	}
+	it.err = it.bit.Error()
+	return nil
+}
+
+// eachRead calls fn for each read from the bam that passes the Options and overlaps pos,
+// without piling them up, or for each read if pos has no Chrom. Like Seek, it moves the
+// Iterator so Seek must be called before Next.
+func (it *Iterator) eachRead(pos Position, fn func(*sam.Record)) error {
+	if err := it.Seek(pos); err != nil {
+		return err
+	}
+	start := pos.Start
+	if pos.Chrom == "" {
+		start = math.MinInt
+	}
+	// Seek has put the first read in the cache.
+	for _, a := range it.cache {
+		if a.Start() < it.end && a.End() > start {
+			fn(a.Record)
+		}
+	}
+	it.cache = it.cache[:0]
+	for rec := it.nextRecord(); rec != nil; rec = it.nextRecord() {
+		if rec.Start() >= it.end {
+			break
+		}
+		if rec.End() > start {
+			fn(rec)
+		}
+	}
+	it.pos = it.end
+	return it.Error()
+}
+
+// checkOrder returns an error if rec precedes the previous record.
+// Records without a reference (unplaced) must come last.
+func (it *Iterator) checkOrder(rec *sam.Record) error {
+	if it.seen {
+		last, cur := it.lastRef.ID(), rec.Ref.ID()
+		if last < 0 && cur >= 0 || cur >= 0 && (cur < last || cur == last && rec.Pos < it.lastPos) {
+			return fmt.Errorf("bigly: input is not coordinate-sorted: %s at %s:%d follows %s at %s:%d",
+				rec.Name, rec.Ref.Name(), rec.Pos+1, it.lastName, it.lastRef.Name(), it.lastPos+1)
+		}
+	}
+	it.seen, it.lastRef, it.lastPos, it.lastName = true, rec.Ref, rec.Pos, rec.Name
+	return nil
+}
+
+// push adds the record to the cache.
+func (it *Iterator) push(rec *sam.Record) {
+	a := &Align{Record: rec}
+	it.cache = append(it.cache, a)
+	if it.sweep != nil {
+		it.sweep.add(it.opts, a)
+	}
 }
 
 // Next returns true as long as any remaning pileups are available.
@@ -148,27 +270,33 @@ func (it *Iterator) Next() bool {
 	// is greater than the current position.
 	hasMore := true
 	for len(it.cache) == 0 || it.cache[len(it.cache)-1].Start() <= it.pos {
-		if it.bit.Next() {
-			rec := it.bit.Record()
-			if !passes(rec, it.opts) {
-				continue
-			}
-			it.cache = append(it.cache, &Align{Record: rec})
-		} else {
+		rec := it.nextRecord()
+		if rec == nil {
 			hasMore = false
-			it.err = it.bit.Error()
 			break
 		}
+		it.push(rec)
 	}
 	if len(it.cache) == 0 && !hasMore {
 		return false
 	}
 	if it.err == nil {
-		it.pile = &Pile{Chrom: it.chrom, Pos: it.pos, RefBase: 'N'}
+		it.pile = it.newPile()
+		if it.sweep != nil {
+			it.sweep.next(it.pos, it.pile)
+		}
+		it.pile.Chrom, it.pile.Pos, it.pile.RefBase = it.chrom, it.pos, 'N'
 		if it.fai != nil {
-			it.faiUpdate()
+			if it.err = it.faiUpdate(); it.err != nil {
+				it.pile = nil
+				return false
+			}
+		}
+		if it.sweep != nil {
+			it.sweep.finish(it.opts, it.pile)
+		} else {
+			it.pile.Update(it.opts, it.cache)
 		}
-		it.pile.Update(it.opts, it.cache)
 		it.pos++
 		// skip missing regions.
 		if it.pile.Depth == 0 && len(it.cache) > 0 && it.cache[0].Start() > it.pos {
@@ -181,26 +309,49 @@ func (it *Iterator) Next() bool {
 }
 
 // update the stuff that relies on a fasta.
-func (it *Iterator) faiUpdate() {
-	it.gcs[0].Start, it.gcs[0].End = it.pos-32, it.pos+32
-	it.gcs[1].Start, it.gcs[1].End = it.pos-128, it.pos+128
+func (it *Iterator) faiUpdate() error {
 	var err error
-	it.pile.GC65, err = it.fai.Q(it.gcs[0])
-	if err != nil {
-		log.Fatal(err)
+	if it.pile.RefBase, err = it.fai.At(it.chrom, it.pos); err != nil {
+		return err
 	}
-	it.pile.GC257, err = it.fai.Q(it.gcs[1])
-	if err != nil {
-		log.Fatal(err)
+	if it.opts.work&workGC == 0 {
+		return nil
+	}
+	for _, w := range it.windows {
+		if err = w.move(it.pos, it.seq); err != nil {
+			return err
+		}
+		it.pile.GC = append(it.pile.GC, uint32(w.gc))
+		it.pile.Duplicity = append(it.pile.Duplicity, w.duplicity())
 	}
-	it.pile.RefBase, err = it.fai.At(it.chrom, it.pos)
-	it.pile.Duplicity65 = it.gcs[0].Duplicity()
-	it.pile.Duplicity257 = it.gcs[1].Duplicity()
+	return nil
+}
+
+// newPile returns an empty Pile. With Options.ReusePile, it is the same Pile each time.
+func (it *Iterator) newPile() *Pile {
+	if !it.opts.ReusePile {
+		return &Pile{}
+	}
+	if it.spare == nil {
+		it.spare = &Pile{}
+	}
+	it.spare.Reset()
+	return it.spare
 }
 
 // Pile returns the next pile from the iterator.
+// If Options.ReusePile is set, the same Pile, including the memory for its slices,
+// is reused by each call to Next so the caller must use Clone to keep it.
 func (it *Iterator) Pile() *Pile { return it.pile }
 
+// Header returns the header of the bam or nil if it could not be opened.
+func (it *Iterator) Header() *sam.Header {
+	if it.bamat == nil {
+		return nil
+	}
+	return it.bamat.Header()
+}
+
 // Close the underlying bam iterator and bam file.
 func (it *Iterator) Close() error {
 	it.bamat.Close()
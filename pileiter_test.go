@@ -0,0 +1,116 @@
+package bigly
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/sam"
+	"github.com/brentp/bigly/bamat"
+	. "gopkg.in/check.v1"
+)
+
+type IterTest struct{}
+
+var _ = Suite(&IterTest{})
+
+func (t *IterTest) TestCheckOrder(c *C) {
+	h, _ := sam.NewHeader(nil, nil)
+	chr1, _ := sam.NewReference("chr1", "", "", 1000, nil, nil)
+	chr2, _ := sam.NewReference("chr2", "", "", 1000, nil, nil)
+	h.AddReference(chr1)
+	h.AddReference(chr2)
+
+	it := &Iterator{}
+	c.Assert(it.checkOrder(&sam.Record{Name: "a", Ref: chr1, Pos: 10}), IsNil)
+	c.Assert(it.checkOrder(&sam.Record{Name: "b", Ref: chr1, Pos: 10}), IsNil)
+	c.Assert(it.checkOrder(&sam.Record{Name: "c", Ref: chr2, Pos: 5}), IsNil)
+
+	err := it.checkOrder(&sam.Record{Name: "d", Ref: chr2, Pos: 4})
+	c.Assert(err, NotNil)
+	c.Assert(strings.Contains(err.Error(), "d at chr2:5 follows c at chr2:6"), Equals, true)
+
+	it = &Iterator{}
+	c.Assert(it.checkOrder(&sam.Record{Name: "a", Ref: chr2, Pos: 10}), IsNil)
+	c.Assert(it.checkOrder(&sam.Record{Name: "b", Ref: chr1, Pos: 100}), NotNil)
+
+	// unplaced reads must be last.
+	it = &Iterator{}
+	c.Assert(it.checkOrder(&sam.Record{Name: "a", Ref: chr2, Pos: 10}), IsNil)
+	c.Assert(it.checkOrder(&sam.Record{Name: "u", Ref: nil, Pos: -1}), IsNil)
+	c.Assert(it.checkOrder(&sam.Record{Name: "v", Ref: nil, Pos: -1}), IsNil)
+	c.Assert(it.checkOrder(&sam.Record{Name: "b", Ref: chr2, Pos: 100}), NotNil)
+}
+
+func (t *IterTest) TestSeekUnknownChrom(c *C) {
+	chr1, _ := sam.NewReference("chr1", "", "", 1000, nil, nil)
+	it := &Iterator{bamat: &bamat.BamAt{Refs: map[string]*sam.Reference{"chr1": chr1}}}
+	err := it.Seek(Position{Chrom: "chrX", Start: 10, End: 20})
+	c.Assert(err, NotNil)
+	c.Assert(it.Error(), Equals, err)
+	c.Assert(it.Next(), Equals, false)
+}
+
+func (t *IterTest) TestSeekNoBam(c *C) {
+	it := Up(filepath.Join(c.MkDir(), "missing.bam"), Options{}, Position{Chrom: "chr1", Start: 10, End: 20}, nil)
+	err := it.Error()
+	c.Assert(err, NotNil)
+	c.Assert(it.Seek(Position{Chrom: "chr1", Start: 10, End: 20}), Equals, err)
+	_, err = it.Links(Position{Chrom: "chr1", Start: 10, End: 20})
+	c.Assert(err, NotNil)
+	c.Assert(it.Next(), Equals, false)
+
+	c.Assert((&Iterator{}).Seek(Position{Chrom: "chr1"}), ErrorMatches, "bigly: no bam is open")
+}
+
+// writeIndexedBam writes recs, which must be sorted, to a bam at path with a .bai index.
+func writeIndexedBam(path string, h *sam.Header, recs []*sam.Record) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h.SortOrder = sam.Coordinate
+	w, err := bam.NewWriter(f, h, 1)
+	if err != nil {
+		return err
+	}
+	for _, r := range recs {
+		if err = w.Write(r); err != nil {
+			return err
+		}
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	br, err := bam.NewReader(f, 1)
+	if err != nil {
+		return err
+	}
+	defer br.Close()
+	var idx bam.Index
+	for {
+		r, err := br.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err = idx.Add(r, br.LastChunk()); err != nil {
+			return err
+		}
+	}
+	bai, err := os.Create(path + ".bai")
+	if err != nil {
+		return err
+	}
+	defer bai.Close()
+	return bam.WriteIndex(bai, &idx)
+}
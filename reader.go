@@ -0,0 +1,136 @@
+package bigly
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Reader reads Piles from the TSV or JSON output of bigly.
+type Reader struct {
+	br   *bufio.Reader
+	opts Options
+	// format is set from the first line to 't' for TSV or 'j' for JSON.
+	format byte
+	line   int
+	pile   *Pile
+	spare  *Pile
+	err    error
+}
+
+// NewReader returns a Reader that reads piles from r. The format and, for TSV, the columns
+// are taken from the header. opts gives the columns of TSV output that has no header and,
+// with Options.ReusePile, the same Pile is returned by every call to Pile.
+func NewReader(r io.Reader, opts Options) (*Reader, error) {
+	if err := opts.Prepare(); err != nil {
+		return nil, err
+	}
+	return &Reader{br: bufio.NewReader(r), opts: opts}, nil
+}
+
+// Next reads the next Pile and returns false at the end of the input or on error.
+func (r *Reader) Next() bool {
+	r.pile = nil
+	if r.err != nil {
+		return false
+	}
+	for {
+		line, err := r.br.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			r.err = err
+			return false
+		}
+		r.line++
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			continue
+		}
+		if r.format == 0 {
+			r.format = 't'
+			if line[0] == '{' {
+				r.format = 'j'
+			}
+		}
+		if r.format == 't' && line[0] == '#' {
+			o, err := namedOptions(strings.Split(line[1:], "\t"))
+			if err != nil {
+				r.err = fmt.Errorf("bigly: line %d: %s", r.line, err)
+				return false
+			}
+			o.ReusePile = r.opts.ReusePile
+			r.opts = o
+			continue
+		}
+		p := r.newPile()
+		if r.format == 'j' {
+			r.err = p.UnmarshalJSON([]byte(line))
+		} else {
+			r.err = p.parseTab(line, r.opts)
+		}
+		if r.err != nil {
+			r.err = fmt.Errorf("bigly: line %d: %s", r.line, r.err)
+			return false
+		}
+		r.pile = p
+		return true
+	}
+}
+
+func (r *Reader) newPile() *Pile {
+	if !r.opts.ReusePile {
+		return &Pile{}
+	}
+	if r.spare == nil {
+		r.spare = &Pile{}
+	}
+	r.spare.Reset()
+	return r.spare
+}
+
+// Options returns the Options for the columns that are read. They are taken from the
+// header, if there is one, when Next is first called.
+func (r *Reader) Options() Options { return r.opts }
+
+// Pile returns the Pile read by the last call to Next.
+func (r *Reader) Pile() *Pile { return r.pile }
+
+// Error returns any error encountered by the Reader.
+func (r *Reader) Error() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
+
+// parseTab sets p from a line written by TabString with the same Options.
+// Fields that are not in the line are left as they are.
+func (p *Pile) parseTab(line string, o Options) error {
+	if err := o.prepare(); err != nil {
+		return err
+	}
+	toks := strings.Split(line, "\t")
+	if len(toks) != len(o.cols) {
+		return fmt.Errorf("expected %d columns, got %d", len(o.cols), len(toks))
+	}
+	return setColumns(p, o.cols, func(c Column, i int) error {
+		if c.parse == nil {
+			return nil
+		}
+		return c.parse(p, toks[i])
+	})
+}
+
+// ParseTab returns the Pile from a line written by TabString with the same Options.
+// Values that are summaries, like the mean insert sizes, are set so that TabString gives the
+// same line.
+func ParseTab(line string, o Options) (*Pile, error) {
+	if err := o.prepare(); err != nil {
+		return nil, err
+	}
+	p := &Pile{}
+	if err := p.parseTab(line, o); err != nil {
+		return nil, fmt.Errorf("bigly: %s", err)
+	}
+	return p, nil
+}
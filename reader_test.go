@@ -0,0 +1,122 @@
+package bigly_test
+
+import (
+	"strings"
+
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type ReaderTest struct{}
+
+var _ = Suite(&ReaderTest{})
+
+func (t *ReaderTest) TestParseTab(c *C) {
+	for _, v := range []int{0, 1, 2, 3} {
+		o := bigly.Options{SplitterVerbosity: v}
+		line := tpile.TabString(o)
+		p, err := bigly.ParseTab(line, o)
+		c.Assert(err, IsNil)
+		c.Assert(p.TabString(o), Equals, line, Commentf("verbosity: %d", v))
+	}
+
+	o := bigly.Options{SplitterVerbosity: 2}
+	p, err := bigly.ParseTab(tpile.TabString(o), o)
+	c.Assert(err, IsNil)
+	c.Assert(p.SplitterPositions, DeepEquals, tpile.SplitterPositions)
+	c.Assert(p.GC, DeepEquals, tpile.GC)
+
+	o = bigly.Options{Fields: []string{"pos,bases,quals,heads"}}
+	c.Assert(o.Prepare(), IsNil)
+	p, err = bigly.ParseTab(tpile.TabString(o), o)
+	c.Assert(err, IsNil)
+	c.Assert(p.Pos, Equals, 99)
+	c.Assert(string(p.Bases), Equals, "ACGT")
+	c.Assert(p.Quals, DeepEquals, tpile.Quals)
+	c.Assert(p.Heads, Equals, uint32(13))
+
+	_, err = bigly.ParseTab("chr1\t100", o)
+	c.Assert(err, NotNil)
+	_, err = bigly.ParseTab("x\tACGT\t?@AB\t13", o)
+	c.Assert(err, NotNil)
+}
+
+func (t *ReaderTest) TestSplitterSummary(c *C) {
+	// every summary is read back to positions that give the same summary.
+	for _, s := range []string{"10/1/1", "10/2/1", "5/3/2", "7/1/3", "7/6/3"} {
+		o := bigly.Options{SplitterVerbosity: 1, Fields: []string{"splitterpositions"}}
+		c.Assert(o.Prepare(), IsNil)
+		p, err := bigly.ParseTab(s, o)
+		c.Assert(err, IsNil)
+		c.Assert(p.TabString(o), Equals, s)
+		// no positions are made up from the summary.
+		c.Assert(p.SplitterPositions, HasLen, 0)
+		o2 := bigly.Options{SplitterVerbosity: 2, Fields: []string{"splitterpositions"}}
+		c.Assert(o2.Prepare(), IsNil)
+		c.Assert(p.TabString(o2), Equals, s)
+		q := &bigly.Pile{}
+		c.Assert(q.UnmarshalJSON([]byte(p.JSONString(o2))), IsNil)
+		c.Assert(q.TabString(o), Equals, s)
+	}
+
+	// the columns of a Reader come from the header and the summary is written as it was read.
+	input := "#chrom\tpos\tsplitterpositions\nchr1\t10\t10/2/3\nchr1\t11\t\n"
+	r, err := bigly.NewReader(strings.NewReader(input), bigly.Options{})
+	c.Assert(err, IsNil)
+	var out []string
+	for r.Next() {
+		c.Assert(r.Pile().SplitterPositions, HasLen, 0)
+		out = append(out, r.Pile().TabString(r.Options()))
+	}
+	c.Assert(r.Error(), IsNil)
+	c.Assert(out, DeepEquals, []string{"chr1\t10\t10/2/3", "chr1\t11\t"})
+
+	o := bigly.Options{SplitterVerbosity: 1, Fields: []string{"splitterpositions"}}
+	_, err = bigly.ParseTab("7/7/3", o)
+	c.Assert(err, NotNil)
+}
+
+func (t *ReaderTest) TestReader(c *C) {
+	o := bigly.Options{SplitterVerbosity: 2, GCWindows: []int{101}}
+	c.Assert(o.Prepare(), IsNil)
+	p2 := tpile.Clone()
+	p2.Pos, p2.SplitterPositions = 100, nil
+	input := o.Header() + "\n" + tpile.TabString(o) + "\n" + p2.TabString(o) + "\n"
+
+	// the columns come from the header, not the options.
+	r, err := bigly.NewReader(strings.NewReader(input), bigly.Options{ReusePile: true})
+	c.Assert(err, IsNil)
+	var lines []string
+	for r.Next() {
+		lines = append(lines, r.Pile().TabString(o))
+	}
+	c.Assert(r.Error(), IsNil)
+	c.Assert(lines, DeepEquals, strings.Split(strings.TrimSuffix(input, "\n"), "\n")[1:])
+
+	// without a header.
+	r, err = bigly.NewReader(strings.NewReader(tpile.TabString(o)), o)
+	c.Assert(err, IsNil)
+	c.Assert(r.Next(), Equals, true)
+	c.Assert(r.Pile().TabString(o), Equals, tpile.TabString(o))
+	c.Assert(r.Next(), Equals, false)
+	c.Assert(r.Error(), IsNil)
+
+	// json lines.
+	input = tpile.JSONString(o) + "\n\n" + p2.JSONString(o) + "\n"
+	r, err = bigly.NewReader(strings.NewReader(input), bigly.Options{})
+	c.Assert(err, IsNil)
+	var piles []*bigly.Pile
+	for r.Next() {
+		piles = append(piles, r.Pile())
+	}
+	c.Assert(r.Error(), IsNil)
+	c.Assert(piles, HasLen, 2)
+	c.Assert(piles[0].TabString(o), Equals, tpile.TabString(o))
+	c.Assert(piles[1].Pos, Equals, 100)
+
+	r, err = bigly.NewReader(strings.NewReader("#pos\tdepth\n1\t2\n2\tx\n"), bigly.Options{})
+	c.Assert(err, IsNil)
+	c.Assert(r.Next(), Equals, true)
+	c.Assert(r.Next(), Equals, false)
+	c.Assert(r.Error(), ErrorMatches, "bigly: line 3: bad value for depth.*")
+}
@@ -0,0 +1,173 @@
+package bigly
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Interval is a stretch of consecutive positions on a chromosome where the selected fields
+// have the same values.
+type Interval struct {
+	Chrom string
+	// Start and End are 0-based, half-open.
+	Start, End int
+	// Pile holds the values for the first position in the run.
+	Pile *Pile
+
+	r *Runs
+}
+
+// Runs merges consecutive piles into Intervals. Fields are compared by their text in the output
+// unless they have a tolerance.
+type Runs struct {
+	opts Options
+	cols []Column
+	// tol is the tolerance for each column or 0 to compare the text.
+	tol []float64
+	// the text and, for columns with a tolerance, the value of each column for the first pile
+	// in the current run.
+	text  [][]byte
+	vals  []float64
+	buf   []byte
+	run   Interval
+	spare Interval
+	open  bool
+}
+
+// NewRuns returns Runs that compare the fields in o other than chrom and pos. tolerance gives
+// the amount that numeric fields can differ from the first value in a run, e.g.
+// {"depth": 2}. The Options must compute the same fields as those for the pileup.
+func NewRuns(o Options, tolerance map[string]float64) (*Runs, error) {
+	if err := o.Prepare(); err != nil {
+		return nil, err
+	}
+	r := &Runs{opts: o, run: Interval{Pile: &Pile{}}, spare: Interval{Pile: &Pile{}}}
+	found := 0
+	for _, c := range o.cols {
+		if c.Name == "chrom" || c.Name == "pos" {
+			continue
+		}
+		t, ok := tolerance[c.Name]
+		if ok {
+			found++
+			if c.Type == "string" {
+				return nil, fmt.Errorf("bigly: column %s is not numeric", c.Name)
+			}
+			if t < 0 {
+				return nil, fmt.Errorf("bigly: tolerance for %s must not be negative", c.Name)
+			}
+		}
+		r.cols = append(r.cols, c)
+		r.tol = append(r.tol, t)
+	}
+	if found != len(tolerance) {
+		return nil, fmt.Errorf("bigly: tolerance given for a field that is not in the output")
+	}
+	r.text = make([][]byte, len(r.cols))
+	r.vals = make([]float64, len(r.cols))
+	r.run.r, r.spare.r = r, r
+	return r, nil
+}
+
+// ParseTolerances parses tolerances like "depth=2" or "depth=2,meaninsertsizelp=50".
+func ParseTolerances(ts []string) (map[string]float64, error) {
+	m := make(map[string]float64)
+	for _, t := range ts {
+		for _, kv := range strings.Split(t, ",") {
+			if kv = strings.TrimSpace(kv); kv == "" {
+				continue
+			}
+			i := strings.IndexByte(kv, '=')
+			if i < 0 {
+				return nil, fmt.Errorf("bigly: expected field=tolerance, got %s", kv)
+			}
+			v, err := strconv.ParseFloat(kv[i+1:], 64)
+			if err != nil {
+				return nil, fmt.Errorf("bigly: bad tolerance %s: %s", kv, err)
+			}
+			m[kv[:i]] = v
+		}
+	}
+	return m, nil
+}
+
+// matches reports whether p can extend the current run.
+func (r *Runs) matches(p *Pile) bool {
+	if !r.open || p.Chrom != r.run.Chrom || p.Pos != r.run.End {
+		return false
+	}
+	for i, c := range r.cols {
+		r.buf = c.format(r.buf[:0], p, r.opts)
+		if r.tol[i] == 0 {
+			if !bytes.Equal(r.buf, r.text[i]) {
+				return false
+			}
+			continue
+		}
+		v, err := strconv.ParseFloat(string(r.buf), 64)
+		if err != nil || math.Abs(v-r.vals[i]) > r.tol[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Add adds the next pile. Piles must be in order. If p ends the current run, that run is
+// returned. It is only valid until the next call to Add or Flush.
+func (r *Runs) Add(p *Pile) *Interval {
+	if r.matches(p) {
+		r.run.End++
+		return nil
+	}
+	var done *Interval
+	if r.open {
+		r.run, r.spare = r.spare, r.run
+		done = &r.spare
+	}
+	r.open = true
+	r.run.Chrom, r.run.Start, r.run.End = p.Chrom, p.Pos, p.Pos+1
+	r.run.Pile.copyFrom(p)
+	for i, c := range r.cols {
+		r.text[i] = c.format(r.text[i][:0], p, r.opts)
+		if r.tol[i] != 0 {
+			r.vals[i], _ = strconv.ParseFloat(string(r.text[i]), 64)
+		}
+	}
+	return done
+}
+
+// Flush returns the current run, if any, and starts again.
+func (r *Runs) Flush() *Interval {
+	if !r.open {
+		return nil
+	}
+	r.open = false
+	r.run, r.spare = r.spare, r.run
+	return &r.spare
+}
+
+// Header returns the names of the columns of AppendTab, prefixed with '#'.
+func (r *Runs) Header() string {
+	names := []string{"#chrom", "start", "end"}
+	for _, c := range r.cols {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, "\t")
+}
+
+// AppendTab appends the chrom, the 0-based start and end and the values of the fields to b.
+func (run *Interval) AppendTab(b []byte) []byte {
+	b = append(b, run.Chrom...)
+	b = append(b, '\t')
+	b = strconv.AppendInt(b, int64(run.Start), 10)
+	b = append(b, '\t')
+	b = strconv.AppendInt(b, int64(run.End), 10)
+	for _, c := range run.r.cols {
+		b = append(b, '\t')
+		b = c.format(b, run.Pile, run.r.opts)
+	}
+	return b
+}
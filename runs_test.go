@@ -0,0 +1,61 @@
+package bigly_test
+
+import (
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type RunsTest struct{}
+
+var _ = Suite(&RunsTest{})
+
+func (t *RunsTest) TestRuns(c *C) {
+	o := bigly.Options{Fields: []string{"chrom,pos,depth,softstarts"}}
+	piles := []bigly.Pile{
+		{Chrom: "chr1", Pos: 10, Depth: 10},
+		{Chrom: "chr1", Pos: 11, Depth: 11},
+		{Chrom: "chr1", Pos: 12, Depth: 12},
+		{Chrom: "chr1", Pos: 13, Depth: 13},
+		{Chrom: "chr1", Pos: 14, Depth: 13, SoftStarts: 1},
+		// gap.
+		{Chrom: "chr1", Pos: 20, Depth: 13},
+		{Chrom: "chr2", Pos: 21, Depth: 13},
+	}
+	for _, tc := range []struct {
+		tol map[string]float64
+		exp []string
+	}{
+		{nil, []string{"chr1\t10\t11\t10\t0", "chr1\t11\t12\t11\t0", "chr1\t12\t13\t12\t0", "chr1\t13\t14\t13\t0",
+			"chr1\t14\t15\t13\t1", "chr1\t20\t21\t13\t0", "chr2\t21\t22\t13\t0"}},
+		// values are compared to the first in the run so that they don't drift.
+		{map[string]float64{"depth": 2}, []string{"chr1\t10\t13\t10\t0", "chr1\t13\t14\t13\t0",
+			"chr1\t14\t15\t13\t1", "chr1\t20\t21\t13\t0", "chr2\t21\t22\t13\t0"}},
+	} {
+		r, err := bigly.NewRuns(o, tc.tol)
+		c.Assert(err, IsNil)
+		c.Assert(r.Header(), Equals, "#chrom\tstart\tend\tdepth\tsoftstarts")
+		var got []string
+		for i := range piles {
+			if iv := r.Add(&piles[i]); iv != nil {
+				got = append(got, string(iv.AppendTab(nil)))
+			}
+		}
+		iv := r.Flush()
+		got = append(got, string(iv.AppendTab(nil)))
+		c.Assert(r.Flush(), IsNil)
+		c.Assert(got, DeepEquals, tc.exp)
+	}
+
+	_, err := bigly.NewRuns(o, map[string]float64{"chrom": 1})
+	c.Assert(err, NotNil)
+	_, err = bigly.NewRuns(o, map[string]float64{"discordant": 1})
+	c.Assert(err, ErrorMatches, ".*not in the output")
+}
+
+func (t *RunsTest) TestParseTolerances(c *C) {
+	m, err := bigly.ParseTolerances([]string{"depth=2,meaninsertsizelp=50", "softstarts=0.5"})
+	c.Assert(err, IsNil)
+	c.Assert(m, DeepEquals, map[string]float64{"depth": 2, "meaninsertsizelp": 50, "softstarts": 0.5})
+	_, err = bigly.ParseTolerances([]string{"depth"})
+	c.Assert(err, NotNil)
+}
@@ -38,8 +38,19 @@ def main(argv):
 def xopen(f):
     return gzip.open(f) if f.endswith(".gz") else open(f)
 
-header = "chrom pos depth refbase mismatches pairs softstarts softends hardstarts hardends insertstarts insertends deletions splitters splitters1 mean_insert1 mean_insert2 weird discordant discchrom discchromentropy gc65 gc257 duplicity65 duplicity257 spl"
-header = header.split()
+# the default columns. only used for output from older versions that have no header line.
+default_header = "chrom pos depth refbase mismatches properpairs softstarts softends hardstarts hardends insertionstarts insertionends deletions splitters splitters1 meaninsertsizelp meaninsertsizerm weird discordant discordantchrom discordantchromentropy gc65 gc257 duplicity65 duplicity257 splitterpositions".split()
+
+def records(path):
+    header = default_header
+    for l in xopen(path):
+        toks = l.rstrip("\r\n").split("\t")
+        if toks[0].startswith("#"):
+            toks[0] = toks[0][1:]
+            header = toks
+            continue
+        assert len(toks) == len(header), (len(toks), len(header))
+        yield dict(zip(header, toks))
 
 def run(args):
     gc = 'gc257'
@@ -62,9 +73,7 @@ def run(args):
             f.add_subplot(ax)
 
 
-        for toks in (l.rstrip("\r\n").split("\t") for l in xopen(bigly)):
-            assert len(toks) == len(header), (len(toks), len(header))
-            d = dict(zip(header, toks))
+        for d in records(bigly):
             if len(xs) > 1 and int(d['pos']) - 1 != xs[-1]:
                 xs.append(xs[-1] + 1)
                 xs.append(int(d['pos']) - 1)
@@ -77,12 +86,12 @@ def run(args):
             vals['splitters'].append(int(d['splitters1']))
             vals['softs'].append(int(d['softstarts']) + int(d['softends']))
             vals['discordant'].append(int(d['discordant']))
-            if int(d['discchrom']) > 2:
-                vals['discchrom'].append(int(d['discchrom'])  * (1 - float(d['discchromentropy'])))
+            if int(d['discordantchrom']) > 2:
+                vals['discchrom'].append(int(d['discordantchrom'])  * (1 - float(d['discordantchromentropy'])))
             else:
                 vals['discchrom'].append(0)
-            vals['inserts1'].append(int(d['mean_insert1']))
-            vals['inserts2'].append(int(d['mean_insert2']))
+            vals['inserts1'].append(int(d['meaninsertsizelp']))
+            vals['inserts2'].append(int(d['meaninsertsizerm']))
             #vals['duplicity65'].append(float(d['duplicity65']))
             #vals['duplicity257'].append(float(d['duplicity257']))
 
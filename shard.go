@@ -0,0 +1,196 @@
+package bigly
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Shard is a region of a run that is written to its own file.
+type Shard struct {
+	// Name is unique within a run and safe to use in a file name.
+	Name string
+	Position
+}
+
+// SplitShards splits each position into shards of at most size bases or, if size is 0, returns
+// a shard for each position. The positions must have a chromosome and an end.
+func SplitShards(ps []Position, size int) []Shard {
+	var shards []Shard
+	for _, p := range ps {
+		step := p.End - p.Start
+		if size > 0 && size < step {
+			step = size
+		}
+		for s := p.Start; s < p.End; s += step {
+			q := Position{Chrom: p.Chrom, Start: s, End: min(s+step, p.End)}
+			name := q.Chrom
+			if q.Start != 0 || size > 0 {
+				name = fmt.Sprintf("%s_%d_%d", q.Chrom, q.Start+1, q.End)
+			}
+			// the index keeps the names unique and in order.
+			shards = append(shards, Shard{Name: fmt.Sprintf("%05d.%s", len(shards), safeName(name)), Position: q})
+		}
+	}
+	return shards
+}
+
+// safeName replaces characters that are not safe in a file name.
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' || r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// ShardRecord is the entry in a Manifest for a completed shard.
+type ShardRecord struct {
+	Name   string `json:"name"`
+	Region string `json:"region"`
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest records the shards of a run that are complete, with the checksums of their files.
+// It is stored as manifest.json in the output directory.
+type Manifest struct {
+	dir string
+	// Run describes the options of the run so that a directory is not resumed with
+	// different options.
+	Run    string        `json:"run"`
+	Shards []ShardRecord `json:"shards"`
+}
+
+const manifestName = "manifest.json"
+
+// OpenManifest creates dir if needed and reads its manifest, if any. It is an error if the
+// manifest is for a run with a different description.
+func OpenManifest(dir, run string) (*Manifest, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	m := &Manifest{dir: dir, Run: run}
+	b, err := ioutil.ReadFile(filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("bigly: bad manifest in %s: %s", dir, err)
+	}
+	if m.Run != run {
+		return nil, fmt.Errorf("bigly: %s is from a run with different options: %s", dir, m.Run)
+	}
+	return m, nil
+}
+
+func (m *Manifest) find(name string) int {
+	for i, r := range m.Shards {
+		if r.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Done reports whether the shard is complete and its file matches the checksum. A shard with
+// a missing or changed file is removed from the manifest so that it is written again.
+func (m *Manifest) Done(name string) (bool, error) {
+	i := m.find(name)
+	if i < 0 {
+		return false, nil
+	}
+	r := m.Shards[i]
+	f, err := os.Open(filepath.Join(m.dir, r.File))
+	if err == nil {
+		h := sha256.New()
+		var n int64
+		n, err = io.Copy(h, f)
+		f.Close()
+		if err == nil && n == r.Size && hex.EncodeToString(h.Sum(nil)) == r.SHA256 {
+			return true, nil
+		}
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	m.Shards = append(m.Shards[:i], m.Shards[i+1:]...)
+	return false, m.save()
+}
+
+// save writes the manifest to a temporary file and renames it so that it is never partial.
+func (m *Manifest) save() error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(m.dir, manifestName)
+	if err = ioutil.WriteFile(path+".tmp", append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// ShardWriter writes the file for a shard. The file only gets its final name, and the shard
+// is only added to the Manifest, by Commit.
+type ShardWriter struct {
+	m    *Manifest
+	s    Shard
+	file string
+	f    *os.File
+	h    hash.Hash
+	n    int64
+}
+
+// Create starts the file for the shard. Its name is the shard name followed by ext.
+func (m *Manifest) Create(s Shard, ext string) (*ShardWriter, error) {
+	file := s.Name + ext
+	f, err := os.Create(filepath.Join(m.dir, file+".tmp"))
+	if err != nil {
+		return nil, err
+	}
+	return &ShardWriter{m: m, s: s, file: file, f: f, h: sha256.New()}, nil
+}
+
+func (w *ShardWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.h.Write(p[:n])
+	w.n += int64(n)
+	return n, err
+}
+
+// Commit closes the file, gives it its final name and records the shard as complete.
+func (w *ShardWriter) Commit() error {
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	path := filepath.Join(w.m.dir, w.file)
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	r := ShardRecord{Name: w.s.Name, Region: w.s.Position.String(), File: w.file, Size: w.n, SHA256: hex.EncodeToString(w.h.Sum(nil))}
+	if i := w.m.find(r.Name); i >= 0 {
+		w.m.Shards[i] = r
+	} else {
+		w.m.Shards = append(w.m.Shards, r)
+	}
+	return w.m.save()
+}
+
+// Abort closes and removes the partial file.
+func (w *ShardWriter) Abort() error {
+	w.f.Close()
+	return os.Remove(w.f.Name())
+}
@@ -0,0 +1,78 @@
+package bigly_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type ShardTest struct {
+	dir string
+}
+
+var _ = Suite(&ShardTest{})
+
+func (t *ShardTest) SetUpTest(c *C) { t.dir = filepath.Join(c.MkDir(), "shards") }
+
+func (t *ShardTest) TestSplit(c *C) {
+	ps := []bigly.Position{{Chrom: "chr1", Start: 0, End: 25}, {Chrom: "HLA-A*01:01", Start: 0, End: 5}}
+	shards := bigly.SplitShards(ps, 10)
+	c.Assert(shards, HasLen, 4)
+	c.Assert(shards[0].Name, Equals, "00000.chr1_1_10")
+	c.Assert(shards[2].Position, Equals, bigly.Position{Chrom: "chr1", Start: 20, End: 25})
+	c.Assert(shards[3].Name, Equals, "00003.HLA-A_01_01_1_5")
+
+	shards = bigly.SplitShards(ps, 0)
+	c.Assert(shards, HasLen, 2)
+	c.Assert(shards[0].Name, Equals, "00000.chr1")
+	c.Assert(shards[0].Position, Equals, ps[0])
+}
+
+func (t *ShardTest) TestManifest(c *C) {
+	shards := bigly.SplitShards([]bigly.Position{{Chrom: "chr1", Start: 0, End: 25}}, 10)
+	m, err := bigly.OpenManifest(t.dir, "run1")
+	c.Assert(err, IsNil)
+	for i, s := range shards[:2] {
+		done, err := m.Done(s.Name)
+		c.Assert(err, IsNil)
+		c.Assert(done, Equals, false)
+		w, err := m.Create(s, ".tsv")
+		c.Assert(err, IsNil)
+		_, err = w.Write([]byte("shard " + s.Name + "\n"))
+		c.Assert(err, IsNil)
+		if i == 0 {
+			c.Assert(w.Commit(), IsNil)
+		} else {
+			// a run that dies leaves no file.
+			c.Assert(w.Abort(), IsNil)
+		}
+	}
+	_, err = os.Stat(filepath.Join(t.dir, shards[1].Name+".tsv"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	// restart.
+	_, err = bigly.OpenManifest(t.dir, "run2")
+	c.Assert(err, ErrorMatches, ".*different options.*")
+	m, err = bigly.OpenManifest(t.dir, "run1")
+	c.Assert(err, IsNil)
+	c.Assert(m.Shards, HasLen, 1)
+	done, err := m.Done(shards[0].Name)
+	c.Assert(err, IsNil)
+	c.Assert(done, Equals, true)
+	done, err = m.Done(shards[1].Name)
+	c.Assert(err, IsNil)
+	c.Assert(done, Equals, false)
+
+	// a changed file is done again.
+	path := filepath.Join(t.dir, m.Shards[0].File)
+	c.Assert(ioutil.WriteFile(path, []byte("truncated"), 0644), IsNil)
+	done, err = m.Done(shards[0].Name)
+	c.Assert(err, IsNil)
+	c.Assert(done, Equals, false)
+	m, err = bigly.OpenManifest(t.dir, "run1")
+	c.Assert(err, IsNil)
+	c.Assert(m.Shards, HasLen, 0)
+}
@@ -0,0 +1,116 @@
+package bigly
+
+// sweep is a read-centric alternative to calling Pile.Update with every cached
+// alignment at every position. Each alignment is decoded once, as it is added,
+// and its contribution to each position it covers is accumulated in a circular
+// buffer of slots. The piles are identical to those from Pile.Update.
+type sweep struct {
+	slots []slot
+	mask  int
+	// off is the genomic position of the first live slot.
+	off int
+
+	s  CigarSummary
+	ri readInfo
+	// the base counts and mates of the most recent pile, kept for finish.
+	bases     [16]uint32
+	discMates []int
+}
+
+// slot accumulates the values for a single position.
+type slot struct {
+	p         Pile
+	discMates []int
+	// count of each base so mismatches can be found once the reference base is known.
+	bases [16]uint32
+}
+
+// nt16 maps a base to its index in slot.bases or -1.
+var nt16 = func() (t [256]int8) {
+	for i := range t {
+		t[i] = -1
+	}
+	for i, b := range []byte("=ACMGRSVTWYHKDBN") {
+		t[b] = int8(i)
+	}
+	return t
+}()
+
+func newSweep(start int) *sweep {
+	return &sweep{slots: make([]slot, 64), mask: 63, off: start}
+}
+
+// grow makes sure that there are at least n slots.
+func (sw *sweep) grow(n int) {
+	if n <= len(sw.slots) {
+		return
+	}
+	l := len(sw.slots)
+	for l < n {
+		l *= 2
+	}
+	slots := make([]slot, l)
+	for pos := sw.off; pos < sw.off+len(sw.slots); pos++ {
+		slots[pos&(l-1)] = sw.slots[pos&sw.mask]
+	}
+	sw.slots, sw.mask = slots, l-1
+}
+
+// add decodes the alignment and adds it to every position it covers that hasn't
+// yet been returned by next.
+func (sw *sweep) add(o Options, a *Align) {
+	if a.MapQ < o.MinMappingQuality {
+		return
+	}
+	end := a.End()
+	sw.grow(end - sw.off)
+	sw.ri.set(o, a)
+	for pos := max(a.Start(), sw.off); pos < end; pos++ {
+		if !a.at(pos, &sw.s) || sw.s.Qual < o.MinBaseQuality {
+			continue
+		}
+		sl := &sw.slots[pos&sw.mask]
+		sl.discMates = sl.p.add(o, &sw.ri, &sw.s, sl.discMates)
+		if i := nt16[sw.s.Base]; i >= 0 {
+			sl.bases[i]++
+		}
+	}
+}
+
+// reset clears the slot, keeping only the memory that is not handed to the caller.
+func (sl *slot) reset() {
+	sl.p.Reset()
+	sl.discMates = sl.discMates[:0]
+	sl.bases = [16]uint32{}
+}
+
+// next moves the accumulated values for pos into p and releases all slots up to and including pos.
+// p must be empty; the memory for its slices is kept for reuse. The caller must set the reference
+// base, if known, and then call finish.
+func (sw *sweep) next(pos int, p *Pile) {
+	if pos-sw.off >= len(sw.slots) {
+		for i := range sw.slots {
+			sw.slots[i].reset()
+		}
+	} else {
+		for ; sw.off < pos; sw.off++ {
+			sw.slots[sw.off&sw.mask].reset()
+		}
+	}
+	sl := &sw.slots[pos&sw.mask]
+	*p, sl.p = sl.p, *p
+	sw.bases = sl.bases
+	sw.discMates, sl.discMates = sl.discMates, sw.discMates
+	sl.reset()
+	sw.off = pos + 1
+}
+
+// finish sets the values of p that depend on the reference base.
+func (sw *sweep) finish(o Options, p *Pile) {
+	p.MisMatches = uint32(p.Depth)
+	if i := nt16[p.RefBase]; i >= 0 {
+		p.MisMatches -= sw.bases[i]
+	}
+	p.finish(o, sw.discMates)
+	sw.discMates = sw.discMates[:0]
+}
@@ -0,0 +1,300 @@
+package tabix
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/biogo/hts/bgzf"
+)
+
+// Conf describes the columns of the indexed file. Columns are 1-based.
+type Conf struct {
+	Seq   int
+	Begin int
+	// End is 0 if each line covers only the base in the Begin column.
+	End int
+	// ZeroBased is set for files with 0-based, half-open positions such as BED.
+	ZeroBased bool
+	// lines starting with Meta are headers.
+	Meta byte
+}
+
+const (
+	linearShift = 14
+	// the binning scheme only covers positions up to 2^29.
+	maxPos = 1 << 29
+)
+
+// voffset is a BGZF virtual offset as it is stored in the index: the file offset of a block in
+// the upper 48 bits and the offset in the uncompressed block in the lower 16.
+type voffset uint64
+
+func makeVoffset(o bgzf.Offset) voffset { return voffset(o.File<<16 | int64(o.Block)) }
+
+func (v voffset) offset() bgzf.Offset { return bgzf.Offset{File: int64(v >> 16), Block: uint16(v)} }
+
+type chunk struct {
+	beg, end voffset
+}
+
+type refIndex struct {
+	bins map[uint32][]chunk
+	// the smallest offset of any line overlapping each 16kb window.
+	linear []voffset
+}
+
+// Index is a tabix index.
+type Index struct {
+	Conf
+	names []string
+	ids   map[string]int
+	refs  []*refIndex
+}
+
+// Names returns the chromosomes in the index in the order they appear in the file.
+func (idx *Index) Names() []string { return idx.names }
+
+// reg2bin returns the bin for the 0-based, half-open region.
+func reg2bin(beg, end int) uint32 {
+	end--
+	switch {
+	case beg>>14 == end>>14:
+		return uint32(((1<<15)-1)/7 + (beg >> 14))
+	case beg>>17 == end>>17:
+		return uint32(((1<<12)-1)/7 + (beg >> 17))
+	case beg>>20 == end>>20:
+		return uint32(((1<<9)-1)/7 + (beg >> 20))
+	case beg>>23 == end>>23:
+		return uint32(((1<<6)-1)/7 + (beg >> 23))
+	case beg>>26 == end>>26:
+		return uint32(((1<<3)-1)/7 + (beg >> 26))
+	}
+	return 0
+}
+
+// reg2bins returns all of the bins that may hold lines overlapping the region.
+func reg2bins(beg, end int) []uint32 {
+	end--
+	bins := []uint32{0}
+	for _, l := range []struct{ off, shift int }{{1, 26}, {9, 23}, {73, 20}, {585, 17}, {4681, 14}} {
+		for k := l.off + beg>>uint(l.shift); k <= l.off+end>>uint(l.shift); k++ {
+			bins = append(bins, uint32(k))
+		}
+	}
+	return bins
+}
+
+// add records a line covering beg, end (0-based, half-open) on the given reference, starting at
+// virtual offset start and ending at stop.
+func (idx *Index) add(chrom string, beg, end int, start, stop voffset) {
+	id, ok := idx.ids[chrom]
+	if !ok {
+		id = len(idx.names)
+		idx.ids[chrom] = id
+		idx.names = append(idx.names, chrom)
+		idx.refs = append(idx.refs, &refIndex{bins: make(map[uint32][]chunk)})
+	}
+	ri := idx.refs[id]
+	bin := reg2bin(beg, end)
+	cs := ri.bins[bin]
+	if len(cs) > 0 && cs[len(cs)-1].end == start {
+		cs[len(cs)-1].end = stop
+	} else {
+		ri.bins[bin] = append(cs, chunk{start, stop})
+	}
+	for w := beg >> linearShift; w <= (end-1)>>linearShift; w++ {
+		for len(ri.linear) <= w {
+			ri.linear = append(ri.linear, 0)
+		}
+		if ri.linear[w] == 0 {
+			ri.linear[w] = start
+		}
+	}
+}
+
+func newIndex(c Conf) *Index {
+	return &Index{Conf: c, ids: make(map[string]int)}
+}
+
+var errNotTabix = errors.New("tabix: not a tabix index")
+
+// ReadIndex reads a tabix (.tbi) index.
+func ReadIndex(r io.Reader) (*Index, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	var hdr struct {
+		Magic                                  [4]byte
+		NRef, Format, Seq, Begin, End, Meta, _ int32
+		LNames                                 int32
+	}
+	if err = binary.Read(gz, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if string(hdr.Magic[:]) != "TBI\x01" {
+		return nil, errNotTabix
+	}
+	idx := newIndex(Conf{Seq: int(hdr.Seq), Begin: int(hdr.Begin), End: int(hdr.End),
+		ZeroBased: hdr.Format&0x10000 != 0, Meta: byte(hdr.Meta)})
+	if hdr.LNames < 0 || hdr.NRef < 0 {
+		return nil, errNotTabix
+	}
+	names := make([]byte, hdr.LNames)
+	if _, err = io.ReadFull(gz, names); err != nil {
+		return nil, err
+	}
+	for len(names) > 0 {
+		i := bytes.IndexByte(names, 0)
+		if i < 0 {
+			i = len(names) - 1
+		}
+		idx.ids[string(names[:i])] = len(idx.names)
+		idx.names = append(idx.names, string(names[:i]))
+		names = names[i+1:]
+	}
+	if len(idx.names) != int(hdr.NRef) {
+		return nil, errNotTabix
+	}
+	for range idx.names {
+		ri := &refIndex{bins: make(map[uint32][]chunk)}
+		var n int32
+		if err = binary.Read(gz, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		for i := 0; i < int(n); i++ {
+			var b struct {
+				Bin    uint32
+				NChunk int32
+			}
+			if err = binary.Read(gz, binary.LittleEndian, &b); err != nil {
+				return nil, err
+			}
+			if b.NChunk < 0 {
+				return nil, errNotTabix
+			}
+			offs := make([]voffset, 2*b.NChunk)
+			if err = binary.Read(gz, binary.LittleEndian, offs); err != nil {
+				return nil, err
+			}
+			cs := make([]chunk, b.NChunk)
+			for j := range cs {
+				cs[j] = chunk{offs[2*j], offs[2*j+1]}
+			}
+			ri.bins[b.Bin] = cs
+		}
+		if err = binary.Read(gz, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errNotTabix
+		}
+		ri.linear = make([]voffset, n)
+		if err = binary.Read(gz, binary.LittleEndian, ri.linear); err != nil {
+			return nil, err
+		}
+		idx.refs = append(idx.refs, ri)
+	}
+	return idx, nil
+}
+
+// WriteTo writes the index in the BGZF-compressed tabix format.
+func (idx *Index) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	bw := bgzf.NewWriter(cw, 1)
+	var names []byte
+	for _, n := range idx.names {
+		names = append(append(names, n...), 0)
+	}
+	format := int32(0)
+	if idx.ZeroBased {
+		format |= 0x10000
+	}
+	var buf bytes.Buffer
+	put := func(v interface{}) { binary.Write(&buf, binary.LittleEndian, v) }
+	buf.WriteString("TBI\x01")
+	put([]int32{int32(len(idx.names)), format, int32(idx.Seq), int32(idx.Begin), int32(idx.End), int32(idx.Meta), 0, int32(len(names))})
+	buf.Write(names)
+	for _, ri := range idx.refs {
+		bins := make([]uint32, 0, len(ri.bins))
+		for b := range ri.bins {
+			bins = append(bins, b)
+		}
+		sort.Slice(bins, func(i, j int) bool { return bins[i] < bins[j] })
+		put(int32(len(bins)))
+		for _, b := range bins {
+			put(b)
+			put(int32(len(ri.bins[b])))
+			for _, c := range ri.bins[b] {
+				put([]voffset{c.beg, c.end})
+			}
+		}
+		// windows without lines get the offset of the previous window.
+		for i := 1; i < len(ri.linear); i++ {
+			if ri.linear[i] == 0 {
+				ri.linear[i] = ri.linear[i-1]
+			}
+		}
+		put(int32(len(ri.linear)))
+		put(ri.linear)
+	}
+	if _, err := bw.Write(buf.Bytes()); err != nil {
+		return cw.n, err
+	}
+	err := bw.Close()
+	return cw.n, err
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// chunks returns the sorted, merged chunks that may hold lines overlapping the region.
+func (idx *Index) chunks(chrom string, beg, end int) []chunk {
+	id, ok := idx.ids[chrom]
+	if end > maxPos {
+		end = maxPos
+	}
+	if !ok || end <= beg {
+		return nil
+	}
+	ri := idx.refs[id]
+	var min voffset
+	if w := beg >> linearShift; w < len(ri.linear) {
+		min = ri.linear[w]
+	} else if len(ri.linear) > 0 {
+		min = ri.linear[len(ri.linear)-1]
+	}
+	var cs []chunk
+	for _, b := range reg2bins(beg, end) {
+		for _, c := range ri.bins[b] {
+			if c.end > min {
+				cs = append(cs, c)
+			}
+		}
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].beg < cs[j].beg })
+	merged := cs[:0]
+	for _, c := range cs {
+		if n := len(merged); n > 0 && c.beg <= merged[n-1].end {
+			if c.end > merged[n-1].end {
+				merged[n-1].end = c.end
+			}
+			continue
+		}
+		merged = append(merged, c)
+	}
+	return merged
+}
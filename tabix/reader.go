@@ -0,0 +1,213 @@
+package tabix
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/biogo/hts/bgzf"
+)
+
+// Reader queries a BGZF file with a tabix index.
+type Reader struct {
+	r io.ReadSeeker
+	// bg is opened on the first seek.
+	bg   *bgzf.Reader
+	idx  *Index
+	fh   *os.File
+	line []byte
+}
+
+// NewReader returns a Reader for the BGZF data in r indexed by idx.
+func NewReader(r io.ReadSeeker, idx *Index) *Reader {
+	return &Reader{r: r, idx: idx}
+}
+
+// seek moves to the virtual offset v.
+func (r *Reader) seek(v voffset) error {
+	if r.bg == nil {
+		if _, err := r.r.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		bg, err := bgzf.NewReader(r.r, 1)
+		if err != nil {
+			return err
+		}
+		r.bg = bg
+	}
+	return r.bg.Seek(v.offset())
+}
+
+// readLine returns the next line, without the newline. It is only valid until the next call.
+func (r *Reader) readLine() ([]byte, error) {
+	line := r.line[:0]
+	for {
+		b, err := r.bg.ReadByte()
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b == '\n' {
+			break
+		}
+		line = append(line, b)
+	}
+	r.line = line
+	return line, nil
+}
+
+// offset returns the virtual offset after the last line that was read.
+func (r *Reader) offset() voffset { return makeVoffset(r.bg.LastChunk().End) }
+
+// Open opens the BGZF file at path and its index at path + ".tbi".
+func Open(path string) (*Reader, error) {
+	fi, err := os.Open(path + ".tbi")
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+	idx, err := ReadIndex(fi)
+	if err != nil {
+		return nil, fmt.Errorf("tabix: reading index for %s: %s", path, err)
+	}
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := NewReader(fh, idx)
+	r.fh = fh
+	return r, nil
+}
+
+// Index returns the index used by the Reader.
+func (r *Reader) Index() *Index { return r.idx }
+
+// Header returns the header lines from the start of the file, each with a trailing newline.
+func (r *Reader) Header() ([]byte, error) {
+	if err := r.seek(0); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var hdr []byte
+	for {
+		line, err := r.readLine()
+		if err == io.EOF {
+			return hdr, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != r.idx.Meta {
+			return hdr, nil
+		}
+		hdr = append(append(hdr, line...), '\n')
+	}
+}
+
+// Query returns the lines that overlap the 0-based, half-open region. Only one query
+// can be used at a time.
+func (r *Reader) Query(chrom string, start, end int) *Lines {
+	return &Lines{r: r, chrom: chrom, start: start, end: end, chunks: r.idx.chunks(chrom, start, end)}
+}
+
+// Close closes the BGZF reader and the file if the Reader was created with Open.
+func (r *Reader) Close() error {
+	var err error
+	if r.bg != nil {
+		err = r.bg.Close()
+	}
+	if r.fh != nil {
+		if ferr := r.fh.Close(); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// Lines iterates over the lines from a query. It is also an io.Reader of the lines, each
+// with a trailing newline.
+type Lines struct {
+	r          *Reader
+	chrom      string
+	start, end int
+	chunks     []chunk
+	// set when a chunk has been seeked to.
+	inChunk bool
+	line    []byte
+	// the part of the line not yet returned by Read.
+	unread []byte
+	err    error
+}
+
+// Next moves to the next line and returns false at the end of the query or on error.
+func (l *Lines) Next() bool {
+	for l.err == nil && len(l.chunks) > 0 {
+		c := l.chunks[0]
+		if !l.inChunk {
+			if l.err = l.r.seek(c.beg); l.err != nil {
+				break
+			}
+			l.inChunk = true
+		}
+		if l.r.offset() >= c.end {
+			l.chunks, l.inChunk = l.chunks[1:], false
+			continue
+		}
+		var line []byte
+		if line, l.err = l.r.readLine(); l.err != nil {
+			break
+		}
+		if len(line) == 0 || line[0] == l.r.idx.Meta {
+			continue
+		}
+		chrom, beg, end, err := l.r.idx.parse(line)
+		if err != nil {
+			l.err = err
+			break
+		}
+		if chrom != l.chrom || end <= l.start {
+			continue
+		}
+		if beg >= l.end {
+			// lines are sorted so there are no more.
+			l.chunks = nil
+			break
+		}
+		l.line = line
+		return true
+	}
+	l.line = nil
+	return false
+}
+
+// Bytes returns the current line without the newline. It is only valid until the next call to Next.
+func (l *Lines) Bytes() []byte { return l.line }
+
+// Error returns any error from the query.
+func (l *Lines) Error() error {
+	if l.err == io.EOF {
+		return nil
+	}
+	return l.err
+}
+
+// Read implements io.Reader.
+func (l *Lines) Read(p []byte) (int, error) {
+	if len(l.unread) == 0 {
+		if !l.Next() {
+			if err := l.Error(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		l.unread = append(l.line, '\n')
+		l.r.line = l.unread
+	}
+	n := copy(p, l.unread)
+	l.unread = l.unread[n:]
+	return n, nil
+}
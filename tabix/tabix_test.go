@@ -0,0 +1,127 @@
+package tabix_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/brentp/bigly/tabix"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type TabixTest struct{}
+
+var _ = Suite(&TabixTest{})
+
+type rec struct {
+	chrom      string
+	start, end int
+	line       string
+}
+
+// write writes bed-like lines with a random length and returns the file, its index and the records.
+func write(c *C, r *rand.Rand, n int) ([]byte, *tabix.Index, []rec) {
+	var buf bytes.Buffer
+	w := tabix.NewWriter(&buf, tabix.Conf{Seq: 1, Begin: 2, End: 3, ZeroBased: true})
+	c.Assert(w.WriteMeta([]byte("#chrom\tstart\tend\tname")), IsNil)
+	var recs []rec
+	for _, chrom := range []string{"chr1", "chr2", "chrX"} {
+		pos := r.Intn(1000)
+		for i := 0; i < n; i++ {
+			pos += r.Intn(300)
+			l := 1 + r.Intn(100)
+			if r.Intn(100) == 0 {
+				l = 1 + r.Intn(200000)
+			}
+			rc := rec{chrom, pos, pos + l, ""}
+			rc.line = fmt.Sprintf("%s\t%d\t%d\tr%d", chrom, rc.start, rc.end, len(recs))
+			c.Assert(w.Write([]byte(rc.line)), IsNil)
+			recs = append(recs, rc)
+		}
+	}
+	c.Assert(w.Close(), IsNil)
+	var ibuf bytes.Buffer
+	_, err := w.Index().WriteTo(&ibuf)
+	c.Assert(err, IsNil)
+	idx, err := tabix.ReadIndex(&ibuf)
+	c.Assert(err, IsNil)
+	return buf.Bytes(), idx, recs
+}
+
+func (t *TabixTest) TestQuery(c *C) {
+	r := rand.New(rand.NewSource(1))
+	data, idx, recs := write(c, r, 20000)
+	c.Assert(idx.Names(), DeepEquals, []string{"chr1", "chr2", "chrX"})
+
+	// the data is a valid gzip file.
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	all, err := ioutil.ReadAll(gz)
+	c.Assert(err, IsNil)
+	lines := strings.Split(strings.TrimSpace(string(all)), "\n")
+	c.Assert(lines, HasLen, len(recs)+1)
+	c.Assert(lines[len(lines)-1], Equals, recs[len(recs)-1].line)
+
+	tr := tabix.NewReader(bytes.NewReader(data), idx)
+	hdr, err := tr.Header()
+	c.Assert(err, IsNil)
+	c.Assert(string(hdr), Equals, "#chrom\tstart\tend\tname\n")
+
+	for i := 0; i < 200; i++ {
+		q := recs[r.Intn(len(recs))]
+		start := q.start + r.Intn(2000) - 1000
+		end := start + 1 + r.Intn(20000)
+		if i%20 == 0 {
+			end = start + 1
+		}
+		var exp []string
+		for _, rc := range recs {
+			if rc.chrom == q.chrom && rc.start < end && rc.end > start {
+				exp = append(exp, rc.line)
+			}
+		}
+		var got []string
+		it := tr.Query(q.chrom, start, end)
+		for it.Next() {
+			got = append(got, string(it.Bytes()))
+		}
+		c.Assert(it.Error(), IsNil)
+		c.Assert(got, DeepEquals, exp, Commentf("%s:%d-%d", q.chrom, start, end))
+	}
+
+	it := tr.Query("chrY", 0, 100)
+	c.Assert(it.Next(), Equals, false)
+	c.Assert(it.Error(), IsNil)
+	c.Assert(tr.Close(), IsNil)
+}
+
+func (t *TabixTest) TestRead(c *C) {
+	var buf bytes.Buffer
+	w := tabix.NewWriter(&buf, tabix.Conf{Seq: 1, Begin: 2})
+	for i := 1; i < 10; i++ {
+		c.Assert(w.Write([]byte(fmt.Sprintf("1\t%d\tx", i))), IsNil)
+	}
+	c.Assert(w.Close(), IsNil)
+	tr := tabix.NewReader(bytes.NewReader(buf.Bytes()), w.Index())
+	// 1-based positions.
+	b, err := ioutil.ReadAll(tr.Query("1", 2, 4))
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, "1\t3\tx\n1\t4\tx\n")
+	c.Assert(tr.Close(), IsNil)
+}
+
+func (t *TabixTest) TestSorted(c *C) {
+	w := tabix.NewWriter(ioutil.Discard, tabix.Conf{Seq: 1, Begin: 2})
+	c.Assert(w.Write([]byte("1\t10")), IsNil)
+	c.Assert(w.Write([]byte("1\t9")), ErrorMatches, "tabix: line 2 is not sorted.*")
+	c.Assert(w.Write([]byte("2\t9")), IsNil)
+	c.Assert(w.Write([]byte("1\t11")), ErrorMatches, ".*chromosome 1 is not contiguous")
+	c.Assert(w.Write([]byte("2\tx")), NotNil)
+	c.Assert(w.WriteMeta([]byte("#late")), NotNil)
+}
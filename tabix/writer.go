@@ -0,0 +1,141 @@
+package tabix
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/biogo/hts/bgzf"
+)
+
+// Writer writes lines to a BGZF file and builds a tabix index for them.
+// Lines must be sorted by position and grouped by chromosome.
+type Writer struct {
+	bw *bgzf.Writer
+	// counts the compressed bytes for the virtual offsets.
+	cw  *countWriter
+	buf []byte
+	idx *Index
+	// the last line, to check the sort order.
+	chrom string
+	beg   int
+	line  int
+}
+
+// NewWriter returns a Writer that writes BGZF-compressed lines to w.
+func NewWriter(w io.Writer, c Conf) *Writer {
+	if c.Meta == 0 {
+		c.Meta = '#'
+	}
+	cw := &countWriter{w: w}
+	return &Writer{bw: bgzf.NewWriter(cw, 1), cw: cw, idx: newIndex(c)}
+}
+
+// offset returns the virtual offset of the next byte to be written. It waits for the
+// blocks that have been filled to be written so that their size is known.
+func (w *Writer) offset() (voffset, error) {
+	if err := w.bw.Wait(); err != nil {
+		return 0, err
+	}
+	n, err := w.bw.Next()
+	return makeVoffset(bgzf.Offset{File: w.cw.n, Block: uint16(n)}), err
+}
+
+// WriteMeta writes a header line, which must start with Conf.Meta, before any other lines.
+func (w *Writer) WriteMeta(line []byte) error {
+	if w.line > 0 {
+		return fmt.Errorf("tabix: header line after data")
+	}
+	if len(line) == 0 || line[0] != w.idx.Meta {
+		return fmt.Errorf("tabix: header line must start with %q", w.idx.Meta)
+	}
+	return w.write(line)
+}
+
+func (w *Writer) write(line []byte) error {
+	// the line and newline are written together so that bgzf keeps them in one block if it can.
+	w.buf = append(append(w.buf[:0], line...), '\n')
+	_, err := w.bw.Write(w.buf)
+	return err
+}
+
+// Write writes a line, without the newline, and adds it to the index.
+func (w *Writer) Write(line []byte) error {
+	chrom, beg, end, err := w.idx.parse(line)
+	if err != nil {
+		return err
+	}
+	if end > maxPos {
+		return fmt.Errorf("tabix: position %d is too large to index", end)
+	}
+	if w.line > 0 && chrom == w.chrom && beg < w.beg {
+		return fmt.Errorf("tabix: line %d is not sorted: %s:%d after %s:%d", w.line+1, chrom, beg+1, w.chrom, w.beg+1)
+	}
+	if _, seen := w.idx.ids[chrom]; seen && chrom != w.chrom {
+		return fmt.Errorf("tabix: line %d: chromosome %s is not contiguous", w.line+1, chrom)
+	}
+	start, err := w.offset()
+	if err != nil {
+		return err
+	}
+	if err = w.write(line); err != nil {
+		return err
+	}
+	stop, err := w.offset()
+	if err != nil {
+		return err
+	}
+	w.idx.add(chrom, beg, end, start, stop)
+	w.chrom, w.beg = chrom, beg
+	w.line++
+	return nil
+}
+
+// Close flushes the data and writes the end of the BGZF file. It does not close the
+// underlying writer.
+func (w *Writer) Close() error { return w.bw.Close() }
+
+// Index returns the index of the lines written so far. It is complete after Close.
+func (w *Writer) Index() *Index { return w.idx }
+
+// parse returns the chromosome and 0-based, half-open interval of a line.
+func (c Conf) parse(line []byte) (chrom string, beg, end int, err error) {
+	var col int
+	beg, end = -1, -1
+	for len(line) > 0 || col == 0 {
+		col++
+		tok := line
+		if i := bytes.IndexByte(line, '\t'); i >= 0 {
+			tok, line = line[:i], line[i+1:]
+		} else {
+			line = nil
+		}
+		if col == c.Seq {
+			chrom = string(tok)
+		}
+		if col == c.Begin {
+			if beg, err = strconv.Atoi(string(tok)); err != nil {
+				return
+			}
+			if !c.ZeroBased {
+				beg--
+			}
+		}
+		if col == c.End {
+			if end, err = strconv.Atoi(string(tok)); err != nil {
+				return
+			}
+		}
+	}
+	if chrom == "" || beg < 0 || c.End != 0 && end < 0 {
+		return chrom, beg, end, fmt.Errorf("tabix: missing or bad position columns in line")
+	}
+	if c.End == 0 || c.End == c.Begin {
+		end = beg + 1
+	}
+	if end <= beg {
+		end = beg + 1
+	}
+	return chrom, beg, end, nil
+}
@@ -0,0 +1,97 @@
+// Package track writes per-base values as bedGraph or bigWig for genome browsers.
+package track
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+)
+
+// Writer accepts intervals in order. Adjacent intervals on the same chromosome with the
+// same value are merged.
+type Writer interface {
+	// Add adds the value for the 0-based, half-open interval.
+	Add(chrom string, start, end int, v float32) error
+	// Close writes any pending interval. It does not close the underlying writer.
+	Close() error
+}
+
+// Chrom is a chromosome name and length.
+type Chrom struct {
+	Name string
+	Size int
+}
+
+// run is an interval with a value that can be extended.
+type run struct {
+	chrom      string
+	start, end int
+	v          float32
+	ok         bool
+}
+
+// extend adds the interval to r if it is adjacent and has the same value. Otherwise it
+// returns false and r is unchanged.
+func (r *run) extend(chrom string, start, end int, v float32) bool {
+	if r.ok && chrom == r.chrom && start == r.end && v == r.v {
+		r.end = end
+		return true
+	}
+	return false
+}
+
+// BedGraph writes intervals in bedGraph format.
+type BedGraph struct {
+	w   *bufio.Writer
+	r   run
+	buf []byte
+}
+
+// NewBedGraph returns a BedGraph writer. name, if not empty, is used for a track line.
+func NewBedGraph(w io.Writer, name string) (*BedGraph, error) {
+	b := &BedGraph{w: bufio.NewWriter(w)}
+	if name != "" {
+		if _, err := b.w.WriteString("track type=bedGraph name=" + strconv.Quote(name) + "\n"); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Add implements Writer.
+func (b *BedGraph) Add(chrom string, start, end int, v float32) error {
+	if b.r.extend(chrom, start, end, v) {
+		return nil
+	}
+	if err := b.flush(); err != nil {
+		return err
+	}
+	b.r = run{chrom, start, end, v, true}
+	return nil
+}
+
+func (b *BedGraph) flush() error {
+	if !b.r.ok {
+		return nil
+	}
+	buf := append(b.buf[:0], b.r.chrom...)
+	buf = append(buf, '\t')
+	buf = strconv.AppendInt(buf, int64(b.r.start), 10)
+	buf = append(buf, '\t')
+	buf = strconv.AppendInt(buf, int64(b.r.end), 10)
+	buf = append(buf, '\t')
+	buf = strconv.AppendFloat(buf, float64(b.r.v), 'g', -1, 32)
+	buf = append(buf, '\n')
+	b.buf = buf
+	_, err := b.w.Write(buf)
+	return err
+}
+
+// Close implements Writer.
+func (b *BedGraph) Close() error {
+	if err := b.flush(); err != nil {
+		return err
+	}
+	b.r.ok = false
+	return b.w.Flush()
+}
@@ -0,0 +1,503 @@
+package track
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+)
+
+const (
+	bigWigMagic = 0x888FFC26
+	bptMagic    = 0x78CA8C91
+	cirMagic    = 0x2468ACE0
+
+	headerSize     = 64
+	zoomHeaderSize = 24
+	summarySize    = 40
+	// the number of items in each data section and zoom block.
+	itemsPerSlot = 1024
+	// the number of children of each R-tree node.
+	blockSize = 256
+
+	// bedGraph data sections.
+	sectionBedGraph = 1
+)
+
+// ZoomLevels is the number of zoom levels in a bigWig. The first summarizes ZoomBase bases
+// and each is 4 times larger than the one before.
+var ZoomLevels, ZoomBase = 10, 32
+
+// section is a block of data, or of zoom records, on a single chromosome.
+type section struct {
+	chrom      uint32
+	start, end uint32
+	off, size  uint64
+}
+
+type item struct {
+	start, end uint32
+	v          float32
+}
+
+type zoomRec struct {
+	Chrom, Start, End, Valid    uint32
+	Min, Max, Sum, SumOfSquares float32
+}
+
+// zoomLevel accumulates the summaries for one reduction.
+type zoomLevel struct {
+	reduction int
+	cur       zoomRec
+	ok        bool
+	recs      []zoomRec
+	// blocks that have been written to the temporary file.
+	blocks []section
+	count  uint32
+}
+
+type summary struct {
+	Bases                 uint64
+	Min, Max, Sum, SumSqs float64
+}
+
+// BigWig writes intervals in the bigWig format.
+type BigWig struct {
+	w      io.WriteSeeker
+	off    int64
+	chroms []Chrom
+	ids    map[string]int
+
+	r run
+	// items in the current section and the chromosome they are on.
+	items     []item
+	itemChrom int
+	sections  []section
+	// the last interval added, to check the order.
+	lastChrom, lastEnd int
+
+	dataOffset int64
+	maxBuf     int
+	summary    summary
+	zooms      []*zoomLevel
+	// the zoom blocks are written here until the data is done.
+	tmp    *os.File
+	tmpOff int64
+
+	zbuf bytes.Buffer
+	zw   *zlib.Writer
+	raw  bytes.Buffer
+}
+
+// NewBigWig returns a writer for a bigWig with the given chromosomes. Intervals must be added
+// in the order of chroms. Because the header is written last, w must be seekable.
+func NewBigWig(w io.WriteSeeker, chroms []Chrom) (*BigWig, error) {
+	if len(chroms) > math.MaxUint16 {
+		return nil, fmt.Errorf("track: too many chromosomes for bigwig: %d", len(chroms))
+	}
+	tmp, err := ioutil.TempFile("", "bigly-zoom")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(tmp.Name())
+	b := &BigWig{w: w, chroms: chroms, ids: make(map[string]int, len(chroms)), tmp: tmp, lastChrom: -1}
+	b.zw = zlib.NewWriter(&b.zbuf)
+	for i, c := range chroms {
+		b.ids[c.Name] = i
+	}
+	red := ZoomBase
+	for i := 0; i < ZoomLevels; i++ {
+		b.zooms = append(b.zooms, &zoomLevel{reduction: red})
+		red *= 4
+	}
+	// the header, zoom headers and summary are written by Close.
+	if err = b.write(make([]byte, headerSize+zoomHeaderSize*len(b.zooms)+summarySize)); err != nil {
+		return nil, err
+	}
+	if err = b.write(b.chromTree()); err != nil {
+		return nil, err
+	}
+	b.dataOffset = b.off
+	// the section count is also written by Close.
+	return b, b.write(make([]byte, 8))
+}
+
+func (b *BigWig) write(p []byte) error {
+	n, err := b.w.Write(p)
+	b.off += int64(n)
+	return err
+}
+
+// chromTree returns a B+ tree of the chromosomes with a single leaf node.
+func (b *BigWig) chromTree() []byte {
+	keySize := 1
+	for _, c := range b.chroms {
+		if len(c.Name) > keySize {
+			keySize = len(c.Name)
+		}
+	}
+	ids := make([]int, len(b.chroms))
+	for i := range ids {
+		ids[i] = i
+	}
+	sort.Slice(ids, func(i, j int) bool { return b.chroms[ids[i]].Name < b.chroms[ids[j]].Name })
+
+	var buf bytes.Buffer
+	put := func(v interface{}) { binary.Write(&buf, binary.LittleEndian, v) }
+	put([]uint32{bptMagic, uint32(max(1, len(b.chroms))), uint32(keySize), 8})
+	put([]uint64{uint64(len(b.chroms)), 0})
+	put([]uint8{1, 0})
+	put(uint16(len(b.chroms)))
+	for _, id := range ids {
+		key := make([]byte, keySize)
+		copy(key, b.chroms[id].Name)
+		buf.Write(key)
+		put([]uint32{uint32(id), uint32(b.chroms[id].Size)})
+	}
+	return buf.Bytes()
+}
+
+// Add implements Writer.
+func (b *BigWig) Add(chrom string, start, end int, v float32) error {
+	id, ok := b.ids[chrom]
+	if !ok {
+		return fmt.Errorf("track: unknown chromosome: %s", chrom)
+	}
+	if id < b.lastChrom || id == b.lastChrom && start < b.lastEnd {
+		return fmt.Errorf("track: intervals are not sorted at %s:%d", chrom, start+1)
+	}
+	if start < 0 || end <= start || end > b.chroms[id].Size {
+		return fmt.Errorf("track: bad interval %s:%d-%d", chrom, start+1, end)
+	}
+	b.lastChrom, b.lastEnd = id, end
+	if b.r.extend(chrom, start, end, v) {
+		return nil
+	}
+	if err := b.flushRun(); err != nil {
+		return err
+	}
+	b.r = run{chrom, start, end, v, true}
+	return nil
+}
+
+// flushRun adds the pending run to the data and the zoom levels.
+func (b *BigWig) flushRun() error {
+	if !b.r.ok {
+		return nil
+	}
+	b.r.ok = false
+	id := b.ids[b.r.chrom]
+	if len(b.items) == itemsPerSlot || len(b.items) > 0 && id != b.itemChrom {
+		if err := b.writeSection(); err != nil {
+			return err
+		}
+	}
+	b.itemChrom = id
+	b.items = append(b.items, item{uint32(b.r.start), uint32(b.r.end), b.r.v})
+
+	n, v := float64(b.r.end-b.r.start), float64(b.r.v)
+	s := &b.summary
+	if s.Bases == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Bases == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Bases += uint64(n)
+	s.Sum += v * n
+	s.SumSqs += v * v * n
+
+	for _, z := range b.zooms {
+		if err := b.addZoom(z, id, b.r.start, b.r.end, b.r.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compress returns the zlib-compressed contents of b.raw.
+func (b *BigWig) compress() ([]byte, error) {
+	if b.raw.Len() > b.maxBuf {
+		b.maxBuf = b.raw.Len()
+	}
+	b.zbuf.Reset()
+	b.zw.Reset(&b.zbuf)
+	if _, err := b.zw.Write(b.raw.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := b.zw.Close(); err != nil {
+		return nil, err
+	}
+	return b.zbuf.Bytes(), nil
+}
+
+func (b *BigWig) writeSection() error {
+	if len(b.items) == 0 {
+		return nil
+	}
+	b.raw.Reset()
+	sec := section{chrom: uint32(b.itemChrom), start: b.items[0].start, end: b.items[len(b.items)-1].end, off: uint64(b.off)}
+	binary.Write(&b.raw, binary.LittleEndian, []uint32{sec.chrom, sec.start, sec.end, 0, 0})
+	binary.Write(&b.raw, binary.LittleEndian, []uint8{sectionBedGraph, 0})
+	binary.Write(&b.raw, binary.LittleEndian, uint16(len(b.items)))
+	for _, it := range b.items {
+		binary.Write(&b.raw, binary.LittleEndian, []uint32{it.start, it.end, math.Float32bits(it.v)})
+	}
+	data, err := b.compress()
+	if err != nil {
+		return err
+	}
+	sec.size = uint64(len(data))
+	b.sections = append(b.sections, sec)
+	b.items = b.items[:0]
+	return b.write(data)
+}
+
+// addZoom adds the interval to each of the summaries it overlaps.
+func (b *BigWig) addZoom(z *zoomLevel, chrom, start, end int, v float32) error {
+	size := b.chroms[chrom].Size
+	for bin := start / z.reduction; bin*z.reduction < end; bin++ {
+		bs, be := bin*z.reduction, min((bin+1)*z.reduction, size)
+		if z.ok && (z.cur.Chrom != uint32(chrom) || z.cur.Start != uint32(bs)) {
+			if err := b.emitZoom(z); err != nil {
+				return err
+			}
+		}
+		if !z.ok {
+			z.cur = zoomRec{Chrom: uint32(chrom), Start: uint32(bs), End: uint32(be), Min: v, Max: v}
+			z.ok = true
+		}
+		n := float32(min(end, be) - max(start, bs))
+		z.cur.Valid += uint32(n)
+		if v < z.cur.Min {
+			z.cur.Min = v
+		}
+		if v > z.cur.Max {
+			z.cur.Max = v
+		}
+		z.cur.Sum += v * n
+		z.cur.SumOfSquares += v * v * n
+	}
+	return nil
+}
+
+func (b *BigWig) emitZoom(z *zoomLevel) error {
+	if !z.ok {
+		return nil
+	}
+	z.ok = false
+	if len(z.recs) == itemsPerSlot || len(z.recs) > 0 && z.recs[0].Chrom != z.cur.Chrom {
+		if err := b.writeZoomBlock(z); err != nil {
+			return err
+		}
+	}
+	z.recs = append(z.recs, z.cur)
+	z.count++
+	return nil
+}
+
+// writeZoomBlock writes the pending zoom records to the temporary file.
+func (b *BigWig) writeZoomBlock(z *zoomLevel) error {
+	if len(z.recs) == 0 {
+		return nil
+	}
+	b.raw.Reset()
+	binary.Write(&b.raw, binary.LittleEndian, z.recs)
+	data, err := b.compress()
+	if err != nil {
+		return err
+	}
+	z.blocks = append(z.blocks, section{chrom: z.recs[0].Chrom, start: z.recs[0].Start, end: z.recs[len(z.recs)-1].End,
+		off: uint64(b.tmpOff), size: uint64(len(data))})
+	z.recs = z.recs[:0]
+	n, err := b.tmp.Write(data)
+	b.tmpOff += int64(n)
+	return err
+}
+
+// writeIndex writes an R-tree of the sections. end is the offset of the end of the data.
+func (b *BigWig) writeIndex(secs []section, end int64) error {
+	type entry struct {
+		startChrom, startBase, endChrom, endBase uint32
+		off, size                                uint64
+	}
+	levels := [][]entry{make([]entry, len(secs))}
+	for i, s := range secs {
+		levels[0][i] = entry{s.chrom, s.start, s.chrom, s.end, s.off, s.size}
+	}
+	for len(levels[len(levels)-1]) > blockSize {
+		var up []entry
+		last := levels[len(levels)-1]
+		for i := 0; i < len(last); i += blockSize {
+			g := last[i:min(i+blockSize, len(last))]
+			e := entry{g[0].startChrom, g[0].startBase, g[len(g)-1].endChrom, g[len(g)-1].endBase, 0, 0}
+			for _, c := range g {
+				if c.endChrom > e.endChrom || c.endChrom == e.endChrom && c.endBase > e.endBase {
+					e.endChrom, e.endBase = c.endChrom, c.endBase
+				}
+			}
+			up = append(up, e)
+		}
+		levels = append(levels, up)
+	}
+	var buf bytes.Buffer
+	put := func(v interface{}) { binary.Write(&buf, binary.LittleEndian, v) }
+	var box entry
+	if len(secs) > 0 {
+		box = levels[len(levels)-1][0]
+		for _, e := range levels[len(levels)-1] {
+			if e.endChrom > box.endChrom || e.endChrom == box.endChrom && e.endBase > box.endBase {
+				box.endChrom, box.endBase = e.endChrom, e.endBase
+			}
+		}
+	}
+	put([]uint32{cirMagic, blockSize})
+	put(uint64(len(secs)))
+	put([]uint32{box.startChrom, box.startBase, box.endChrom, box.endBase})
+	put(uint64(end))
+	put([]uint32{1, 0})
+
+	// the offset of the first node of each level, from the root down.
+	off := b.off + int64(buf.Len())
+	starts := make([]int64, len(levels))
+	for j := len(levels) - 1; j >= 0; j-- {
+		starts[j] = off
+		n := len(levels[j])
+		nodes := max(1, (n+blockSize-1)/blockSize)
+		itemSize := 24
+		if j == 0 {
+			itemSize = 32
+		}
+		off += int64(nodes*4 + n*itemSize)
+	}
+	for j := len(levels) - 1; j >= 0; j-- {
+		es := levels[j]
+		for i := 0; i == 0 || i < len(es); i += blockSize {
+			g := es[i:min(i+blockSize, len(es))]
+			leaf := uint8(0)
+			if j == 0 {
+				leaf = 1
+			}
+			put([]uint8{leaf, 0})
+			put(uint16(len(g)))
+			for k, e := range g {
+				put([]uint32{e.startChrom, e.startBase, e.endChrom, e.endBase})
+				if j == 0 {
+					put([]uint64{e.off, e.size})
+				} else {
+					// the child is node i+k of the level below, which has full nodes before it.
+					child := i + k
+					put(uint64(starts[j-1] + int64(child*(4+blockSize*childSize(j-1)))))
+				}
+			}
+		}
+	}
+	return b.write(buf.Bytes())
+}
+
+// childSize is the size of an item in a node at level j of the R-tree.
+func childSize(j int) int {
+	if j == 0 {
+		return 32
+	}
+	return 24
+}
+
+// Close implements Writer. It writes the index, the zoom levels and the header.
+func (b *BigWig) Close() error {
+	defer b.tmp.Close()
+	if err := b.flushRun(); err != nil {
+		return err
+	}
+	if err := b.writeSection(); err != nil {
+		return err
+	}
+	indexOffset := b.off
+	if err := b.writeIndex(b.sections, indexOffset); err != nil {
+		return err
+	}
+
+	var zheaders bytes.Buffer
+	var nzoom int
+	for _, z := range b.zooms {
+		if err := b.emitZoom(z); err != nil {
+			return err
+		}
+		if err := b.writeZoomBlock(z); err != nil {
+			return err
+		}
+		if z.count == 0 {
+			continue
+		}
+		nzoom++
+		dataOff := b.off
+		cnt := make([]byte, 4)
+		binary.LittleEndian.PutUint32(cnt, z.count)
+		if err := b.write(cnt); err != nil {
+			return err
+		}
+		for i, blk := range z.blocks {
+			data := make([]byte, blk.size)
+			if _, err := b.tmp.ReadAt(data, int64(blk.off)); err != nil {
+				return err
+			}
+			z.blocks[i].off = uint64(b.off)
+			if err := b.write(data); err != nil {
+				return err
+			}
+		}
+		zIndex := b.off
+		if err := b.writeIndex(z.blocks, zIndex); err != nil {
+			return err
+		}
+		binary.Write(&zheaders, binary.LittleEndian, []uint32{uint32(z.reduction), 0})
+		binary.Write(&zheaders, binary.LittleEndian, []uint64{uint64(dataOff), uint64(zIndex)})
+	}
+
+	var hdr bytes.Buffer
+	put := func(v interface{}) { binary.Write(&hdr, binary.LittleEndian, v) }
+	put(uint32(bigWigMagic))
+	put([]uint16{4, uint16(nzoom)})
+	put([]uint64{uint64(headerSize + zoomHeaderSize*len(b.zooms) + summarySize), uint64(b.dataOffset), uint64(indexOffset)})
+	put([]uint16{0, 0})
+	put([]uint64{0, uint64(headerSize + zoomHeaderSize*len(b.zooms))})
+	put(uint32(b.maxBuf))
+	put(uint64(0))
+	hdr.Write(zheaders.Bytes())
+	hdr.Write(make([]byte, zoomHeaderSize*(len(b.zooms)-nzoom)))
+	put(b.summary)
+
+	if _, err := b.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := b.w.Write(hdr.Bytes()); err != nil {
+		return err
+	}
+	if _, err := b.w.Seek(b.dataOffset, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(b.w, binary.LittleEndian, uint64(len(b.sections))); err != nil {
+		return err
+	}
+	_, err := b.w.Seek(b.off, io.SeekStart)
+	return err
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,230 @@
+package track
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type TrackTest struct{}
+
+var _ = Suite(&TrackTest{})
+
+func (t *TrackTest) TestBedGraph(c *C) {
+	var buf bytes.Buffer
+	b, err := NewBedGraph(&buf, "depth")
+	c.Assert(err, IsNil)
+	for i, v := range []float32{1, 1, 1, 2, 2.5, 2.5} {
+		c.Assert(b.Add("chr1", i, i+1, v), IsNil)
+	}
+	// not adjacent.
+	c.Assert(b.Add("chr1", 10, 11, 2.5), IsNil)
+	c.Assert(b.Add("chr2", 11, 12, 2.5), IsNil)
+	c.Assert(b.Close(), IsNil)
+	c.Assert(buf.String(), Equals, `track type=bedGraph name="depth"`+"\nchr1\t0\t3\t1\nchr1\t3\t4\t2\nchr1\t4\t6\t2.5\nchr1\t10\t11\t2.5\nchr2\t11\t12\t2.5\n")
+}
+
+// bwReader reads the parts of a bigWig needed to check the writer.
+type bwReader struct {
+	c    *C
+	data []byte
+}
+
+func (r *bwReader) u32(off int) uint32 { return binary.LittleEndian.Uint32(r.data[off:]) }
+func (r *bwReader) u64(off int) uint64 { return binary.LittleEndian.Uint64(r.data[off:]) }
+
+// blocks returns the uncompressed blocks from the R-tree at off that overlap chrom:start-end.
+func (r *bwReader) blocks(off int, chrom, start, end uint32) [][]byte {
+	r.c.Assert(r.u32(off), Equals, uint32(cirMagic))
+	var out [][]byte
+	var walk func(node int)
+	walk = func(node int) {
+		leaf := r.data[node] == 1
+		n := int(binary.LittleEndian.Uint16(r.data[node+2:]))
+		p := node + 4
+		for i := 0; i < n; i++ {
+			sc, sb, ec, eb := r.u32(p), r.u32(p+4), r.u32(p+8), r.u32(p+12)
+			overlaps := (sc < chrom || sc == chrom && sb < end) && (ec > chrom || ec == chrom && eb > start)
+			if leaf {
+				if overlaps {
+					o, size := r.u64(p+16), r.u64(p+24)
+					zr, err := zlib.NewReader(bytes.NewReader(r.data[o : o+size]))
+					r.c.Assert(err, IsNil)
+					b, err := ioutil.ReadAll(zr)
+					r.c.Assert(err, IsNil)
+					out = append(out, b)
+				}
+				p += 32
+			} else {
+				if overlaps {
+					walk(int(r.u64(p + 16)))
+				}
+				p += 24
+			}
+		}
+	}
+	walk(off + 48)
+	return out
+}
+
+func (r *bwReader) items(chrom, start, end uint32) []item {
+	var its []item
+	for _, b := range r.blocks(int(r.u64(24)), chrom, start, end) {
+		r.c.Assert(binary.LittleEndian.Uint32(b), Equals, chrom)
+		r.c.Assert(b[20], Equals, uint8(sectionBedGraph))
+		n := int(binary.LittleEndian.Uint16(b[22:]))
+		for i := 0; i < n; i++ {
+			p := 24 + 12*i
+			it := item{binary.LittleEndian.Uint32(b[p:]), binary.LittleEndian.Uint32(b[p+4:]), math.Float32frombits(binary.LittleEndian.Uint32(b[p+8:]))}
+			if it.end > start && it.start < end {
+				its = append(its, it)
+			}
+		}
+	}
+	return its
+}
+
+func (r *bwReader) zooms(level int, chrom, start, end uint32) []zoomRec {
+	h := headerSize + zoomHeaderSize*level
+	var recs []zoomRec
+	for _, b := range r.blocks(int(r.u64(h+16)), chrom, start, end) {
+		rs := make([]zoomRec, len(b)/32)
+		r.c.Assert(binary.Read(bytes.NewReader(b), binary.LittleEndian, rs), IsNil)
+		for _, z := range rs {
+			if z.Chrom == chrom && z.End > start && z.Start < end {
+				recs = append(recs, z)
+			}
+		}
+	}
+	return recs
+}
+
+func (t *TrackTest) TestBigWig(c *C) {
+	f, err := ioutil.TempFile("", "bigly-test")
+	c.Assert(err, IsNil)
+	defer os.Remove(f.Name())
+	chroms := []Chrom{{"chr2", 3000000}, {"chr1", 2000000}, {"chrEmpty", 100}}
+	b, err := NewBigWig(f, chroms)
+	c.Assert(err, IsNil)
+
+	r := rand.New(rand.NewSource(2))
+	// the expected value at each base.
+	vals := make([][]float32, len(chroms))
+	for ci, ch := range chroms[:2] {
+		vals[ci] = make([]float32, ch.Size)
+		for i := range vals[ci] {
+			vals[ci][i] = float32(math.NaN())
+		}
+		var v float32
+		for pos := r.Intn(100); pos < ch.Size-1000; pos++ {
+			if r.Intn(20) == 0 {
+				v = float32(r.Intn(5))
+			}
+			if r.Intn(500) == 0 {
+				pos += r.Intn(5000)
+				continue
+			}
+			c.Assert(b.Add(ch.Name, pos, pos+1, v), IsNil)
+			vals[ci][pos] = v
+		}
+	}
+	c.Assert(b.Add("chr1", 10, 11, 1), ErrorMatches, "track: intervals are not sorted.*")
+	c.Assert(b.Add("chrX", 10, 11, 1), NotNil)
+	c.Assert(b.Close(), IsNil)
+	f.Close()
+
+	data, err := ioutil.ReadFile(f.Name())
+	c.Assert(err, IsNil)
+	br := &bwReader{c: c, data: data}
+	c.Assert(br.u32(0), Equals, uint32(bigWigMagic))
+	c.Assert(binary.LittleEndian.Uint16(data[6:]), Equals, uint16(ZoomLevels))
+
+	// chromosome tree.
+	ct := int(br.u64(8))
+	c.Assert(br.u32(ct), Equals, uint32(bptMagic))
+	keySize := int(br.u32(ct + 8))
+	c.Assert(keySize, Equals, len("chrEmpty"))
+	names := []string{}
+	for i := 0; i < 3; i++ {
+		p := ct + 36 + i*(keySize+8)
+		names = append(names, strings.TrimRight(string(data[p:p+keySize]), "\x00"))
+		c.Assert(int(br.u32(p+keySize+4)), Equals, chroms[br.u32(p+keySize)].Size)
+	}
+	c.Assert(names, DeepEquals, []string{"chr1", "chr2", "chrEmpty"})
+
+	var total float64
+	for ci := range chroms[:2] {
+		for _, v := range vals[ci] {
+			if !math.IsNaN(float64(v)) {
+				total += float64(v)
+			}
+		}
+	}
+	var sum [5]float64
+	c.Assert(binary.Read(bytes.NewReader(data[int(br.u64(44)):]), binary.LittleEndian, &sum), IsNil)
+	c.Assert(math.Abs(sum[3]-total) < 1e-6, Equals, true)
+
+	for i := 0; i < 50; i++ {
+		ci := uint32(r.Intn(2))
+		start := uint32(r.Intn(chroms[ci].Size - 10000))
+		end := start + uint32(r.Intn(10000))
+		exp := vals[ci][start:end]
+		got := make([]float32, len(exp))
+		for i := range got {
+			got[i] = float32(math.NaN())
+		}
+		its := br.items(ci, start, end)
+		for k, it := range its {
+			if k > 0 {
+				// runs are merged.
+				c.Assert(it.start > its[k-1].end || it.v != its[k-1].v, Equals, true)
+			}
+			for p := max(int(it.start), int(start)); p < min(int(it.end), int(end)); p++ {
+				got[p-int(start)] = it.v
+			}
+		}
+		c.Assert(strings.Replace(floats(got), "NaN", "-", -1), Equals, strings.Replace(floats(exp), "NaN", "-", -1))
+
+		// check the summaries of the first two zoom levels.
+		for level := 0; level < 2; level++ {
+			red := uint32(ZoomBase << uint(2*level))
+			for _, z := range br.zooms(level, ci, start, end) {
+				c.Assert(z.Start%red, Equals, uint32(0))
+				var n uint32
+				var s float32
+				for _, v := range vals[ci][z.Start:z.End] {
+					if !math.IsNaN(float64(v)) {
+						n++
+						s += v
+					}
+				}
+				c.Assert(z.Valid, Equals, n)
+				c.Assert(z.Sum, Equals, s)
+			}
+		}
+	}
+	c.Assert(br.items(2, 0, 100), HasLen, 0)
+}
+
+func floats(fs []float32) string {
+	var buf bytes.Buffer
+	for _, f := range fs {
+		io.WriteString(&buf, string(rune('0'+int(f))))
+		if math.IsNaN(float64(f)) {
+			buf.Truncate(buf.Len() - 1)
+			buf.WriteString("NaN")
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,75 @@
+package bigly
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/biogo/hts/sam"
+	"github.com/brentp/bigly/track"
+)
+
+// Value returns the numeric value of the column for p. It is an error for columns with
+// Type "string".
+func (c Column) Value(p *Pile, o Options) (float64, error) {
+	if c.Type == "string" {
+		return 0, fmt.Errorf("bigly: column %s is not numeric", c.Name)
+	}
+	if c.value != nil {
+		return c.value(p), nil
+	}
+	return strconv.ParseFloat(string(c.format(nil, p, o)), 64)
+}
+
+// Track adds the value of a single column for each pile to a track.Writer.
+type Track struct {
+	col  Column
+	opts Options
+	w    track.Writer
+}
+
+// NewTrack returns a Track for the numeric column with the given name, e.g. "depth" or
+// "meaninsertsizelp". The Options must be those used for the pileup so that the value
+// is computed.
+func NewTrack(name string, w track.Writer, o Options) (*Track, error) {
+	if err := o.Prepare(); err != nil {
+		return nil, err
+	}
+	for _, c := range o.AllColumns() {
+		if c.Name != name {
+			continue
+		}
+		if c.Type == "string" {
+			return nil, fmt.Errorf("bigly: column %s is not numeric", name)
+		}
+		if c.work&^o.work != 0 {
+			return nil, fmt.Errorf("bigly: field %s is not computed with these options; add it to Fields", name)
+		}
+		return &Track{col: c, opts: o, w: w}, nil
+	}
+	return nil, fmt.Errorf("bigly: unknown field: %s", name)
+}
+
+// Name returns the name of the column in the track.
+func (t *Track) Name() string { return t.col.Name }
+
+// Write adds the value for p. Piles must be written in order.
+func (t *Track) Write(p *Pile) error {
+	v, err := t.col.Value(p, t.opts)
+	if err != nil {
+		return err
+	}
+	return t.w.Add(p.Chrom, p.Pos, p.Pos+1, float32(v))
+}
+
+// Close closes the track.Writer.
+func (t *Track) Close() error { return t.w.Close() }
+
+// Chroms returns the chromosome names and lengths from a bam header, as needed for bigWig.
+func Chroms(h *sam.Header) []track.Chrom {
+	refs := h.Refs()
+	cs := make([]track.Chrom, len(refs))
+	for i, r := range refs {
+		cs[i] = track.Chrom{Name: r.Name(), Size: r.Len()}
+	}
+	return cs
+}
@@ -0,0 +1,45 @@
+package bigly_test
+
+import (
+	"bytes"
+
+	"github.com/brentp/bigly"
+	"github.com/brentp/bigly/track"
+	. "gopkg.in/check.v1"
+)
+
+type TrackTest struct{}
+
+var _ = Suite(&TrackTest{})
+
+func (t *TrackTest) TestTrack(c *C) {
+	var buf bytes.Buffer
+	bg, err := track.NewBedGraph(&buf, "")
+	c.Assert(err, IsNil)
+	tr, err := bigly.NewTrack("depth", bg, bigly.Options{})
+	c.Assert(err, IsNil)
+	c.Assert(tr.Name(), Equals, "depth")
+	for i, d := range []int{3, 3, 4} {
+		c.Assert(tr.Write(&bigly.Pile{Chrom: "chr1", Pos: 10 + i, Depth: d}), IsNil)
+	}
+	c.Assert(tr.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "chr1\t10\t12\t3\nchr1\t12\t13\t4\n")
+
+	_, err = bigly.NewTrack("chrom", bg, bigly.Options{})
+	c.Assert(err, ErrorMatches, ".*not numeric")
+	_, err = bigly.NewTrack("nope", bg, bigly.Options{})
+	c.Assert(err, ErrorMatches, ".*unknown field.*")
+	_, err = bigly.NewTrack("discordant", bg, bigly.Options{Fields: []string{"depth"}})
+	c.Assert(err, ErrorMatches, ".*not computed.*")
+}
+
+func (t *TrackTest) TestValue(c *C) {
+	o := bigly.Options{}
+	for _, col := range o.AllColumns() {
+		if col.Name == "discordantchromentropy" {
+			v, err := col.Value(&tpile, o)
+			c.Assert(err, IsNil)
+			c.Assert(v, Equals, 0.25)
+		}
+	}
+}
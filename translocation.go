@@ -0,0 +1,191 @@
+package bigly
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// TranslocationOptions sets how translocations are found from Links.
+type TranslocationOptions struct {
+	// Slop is the distance used to cluster the ends of pairs.
+	Slop int
+	// MaxDistance is the largest distance between the forward and reverse clusters on each
+	// chromosome, and between a split read and the pairs.
+	MaxDistance int
+	// MinPairs is the number of pairs needed in each of the forward and reverse clusters.
+	MinPairs int
+	// MinSplits is the number of split reads needed. If it is negative, translocations are
+	// reported without split reads.
+	MinSplits int
+}
+
+// DefaultTranslocationOptions are used for any zero values in the TranslocationOptions.
+var DefaultTranslocationOptions = TranslocationOptions{Slop: 200, MaxDistance: 1000, MinPairs: 2, MinSplits: 1}
+
+// Junction is one side of a translocation: the join of Pos on Chrom to MatePos on MateChrom.
+type Junction struct {
+	Chrom string
+	// Pos and MatePos are the 0-based positions of the bases on either side of the join.
+	Pos, MatePos int
+	MateChrom    string
+	// Strands are '+' if the joined sequence is to the left of the position and '-' if it is to
+	// the right, as for SV.Strands.
+	Strands [2]byte
+	Pairs   int
+	Splits  int
+}
+
+// Translocation is a reciprocal translocation found from a forward and a reverse cluster of pairs
+// with mates on another chromosome.
+type Translocation struct {
+	Junctions [2]Junction
+}
+
+// joinAt returns the position in p next to the join for the strand.
+func joinAt(p Position) int {
+	if p.Strand {
+		return p.End - 1
+	}
+	return p.Start
+}
+
+// Translocations finds translocations from links between chromosomes. Pairs are clustered by
+// both ends; a forward and a reverse cluster with mates near each other give the two junctions
+// of a translocation. Split reads that agree with a junction set its positions. Translocations are
+// sorted by chromosome and position.
+func Translocations(links []Link, o TranslocationOptions) []Translocation {
+	d := DefaultTranslocationOptions
+	if o.Slop == 0 {
+		o.Slop = d.Slop
+	}
+	if o.MaxDistance == 0 {
+		o.MaxDistance = d.MaxDistance
+	}
+	if o.MinPairs == 0 {
+		o.MinPairs = d.MinPairs
+	}
+	if o.MinSplits == 0 {
+		o.MinSplits = d.MinSplits
+	}
+	var pairs, splits []Link
+	for _, l := range links {
+		if l.A.Chrom == l.B.Chrom {
+			continue
+		}
+		if l.Type == LinkPair {
+			pairs = append(pairs, l)
+		} else {
+			splits = append(splits, l.ordered())
+		}
+	}
+	var cs []LinkCluster
+	for _, c := range ClusterLinks(pairs, o.Slop) {
+		if c.Pairs >= o.MinPairs {
+			cs = append(cs, c)
+		}
+	}
+
+	var ts []Translocation
+	used := make([]bool, len(cs))
+	for i, f := range cs {
+		if used[i] || !f.A.Strand {
+			continue
+		}
+		best := -1
+		for j, r := range cs {
+			// the reverse reads are after the forward reads on the first chromosome and the mates
+			// are on the other strands.
+			if used[j] || r.A.Strand || r.A.Chrom != f.A.Chrom || r.B.Chrom != f.B.Chrom || r.B.Strand == f.B.Strand ||
+				abs(r.A.Start-f.A.End) > o.MaxDistance || abs(joinAt(r.B)-joinAt(f.B)) > o.MaxDistance {
+				continue
+			}
+			if best < 0 || r.Pairs > cs[best].Pairs {
+				best = j
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		used[i], used[best] = true, true
+		var t Translocation
+		for k, c := range []LinkCluster{f, cs[best]} {
+			t.Junctions[k] = junction(c, splits, o.MaxDistance)
+		}
+		if t.Junctions[0].Splits+t.Junctions[1].Splits < o.MinSplits {
+			continue
+		}
+		ts = append(ts, t)
+	}
+	sort.Slice(ts, func(i, j int) bool {
+		a, b := ts[i].Junctions[0], ts[j].Junctions[0]
+		if a.Chrom != b.Chrom {
+			return a.Chrom < b.Chrom
+		}
+		return a.Pos < b.Pos
+	})
+	return ts
+}
+
+// junction returns the junction for the cluster with the positions from the split reads that
+// are joined at the same sides.
+func junction(c LinkCluster, splits []Link, maxDistance int) Junction {
+	j := Junction{Chrom: c.A.Chrom, Pos: joinAt(c.A), MateChrom: c.B.Chrom, MatePos: joinAt(c.B),
+		Strands: [2]byte{strandByte(c.A.Strand), strandByte(c.B.Strand)}, Pairs: c.Pairs}
+	var ps, mps []int
+	for _, s := range splits {
+		if s.A.Chrom != j.Chrom || s.B.Chrom != j.MateChrom || s.AEnd != c.A.Strand || s.BEnd != c.B.Strand {
+			continue
+		}
+		p, mp := s.A.Start, s.B.Start
+		if s.AEnd {
+			p = s.A.End - 1
+		}
+		if s.BEnd {
+			mp = s.B.End - 1
+		}
+		if abs(p-j.Pos) <= maxDistance && abs(mp-j.MatePos) <= maxDistance {
+			ps, mps = append(ps, p), append(mps, mp)
+		}
+	}
+	if j.Splits = len(ps); j.Splits > 0 {
+		j.Pos, j.MatePos = medianInt(ps), medianInt(mps)
+	}
+	return j
+}
+
+// SVs returns a pair of mated BND records for each junction. Their IDs start with id.
+func (t *Translocation) SVs(id string) []SV {
+	svs := make([]SV, 0, 4)
+	for k, j := range t.Junctions {
+		sv := SV{Chrom: j.Chrom, Pos: j.Pos, Type: SVBnd, MateChrom: j.MateChrom, MatePos: j.MatePos, Strands: j.Strands,
+			SR: j.Splits, PE: j.Pairs, Qual: float64(j.Splits + j.Pairs), DepthRatio: math.NaN()}
+		if j.Splits == 0 {
+			sv.Filter = "NoSplit"
+		}
+		mate := sv
+		mate.Chrom, mate.Pos, mate.MateChrom, mate.MatePos = j.MateChrom, j.MatePos, j.Chrom, j.Pos
+		mate.Strands = [2]byte{j.Strands[1], j.Strands[0]}
+		sv.ID, mate.ID = id+"_"+strconv.Itoa(2*k+1), id+"_"+strconv.Itoa(2*k+2)
+		sv.MateID, mate.MateID = mate.ID, sv.ID
+		svs = append(svs, sv, mate)
+	}
+	return svs
+}
+
+// TranslocationHeader is the header for Translocation.AppendTab.
+const TranslocationHeader = "#chrom\tmatechrom\tpos1\tmatepos1\tstrands1\tpairs1\tsplits1\tpos2\tmatepos2\tstrands2\tpairs2\tsplits2"
+
+// AppendTab appends the tab-delimited translocation to b. Positions are 0-based.
+func (t *Translocation) AppendTab(b []byte) []byte {
+	b = append(b, t.Junctions[0].Chrom...)
+	b = append(append(b, '\t'), t.Junctions[0].MateChrom...)
+	for _, j := range t.Junctions {
+		b = strconv.AppendInt(append(b, '\t'), int64(j.Pos), 10)
+		b = strconv.AppendInt(append(b, '\t'), int64(j.MatePos), 10)
+		b = append(b, '\t', j.Strands[0], j.Strands[1])
+		b = strconv.AppendInt(append(b, '\t'), int64(j.Pairs), 10)
+		b = strconv.AppendInt(append(b, '\t'), int64(j.Splits), 10)
+	}
+	return b
+}
@@ -0,0 +1,82 @@
+package bigly_test
+
+import (
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type TranslocationTest struct{}
+
+var _ = Suite(&TranslocationTest{})
+
+func traLink(t bigly.LinkType, astart int, astrand bool, bstart int, bstrand bool) bigly.Link {
+	l := link(t, astart, astrand, bstart, bstrand)
+	l.B.Chrom = "chr2"
+	return l
+}
+
+// traLinks returns the pairs for a reciprocal translocation joining chr1:10000 and chr2:50000.
+func traLinks() []bigly.Link {
+	var links []bigly.Link
+	for i := 0; i < 3; i++ {
+		// chr1 before the breakpoint joined to chr2 after it.
+		links = append(links, traLink(bigly.LinkPair, 9700+50*i, true, 50100+50*i, false))
+		// chr2 before the breakpoint joined to chr1 after it, found from the mate.
+		l := traLink(bigly.LinkPair, 10100+50*i, false, 49700+50*i, true)
+		l.A, l.B = l.B, l.A
+		links = append(links, l)
+	}
+	// a forward cluster without a reverse cluster.
+	links = append(links, traLink(bigly.LinkPair, 80000, true, 90000, false), traLink(bigly.LinkPair, 80010, true, 90010, false))
+	return links
+}
+
+func (t *TranslocationTest) TestPrecise(c *C) {
+	sp := func(astart int, aend bool, bstart int, bend bool) bigly.Link {
+		l := traLink(bigly.LinkSplit, astart, aend, bstart, !bend)
+		l.AEnd, l.BEnd = aend, bend
+		return l
+	}
+	links := append(traLinks(),
+		// through the first junction.
+		sp(9900, true, 50000, false),
+		sp(9901, true, 50000, false),
+		// through the second junction.
+		sp(10000, false, 49900, true),
+		// joined on the wrong side of chr2.
+		sp(9900, true, 49900, true))
+	ts := bigly.Translocations(links, bigly.TranslocationOptions{})
+	c.Assert(ts, HasLen, 1)
+	tr := ts[0]
+	c.Assert(tr.Junctions[0], Equals, bigly.Junction{Chrom: "chr1", Pos: 10000, MateChrom: "chr2", MatePos: 50000,
+		Strands: [2]byte{'+', '-'}, Pairs: 3, Splits: 2})
+	c.Assert(tr.Junctions[1], Equals, bigly.Junction{Chrom: "chr1", Pos: 10000, MateChrom: "chr2", MatePos: 49999,
+		Strands: [2]byte{'-', '+'}, Pairs: 3, Splits: 1})
+	c.Assert(string(tr.AppendTab(nil)), Equals, "chr1\tchr2\t10000\t50000\t+-\t3\t2\t10000\t49999\t-+\t3\t1")
+
+	svs := tr.SVs("tra1")
+	c.Assert(svs, HasLen, 4)
+	c.Assert(svs[0].ID, Equals, "tra1_1")
+	c.Assert(svs[0].MateID, Equals, "tra1_2")
+	c.Assert(svs[1].Chrom, Equals, "chr2")
+	c.Assert(svs[1].Pos, Equals, 50000)
+	c.Assert(svs[1].MateChrom, Equals, "chr1")
+	c.Assert(svs[1].Strands, Equals, [2]byte{'-', '+'})
+	c.Assert(svs[1].MateID, Equals, "tra1_1")
+	c.Assert(svs[2].Type, Equals, bigly.SVBnd)
+	c.Assert(svs[2].SR, Equals, 1)
+	c.Assert(svs[2].PE, Equals, 3)
+}
+
+func (t *TranslocationTest) TestNeedsSplits(c *C) {
+	c.Assert(bigly.Translocations(traLinks(), bigly.TranslocationOptions{}), HasLen, 0)
+
+	ts := bigly.Translocations(traLinks(), bigly.TranslocationOptions{MinSplits: -1})
+	c.Assert(ts, HasLen, 1)
+	// the last base of the forward reads and the first of the reverse mates.
+	c.Assert(ts[0].Junctions[0].Pos, Equals, 9899)
+	c.Assert(ts[0].Junctions[0].MatePos, Equals, 50100)
+	c.Assert(ts[0].SVs("t")[0].Filter, Equals, "NoSplit")
+
+	c.Assert(bigly.Translocations(traLinks(), bigly.TranslocationOptions{MinSplits: -1, MinPairs: 4}), HasLen, 0)
+}
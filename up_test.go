@@ -1,6 +1,9 @@
 package bigly_test
 
 import (
+	"path/filepath"
+	"strings"
+
 	"github.com/biogo/hts/sam"
 	"github.com/brentp/bigly"
 	. "gopkg.in/check.v1"
@@ -113,19 +116,10 @@ var precords = []*sam.Record{
 	},
 }
 
-type UpTest struct {
-	alns []*bigly.Align
-}
+type UpTest struct{}
 
 var _ = Suite(&UpTest{})
 
-func (t *UpTest) SetUpTest(c *C) {
-	t.alns = make([]*bigly.Align, 0)
-	for _, r := range precords {
-		t.alns = append(t.alns, &bigly.Align{Record: r})
-	}
-}
-
 /*
 @SQ SN:ref  LN:45
 @CO --------------------------------------------------------
@@ -195,22 +189,29 @@ func (t *UpTest) TestRefPieces(c *C) {
 
 }
 
-func (t *UpTest) TestSimple(c *C) {
-	alns := t.alns
+// update returns the pile at pos from Pile.Update with recs and checks that the sweep engine
+// gives the same pile.
+func update(c *C, opts bigly.Options, recs []*sam.Record, pos int) *bigly.Pile {
+	p := &bigly.Pile{Chrom: "ref", Pos: pos}
+	p.Update(opts, aligns(recs))
+	piles := bigly.SweepPiles(opts, aligns(recs), "ref", make([]byte, pos+1), pos, pos+1)
+	c.Assert(piles[0], DeepEquals, p, Commentf("pos: %d opts: %+v", pos, opts))
+	return p
+}
 
+func (t *UpTest) TestSimple(c *C) {
 	opts := bigly.Options{IncludeBases: true}
+	r := precords
 
-	p := &bigly.Pile{Chrom: "ref", Pos: 8}
-
-	p.Update(opts, []*bigly.Align{alns[0]})
+	p := update(c, opts, []*sam.Record{r[0]}, 8)
 	c.Assert(p.Depth, Equals, 1)
-	p.Update(opts, []*bigly.Align{alns[1]})
+	p = update(c, opts, []*sam.Record{r[0], r[1]}, 8)
 	c.Assert(p.Depth, Equals, 2)
 
-	p.Update(opts, []*bigly.Align{alns[3]})
+	p = update(c, opts, []*sam.Record{r[0], r[1], r[3]}, 8)
 	c.Assert(p.Depth, Equals, 2)
 
-	p.Update(opts, []*bigly.Align{alns[2]})
+	p = update(c, opts, []*sam.Record{r[0], r[1], r[3], r[2]}, 8)
 	c.Assert(string(p.Bases), Equals, "AAA")
 
 	c.Assert(p.SoftEnds, Equals, uint32(2))
@@ -219,16 +220,14 @@ func (t *UpTest) TestSimple(c *C) {
 func (t *UpTest) TestInsertionEnds(c *C) {
 
 	opts := bigly.Options{IncludeBases: true}
-	p := &bigly.Pile{Chrom: "ref", Pos: 14}
-	p.Update(opts, t.alns)
+	p := update(c, opts, precords, 14)
 	c.Assert(p.InsertionEnds, Equals, uint32(2))
 	c.Assert(string(p.Bases), Equals, "GG")
 }
 
 func (t *UpTest) TestInsertionStarts(c *C) {
 	opts := bigly.Options{IncludeBases: true}
-	p := &bigly.Pile{Chrom: "ref", Pos: 13}
-	p.Update(opts, t.alns)
+	p := update(c, opts, precords, 13)
 
 	c.Assert(p.InsertionStarts, Equals, uint32(1))
 	c.Assert(string(p.Bases), Equals, "AAA")
@@ -237,24 +236,161 @@ func (t *UpTest) TestInsertionStarts(c *C) {
 
 func (t *UpTest) TestMinMapQ(c *C) {
 	opts := bigly.Options{MinMappingQuality: 100, IncludeBases: true}
-	p := &bigly.Pile{Chrom: "ref", Pos: 13}
-	p.Update(opts, t.alns)
+	p := update(c, opts, precords, 13)
 	c.Assert(string(p.Bases), Equals, "")
 	c.Assert(p.Depth, Equals, 0)
 }
 
 func (t *UpTest) TestDel(c *C) {
 	opts := bigly.Options{IncludeBases: true}
-	p := &bigly.Pile{Chrom: "ref", Pos: 18}
-	p.Update(opts, t.alns)
+	p := update(c, opts, precords, 18)
 	c.Assert(string(p.Bases), Equals, "*G")
 	c.Assert(p.Deletions, Equals, uint32(1))
 }
 
 func (t *UpTest) TestHard(c *C) {
 	opts := bigly.Options{IncludeBases: true}
-	p := &bigly.Pile{Chrom: "ref", Pos: 28}
-	p.Update(opts, t.alns)
+	p := update(c, opts, precords, 28)
 	c.Assert(string(p.Bases), Equals, ".T")
 	c.Assert(p.HardEnds, Equals, uint32(1))
 }
+
+// the reference from the header above without the pads.
+var ref = []byte("AGCATGTTAGATAAGATAGCTGTGCTAGTAGGCAGTCAGCGCCAT")
+
+// aligns returns a new Align for each record.
+func aligns(recs []*sam.Record) []*bigly.Align {
+	alns := make([]*bigly.Align, 0, len(recs))
+	for _, r := range recs {
+		alns = append(alns, &bigly.Align{Record: r})
+	}
+	return alns
+}
+
+func newAligns() []*bigly.Align { return aligns(precords) }
+
+func (t *UpTest) TestSweepEquivalence(c *C) {
+	unknown := []byte(strings.Repeat("N", len(ref)))
+	var depth, mismatches int
+	for _, opts := range []bigly.Options{
+		{IncludeBases: true},
+		{IncludeBases: true, SplitterVerbosity: 2, MinClipLength: 4},
+		{MinMappingQuality: 20, SplitterVerbosity: 1},
+		{MinBaseQuality: 10, ConcordantCutoff: 10},
+		{MinMappingQuality: 100},
+		{Fields: bigly.MpileupFields},
+	} {
+		c.Assert(opts.Prepare(), IsNil)
+		for _, rs := range [][]byte{unknown, ref} {
+			piles := bigly.SweepPiles(opts, newAligns(), "ref", rs, 0, len(rs))
+			for pos := range rs {
+				p := &bigly.Pile{Chrom: "ref", Pos: pos, RefBase: rs[pos]}
+				p.Update(opts, newAligns())
+				c.Assert(piles[pos], DeepEquals, p, Commentf("pos: %d opts: %+v", pos, opts))
+				depth += p.Depth
+				mismatches += int(p.MisMatches)
+			}
+		}
+	}
+	c.Assert(depth > 0, Equals, true)
+	c.Assert(mismatches > 0, Equals, true)
+}
+
+func (t *UpTest) TestSweepGrow(c *C) {
+	spliced := &sam.Record{Name: "r005", Pos: 3, MapQ: 30,
+		Cigar: sam.Cigar{
+			sam.NewCigarOp(sam.CigarMatch, 10),
+			sam.NewCigarOp(sam.CigarSkipped, 150),
+			sam.NewCigarOp(sam.CigarSoftClipped, 20),
+		},
+		Seq:  sam.NewSeq([]byte(strings.Repeat("A", 30))),
+		Qual: []byte(strings.Repeat("I", 30)),
+	}
+	alns := func() []*bigly.Align {
+		return append([]*bigly.Align{{Record: spliced}}, newAligns()...)
+	}
+	rs := []byte(strings.Repeat("A", 200))
+	opts := bigly.Options{IncludeBases: true}
+	piles := bigly.SweepPiles(opts, alns(), "ref", rs, 0, len(rs))
+	for pos := range rs {
+		p := &bigly.Pile{Chrom: "ref", Pos: pos, RefBase: rs[pos]}
+		p.Update(opts, alns())
+		c.Assert(piles[pos], DeepEquals, p, Commentf("pos: %d", pos))
+	}
+	c.Assert(piles[100].Depth, Equals, 1)
+}
+
+// refRecords returns copies of precords on ref in a header.
+func refRecords() (*sam.Header, []*sam.Record) {
+	ref, _ := sam.NewReference("ref", "", "", 45, nil, nil)
+	h, _ := sam.NewHeader(nil, []*sam.Reference{ref})
+	recs := make([]*sam.Record, len(precords))
+	for i, r := range precords {
+		rc := *r
+		rc.Ref = ref
+		recs[i] = &rc
+	}
+	return h, recs
+}
+
+// iterPiles returns a Clone of each pile from an Iterator over pos in the bam at path.
+func iterPiles(c *C, path string, opts bigly.Options, pos bigly.Position) []*bigly.Pile {
+	it := bigly.Up(path, opts, pos, nil)
+	c.Assert(it.Error(), IsNil)
+	defer it.Close()
+	var piles []*bigly.Pile
+	for it.Next() {
+		piles = append(piles, it.Pile().Clone())
+	}
+	c.Assert(it.Error(), IsNil)
+	return piles
+}
+
+func (t *UpTest) TestIteratorEngines(c *C) {
+	h, recs := refRecords()
+	path := filepath.Join(c.MkDir(), "up.bam")
+	c.Assert(bigly.WriteIndexedBam(path, h, recs), IsNil)
+	pos := bigly.Position{Chrom: "ref", Start: 0, End: 45}
+	for _, opts := range []bigly.Options{
+		{IncludeBases: true},
+		{IncludeBases: true, SplitterVerbosity: 2, MinClipLength: 4},
+		{MinMappingQuality: 20, SplitterVerbosity: 1},
+		{MinBaseQuality: 10, ConcordantCutoff: 10},
+		{MinMappingQuality: 100},
+		{Fields: bigly.MpileupFields},
+		{IncludeBases: true, ReusePile: true},
+	} {
+		per := opts
+		per.PerPosition = true
+		want := iterPiles(c, path, per, pos)
+		c.Assert(iterPiles(c, path, opts, pos), DeepEquals, want, Commentf("opts: %+v", opts))
+		if opts.MinMappingQuality < 100 {
+			c.Assert(want, Not(HasLen), 0)
+		}
+	}
+}
+
+func (t *UpTest) TestSeekRegions(c *C) {
+	h, recs := refRecords()
+	path := filepath.Join(c.MkDir(), "seek.bam")
+	c.Assert(bigly.WriteIndexedBam(path, h, recs), IsNil)
+	for _, opts := range []bigly.Options{{IncludeBases: true, SplitterVerbosity: 2}, {ReusePile: true, PerPosition: true}} {
+		it := bigly.Up(path, opts, bigly.Position{Chrom: "ref", Start: 0, End: 45}, nil)
+		c.Assert(it.Error(), IsNil)
+		// later, then earlier, then overlapping regions.
+		for _, pos := range []bigly.Position{{Chrom: "ref", Start: 20, End: 40}, {Chrom: "ref", Start: 2, End: 15}, {Chrom: "ref", Start: 10, End: 30}} {
+			c.Assert(it.Seek(pos), IsNil)
+			var got []*bigly.Pile
+			for it.Next() {
+				got = append(got, it.Pile().Clone())
+			}
+			c.Assert(it.Error(), IsNil)
+			want := iterPiles(c, path, opts, pos)
+			c.Assert(want, Not(HasLen), 0)
+			c.Assert(got, DeepEquals, want, Commentf("pos: %s", pos))
+			c.Assert(got[0].Pos >= pos.Start, Equals, true)
+			c.Assert(got[len(got)-1].Pos < pos.End, Equals, true)
+		}
+		c.Assert(it.Close(), IsNil)
+	}
+}
@@ -0,0 +1,398 @@
+package bigly
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/hts/sam"
+)
+
+// SVType is the SVTYPE of an SV.
+type SVType string
+
+const (
+	SVDel SVType = "DEL"
+	SVDup SVType = "DUP"
+	SVInv SVType = "INV"
+	SVBnd SVType = "BND"
+)
+
+// SV is a structural-variant record for the VCFWriter.
+type SV struct {
+	// ID is set by the VCFWriter if it is empty.
+	ID    string
+	Chrom string
+	// Pos is the 0-based position of the breakend or, for DEL, DUP and INV, of the base before the event.
+	Pos int
+	// End is the 0-based position of the last base of a DEL, DUP or INV.
+	End  int
+	Type SVType
+	// Ref is the reference base at Pos. N is used if it is 0.
+	Ref byte
+	// CIPos and CIEnd are the confidence intervals around Pos and End.
+	CIPos, CIEnd [2]int
+	// MateChrom and MatePos are the 0-based partner of a BND. Without a MateChrom, it is a single breakend.
+	MateChrom string
+	MatePos   int
+	// MateID is the ID of the record for the other side of a BND, if any.
+	MateID string
+	// Strands are the sides of the junction for a BND. The first is for Pos and the second for
+	// MatePos. '+' means the joined sequence is to the left of (and includes) the position and
+	// '-' that it is to the right, as for the strands of the reads that support it.
+	Strands [2]byte
+	Qual    float64
+	// Filter is PASS if empty.
+	Filter string
+	// SR, PE and SC are the split reads, discordant pairs and clipped reads that support the SV.
+	SR, PE, SC int
+	// DepthRatio is the depth in the event over the depth in the flanks. It is written as . if NaN.
+	DepthRatio float64
+	// GT is the genotype of the sample. It is written as ./. if empty.
+	GT string
+}
+
+// Alt returns the ALT allele: a symbolic allele or, for a BND, the breakend notation.
+func (sv *SV) Alt() string {
+	if sv.Type != SVBnd {
+		return "<" + string(sv.Type) + ">"
+	}
+	t := string(sv.ref())
+	if sv.MateChrom == "" {
+		if sv.Strands[0] == '-' {
+			return "." + t
+		}
+		return t + "."
+	}
+	p := sv.MateChrom + ":" + strconv.Itoa(sv.MatePos+1)
+	// the bracket points the way that the mate's sequence extends from MatePos.
+	b := "["
+	if sv.Strands[1] == '+' {
+		b = "]"
+	}
+	if sv.Strands[0] == '-' {
+		return b + p + b + t
+	}
+	return t + b + p + b
+}
+
+func (sv *SV) ref() byte {
+	if sv.Ref == 0 {
+		return 'N'
+	}
+	return sv.Ref
+}
+
+// BreakendSVs returns a BND for each group of the Breakpoint's Partners that are joined on the
+// same strand and within slop bases of each other, and a single breakend if it has none. SR is
+// the number of partners in the group.
+func BreakendSVs(bp *Breakpoint, slop int) []SV {
+	s := bp.Support
+	sv := SV{Chrom: bp.Chrom, Pos: bp.Peak, Type: SVBnd, CIPos: [2]int{bp.Start - bp.Peak, bp.End - 1 - bp.Peak},
+		Qual: bp.Score, PE: s.Discordant + s.DiscordantChrom, SC: s.ClipStarts + s.ClipEnds, DepthRatio: math.NaN()}
+	if s.FlankDepth > 0 {
+		sv.DepthRatio = s.Depth / s.FlankDepth
+	}
+	// clips after the peak mean that the sequence before it is joined to the partner.
+	sv.Strands[0] = '+'
+	if s.ClipEnds > s.ClipStarts {
+		sv.Strands[0] = '-'
+	}
+	if len(bp.Partners) == 0 {
+		sv.SR = s.Splitters
+		return []SV{sv}
+	}
+	// without the strand of each partner, use the most common.
+	mostOpposite := 2*s.OppositeSplitters > s.Splitters
+	mates := make([]Position, 0, len(bp.Partners))
+	for i, p := range bp.Partners {
+		opposite := mostOpposite
+		if len(bp.Opposite) == len(bp.Partners) {
+			opposite = bp.Opposite[i]
+		}
+		// the end of the partner that is joined depends on which side the clip is and on whether
+		// the clipped sequence aligned to the other strand.
+		if (sv.Strands[0] == '+') == opposite {
+			mates = append(mates, Position{Chrom: p.Chrom, Start: p.End - 1, Strand: true})
+		} else {
+			mates = append(mates, Position{Chrom: p.Chrom, Start: p.Start})
+		}
+	}
+	sort.Slice(mates, func(i, j int) bool {
+		if mates[i].Chrom != mates[j].Chrom {
+			return mates[i].Chrom < mates[j].Chrom
+		}
+		if mates[i].Strand != mates[j].Strand {
+			return !mates[i].Strand
+		}
+		return mates[i].Start < mates[j].Start
+	})
+	var svs []SV
+	for i := 0; i < len(mates); {
+		j := i + 1
+		for j < len(mates) && mates[j].Chrom == mates[i].Chrom && mates[j].Strand == mates[i].Strand && mates[j].Start-mates[j-1].Start <= slop {
+			j++
+		}
+		m := sv
+		m.MateChrom, m.MatePos, m.SR = mates[i].Chrom, mates[(i+j)/2].Start, j-i
+		m.Strands[1] = '-'
+		if mates[i].Strand {
+			m.Strands[1] = '+'
+		}
+		svs = append(svs, m)
+		i = j
+	}
+	return svs
+}
+
+// VCFWriter writes SVs as VCF 4.3 for a single sample.
+type VCFWriter struct {
+	w   *bufio.Writer
+	n   int
+	buf []byte
+}
+
+const vcfHeader = `##fileformat=VCFv4.3
+##source=bigly
+##ALT=<ID=DEL,Description="Deletion">
+##ALT=<ID=DUP,Description="Duplication">
+##ALT=<ID=INV,Description="Inversion">
+##INFO=<ID=SVTYPE,Number=1,Type=String,Description="Type of structural variant">
+##INFO=<ID=END,Number=1,Type=Integer,Description="End position of the variant">
+##INFO=<ID=SVLEN,Number=1,Type=Integer,Description="Difference in length between REF and ALT alleles">
+##INFO=<ID=CIPOS,Number=2,Type=Integer,Description="Confidence interval around POS">
+##INFO=<ID=CIEND,Number=2,Type=Integer,Description="Confidence interval around END">
+##INFO=<ID=MATEID,Number=.,Type=String,Description="ID of the mate breakend">
+##INFO=<ID=IMPRECISE,Number=0,Type=Flag,Description="Imprecise structural variant">
+##INFO=<ID=SR,Number=1,Type=Integer,Description="Number of split reads supporting the variant">
+##INFO=<ID=PE,Number=1,Type=Integer,Description="Number of discordant pairs supporting the variant">
+##INFO=<ID=SC,Number=1,Type=Integer,Description="Number of clipped reads supporting the variant">
+##INFO=<ID=DR,Number=1,Type=Float,Description="Depth in the variant over depth in the flanks">
+##FILTER=<ID=PASS,Description="All filters passed">
+##FILTER=<ID=NoSplit,Description="No split reads support the breakend">
+##FORMAT=<ID=GT,Number=1,Type=String,Description="Genotype">
+##FORMAT=<ID=SR,Number=1,Type=Integer,Description="Number of split reads supporting the variant">
+##FORMAT=<ID=PE,Number=1,Type=Integer,Description="Number of discordant pairs supporting the variant">
+##FORMAT=<ID=SC,Number=1,Type=Integer,Description="Number of clipped reads supporting the variant">
+##FORMAT=<ID=DR,Number=1,Type=Float,Description="Depth in the variant over depth in the flanks">
+`
+
+// NewVCFWriter writes the header with a contig for each reference in h and returns a VCFWriter.
+func NewVCFWriter(w io.Writer, h *sam.Header, sample string) (*VCFWriter, error) {
+	v := &VCFWriter{w: bufio.NewWriter(w)}
+	v.w.WriteString(vcfHeader)
+	for _, r := range h.Refs() {
+		fmt.Fprintf(v.w, "##contig=<ID=%s,length=%d>\n", r.Name(), r.Len())
+	}
+	_, err := v.w.WriteString("#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\t" + sample + "\n")
+	return v, err
+}
+
+// Write writes sv. If sv.ID is empty, it is set.
+func (v *VCFWriter) Write(sv *SV) error {
+	v.n++
+	if sv.ID == "" {
+		sv.ID = "bigly_" + strconv.Itoa(v.n)
+	}
+	b := append(v.buf[:0], sv.Chrom...)
+	b = append(b, '\t')
+	b = strconv.AppendInt(b, int64(sv.Pos+1), 10)
+	b = append(b, '\t')
+	b = append(b, sv.ID...)
+	b = append(b, '\t', sv.ref(), '\t')
+	b = append(b, sv.Alt()...)
+	b = append(b, '\t')
+	b = strconv.AppendFloat(b, sv.Qual, 'f', -1, 64)
+	b = append(b, '\t')
+	if sv.Filter == "" {
+		b = append(b, "PASS"...)
+	} else {
+		b = append(b, sv.Filter...)
+	}
+	b = append(b, "\tSVTYPE="...)
+	b = append(b, sv.Type...)
+	if sv.Type != SVBnd {
+		b = append(b, ";END="...)
+		b = strconv.AppendInt(b, int64(sv.End+1), 10)
+		b = append(b, ";SVLEN="...)
+		l := sv.End - sv.Pos
+		if sv.Type == SVDel {
+			l = -l
+		}
+		b = strconv.AppendInt(b, int64(l), 10)
+	} else if sv.MateID != "" {
+		b = append(append(b, ";MATEID="...), sv.MateID...)
+	}
+	if sv.CIPos != [2]int{} || sv.CIEnd != [2]int{} {
+		b = appendCI(append(b, ";CIPOS="...), sv.CIPos)
+		if sv.Type != SVBnd {
+			b = appendCI(append(b, ";CIEND="...), sv.CIEnd)
+		}
+		b = append(b, ";IMPRECISE"...)
+	}
+	b = sv.appendEvidence(append(b, ";SR="...), ";PE=", ";SC=", ";DR=")
+	b = append(b, "\tGT:SR:PE:SC:DR\t"...)
+	if sv.GT == "" {
+		b = append(b, "./."...)
+	} else {
+		b = append(b, sv.GT...)
+	}
+	b = append(b, ':')
+	b = sv.appendEvidence(b, ":", ":", ":")
+	b = append(b, '\n')
+	v.buf = b
+	_, err := v.w.Write(b)
+	return err
+}
+
+func (sv *SV) appendEvidence(b []byte, pe, sc, dr string) []byte {
+	b = strconv.AppendInt(b, int64(sv.SR), 10)
+	b = strconv.AppendInt(append(b, pe...), int64(sv.PE), 10)
+	b = strconv.AppendInt(append(b, sc...), int64(sv.SC), 10)
+	b = append(b, dr...)
+	if math.IsNaN(sv.DepthRatio) {
+		return append(b, '.')
+	}
+	return strconv.AppendFloat(b, sv.DepthRatio, 'f', 3, 64)
+}
+
+func appendCI(b []byte, ci [2]int) []byte {
+	b = strconv.AppendInt(b, int64(ci[0]), 10)
+	return strconv.AppendInt(append(b, ','), int64(ci[1]), 10)
+}
+
+// ParseSV parses the first 8 columns of a VCF record. The type is from SVTYPE or a symbolic
+// ALT such as <DEL> or <DUP:TANDEM>, and the mate and strands of a BND are from its ALT. Without
+// either, an ALT in breakend notation is a BND and a sequence-resolved record is a DEL if the
+// ALT is shorter than the REF. Other records, like SNVs and insertions, have no Type. Only the
+// first ALT is used.
+func ParseSV(line string) (SV, error) {
+	f := strings.SplitN(strings.TrimRight(line, "\r\n"), "\t", 9)
+	if len(f) < 8 {
+		return SV{}, fmt.Errorf("bigly: expected at least 8 columns in VCF record: %q", line)
+	}
+	pos, err := strconv.Atoi(f[1])
+	if err != nil {
+		return SV{}, fmt.Errorf("bigly: bad POS in VCF record: %q", line)
+	}
+	sv := SV{ID: f[2], Chrom: f[0], Pos: pos - 1, End: pos - 1, DepthRatio: math.NaN()}
+	if f[3] != "" {
+		sv.Ref = f[3][0]
+	}
+	if f[5] != "." {
+		sv.Qual, _ = strconv.ParseFloat(f[5], 64)
+	}
+	if f[6] != "PASS" && f[6] != "." {
+		sv.Filter = f[6]
+	}
+	alt := strings.SplitN(f[4], ",", 2)[0]
+	if strings.HasPrefix(alt, "<") {
+		sv.Type = SVType(strings.SplitN(strings.Trim(alt, "<>"), ":", 2)[0])
+	}
+	svlen, hasEnd := 0, false
+	for _, kv := range strings.Split(f[7], ";") {
+		k, v := kv, ""
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			k, v = kv[:i], kv[i+1:]
+		}
+		switch k {
+		case "SVTYPE":
+			sv.Type = SVType(v)
+		case "END":
+			if sv.End, err = strconv.Atoi(v); err != nil {
+				return SV{}, fmt.Errorf("bigly: bad END in VCF record: %q", line)
+			}
+			sv.End, hasEnd = sv.End-1, true
+		case "SVLEN":
+			svlen, _ = strconv.Atoi(strings.SplitN(v, ",", 2)[0])
+		case "CIPOS", "CIEND":
+			var ci [2]int
+			if _, err := fmt.Sscanf(v, "%d,%d", &ci[0], &ci[1]); err != nil {
+				return SV{}, fmt.Errorf("bigly: bad %s in VCF record: %q", k, line)
+			}
+			if k == "CIPOS" {
+				sv.CIPos = ci
+			} else {
+				sv.CIEnd = ci
+			}
+		case "MATEID":
+			sv.MateID = v
+		}
+	}
+	// sequence-resolved records have the bases of each allele.
+	resolved := isBases(f[3]) && isBases(alt)
+	if sv.Type == "" && resolved && len(alt) < len(f[3]) {
+		sv.Type = SVDel
+	}
+	if !hasEnd && svlen != 0 {
+		sv.End = sv.Pos + abs(svlen)
+	} else if !hasEnd && resolved && sv.Type == SVDel {
+		sv.End = sv.Pos + len(f[3]) - len(alt)
+	}
+	if sv.Type == SVBnd || sv.Type == "" && isBreakend(alt) {
+		sv.Type = SVBnd
+		if err := sv.parseBreakend(alt); err != nil {
+			return SV{}, fmt.Errorf("bigly: %v in VCF record: %q", err, line)
+		}
+	}
+	return sv, nil
+}
+
+// isBases reports whether s is a non-empty sequence of bases.
+func isBases(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case 'A', 'C', 'G', 'T', 'N', 'a', 'c', 'g', 't', 'n':
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isBreakend reports whether alt is in breakend notation, like G[chr2:321682[ or G.
+func isBreakend(alt string) bool {
+	return strings.ContainsAny(alt, "[]") || len(alt) > 1 && (alt[0] == '.' || alt[len(alt)-1] == '.')
+}
+
+// parseBreakend sets the mate and strands from a breakend ALT, the reverse of Alt.
+func (sv *SV) parseBreakend(alt string) error {
+	sv.Strands[0] = '+'
+	if strings.HasPrefix(alt, ".") {
+		sv.Strands[0] = '-'
+	}
+	if strings.HasPrefix(alt, ".") || strings.HasSuffix(alt, ".") {
+		return nil
+	}
+	i := strings.IndexAny(alt, "[]")
+	j := strings.LastIndexAny(alt, "[]")
+	if i < 0 || j <= i {
+		return fmt.Errorf("bad breakend %s", alt)
+	}
+	if i == 0 {
+		sv.Strands[0] = '-'
+	}
+	sv.Strands[1] = '-'
+	if alt[i] == ']' {
+		sv.Strands[1] = '+'
+	}
+	c := strings.LastIndex(alt[i+1:j], ":")
+	if c < 0 {
+		return fmt.Errorf("bad breakend %s", alt)
+	}
+	p, err := strconv.Atoi(alt[i+1+c+1 : j])
+	if err != nil {
+		return fmt.Errorf("bad breakend %s", alt)
+	}
+	sv.MateChrom, sv.MatePos = alt[i+1:i+1+c], p-1
+	return nil
+}
+
+// Close flushes the output. It does not close the underlying writer.
+func (v *VCFWriter) Close() error {
+	return v.w.Flush()
+}
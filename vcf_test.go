@@ -0,0 +1,168 @@
+package bigly_test
+
+import (
+	"bytes"
+	"math"
+	"strings"
+
+	"github.com/biogo/hts/sam"
+	"github.com/brentp/bigly"
+	. "gopkg.in/check.v1"
+)
+
+type VCFTest struct{}
+
+var _ = Suite(&VCFTest{})
+
+func (t *VCFTest) TestAlt(c *C) {
+	sv := bigly.SV{Type: bigly.SVBnd, Ref: 'G', MateChrom: "chr2", MatePos: 321681}
+	for _, tc := range []struct {
+		strands string
+		exp     string
+	}{
+		// the examples from the VCF spec.
+		{"+-", "G[chr2:321682["},
+		{"++", "G]chr2:321682]"},
+		{"-+", "]chr2:321682]G"},
+		{"--", "[chr2:321682[G"},
+	} {
+		copy(sv.Strands[:], tc.strands)
+		c.Assert(sv.Alt(), Equals, tc.exp)
+	}
+	sv.MateChrom = ""
+	c.Assert(sv.Alt(), Equals, ".G")
+	sv.Strands[0] = '+'
+	c.Assert(sv.Alt(), Equals, "G.")
+	sv.Type = bigly.SVDel
+	c.Assert(sv.Alt(), Equals, "<DEL>")
+}
+
+func (t *VCFTest) TestBreakendSVs(c *C) {
+	bp := &bigly.Breakpoint{Chrom: "chr1", Start: 95, End: 110, Peak: 100, Score: 12,
+		Support: bigly.Support{ClipStarts: 5, Splitters: 3, Discordant: 2, Depth: 5, FlankDepth: 10},
+		Partners: []bigly.Position{
+			{Chrom: "chr1", Start: 5000, End: 5100},
+			{Chrom: "chr3", Start: 200, End: 300},
+			{Chrom: "chr1", Start: 5004, End: 5100},
+		}}
+	svs := bigly.BreakendSVs(bp, 10)
+	c.Assert(svs, HasLen, 2)
+	c.Assert(svs[0].MateChrom, Equals, "chr1")
+	c.Assert(svs[0].MatePos, Equals, 5004)
+	c.Assert(svs[0].SR, Equals, 2)
+	c.Assert(svs[0].CIPos, Equals, [2]int{-5, 9})
+	c.Assert(svs[0].DepthRatio, Equals, 0.5)
+	c.Assert(svs[0].Alt(), Equals, "N[chr1:5005[")
+	c.Assert(svs[1].MateChrom, Equals, "chr3")
+	c.Assert(svs[1].SR, Equals, 1)
+
+	// most of the clipped sequence aligns to the other strand so the ends of the partners are joined.
+	bp.Support.OppositeSplitters = 3
+	svs = bigly.BreakendSVs(bp, 10)
+	c.Assert(svs[0].MatePos, Equals, 5099)
+	c.Assert(svs[0].Alt(), Equals, "N]chr1:5100]")
+
+	// with the strand of each partner, mates on different strands are not grouped even if close.
+	bp.Partners = []bigly.Position{
+		{Chrom: "chr1", Start: 5000, End: 5100},
+		{Chrom: "chr1", Start: 5004, End: 5098},
+		{Chrom: "chr1", Start: 5002, End: 5100},
+	}
+	bp.Opposite = []bool{false, true, false}
+	svs = bigly.BreakendSVs(bp, 10)
+	c.Assert(svs, HasLen, 2)
+	c.Assert(svs[0].Alt(), Equals, "N[chr1:5003[")
+	c.Assert(svs[0].SR, Equals, 2)
+	c.Assert(svs[1].Alt(), Equals, "N]chr1:5098]")
+	c.Assert(svs[1].SR, Equals, 1)
+
+	bp.Partners, bp.Opposite = nil, nil
+	bp.Support.FlankDepth = 0
+	svs = bigly.BreakendSVs(bp, 10)
+	c.Assert(svs, HasLen, 1)
+	c.Assert(svs[0].SR, Equals, 3)
+	c.Assert(math.IsNaN(svs[0].DepthRatio), Equals, true)
+}
+
+func (t *VCFTest) TestWriter(c *C) {
+	chr1, _ := sam.NewReference("chr1", "", "", 1000, nil, nil)
+	chr2, _ := sam.NewReference("chr2", "", "", 2000, nil, nil)
+	h, _ := sam.NewHeader(nil, []*sam.Reference{chr1, chr2})
+	var buf bytes.Buffer
+	w, err := bigly.NewVCFWriter(&buf, h, "sample1")
+	c.Assert(err, IsNil)
+	svs := []bigly.SV{
+		{Chrom: "chr1", Pos: 99, End: 199, Type: bigly.SVDel, Ref: 'A', CIPos: [2]int{-5, 5}, CIEnd: [2]int{-3, 3},
+			Qual: 20, SR: 3, PE: 4, SC: 6, DepthRatio: 0.5},
+		{Chrom: "chr1", Pos: 300, Type: bigly.SVBnd, MateChrom: "chr2", MatePos: 9, Strands: [2]byte{'+', '-'},
+			Qual: 8.5, Filter: "LowQual", SR: 2, DepthRatio: math.NaN()},
+	}
+	for i := range svs {
+		c.Assert(w.Write(&svs[i]), IsNil)
+	}
+	c.Assert(w.Close(), IsNil)
+	c.Assert(svs[1].ID, Equals, "bigly_2")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	c.Assert(lines[0], Equals, "##fileformat=VCFv4.3")
+	c.Assert(strings.Contains(buf.String(), "##contig=<ID=chr2,length=2000>\n"), Equals, true)
+	c.Assert(lines[len(lines)-3], Equals, "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\tsample1")
+	c.Assert(lines[len(lines)-2], Equals, "chr1\t100\tbigly_1\tA\t<DEL>\t20\tPASS\t"+
+		"SVTYPE=DEL;END=200;SVLEN=-100;CIPOS=-5,5;CIEND=-3,3;IMPRECISE;SR=3;PE=4;SC=6;DR=0.500\t"+
+		"GT:SR:PE:SC:DR\t./.:3:4:6:0.500")
+	c.Assert(lines[len(lines)-1], Equals, "chr1\t301\tbigly_2\tN\tN[chr2:10[\t8.5\tLowQual\t"+
+		"SVTYPE=BND;SR=2;PE=0;SC=0;DR=.\tGT:SR:PE:SC:DR\t./.:2:0:0:.")
+}
+
+func (t *VCFTest) TestParseSV(c *C) {
+	sv, err := bigly.ParseSV("chr1\t100\tbigly_1\tA\t<DEL>\t20\tPASS\t" +
+		"SVTYPE=DEL;END=200;SVLEN=-100;CIPOS=-5,5;CIEND=-3,3;IMPRECISE;SR=3\tGT:SR\t./.:3\n")
+	c.Assert(err, IsNil)
+	c.Assert(sv.ID, Equals, "bigly_1")
+	c.Assert(sv.Type, Equals, bigly.SVDel)
+	c.Assert(sv.Ref, Equals, byte('A'))
+	c.Assert(sv.Pos, Equals, 99)
+	c.Assert(sv.End, Equals, 199)
+	c.Assert(sv.CIPos, Equals, [2]int{-5, 5})
+	c.Assert(sv.CIEnd, Equals, [2]int{-3, 3})
+	c.Assert(sv.Filter, Equals, "")
+
+	// the length is used without an END.
+	sv, err = bigly.ParseSV("chr1\t100\t.\tN\t<DUP:TANDEM>\t.\tLowQual\tSVLEN=50;CIEND=-3,3")
+	c.Assert(err, IsNil)
+	c.Assert(sv.Type, Equals, bigly.SVDup)
+	c.Assert(sv.End, Equals, 149)
+	c.Assert(sv.Filter, Equals, "LowQual")
+
+	for _, s := range []bigly.SV{
+		{Chrom: "chr1", Pos: 300, Type: bigly.SVBnd, MateChrom: "chr2", MatePos: 9, Strands: [2]byte{'+', '-'}},
+		{Chrom: "chr1", Pos: 300, Type: bigly.SVBnd, MateChrom: "chr2", MatePos: 9, Strands: [2]byte{'+', '+'}},
+		{Chrom: "chr1", Pos: 300, Type: bigly.SVBnd, MateChrom: "chr2", MatePos: 9, Strands: [2]byte{'-', '+'}},
+		{Chrom: "chr1", Pos: 300, Type: bigly.SVBnd, MateChrom: "HLA-A*01:01", MatePos: 9, Strands: [2]byte{'-', '-'}},
+		{Chrom: "chr1", Pos: 300, Type: bigly.SVBnd, Strands: [2]byte{'-', 0}},
+	} {
+		sv, err = bigly.ParseSV("chr1\t301\tb\tN\t" + s.Alt() + "\t.\tPASS\tSVTYPE=BND;MATEID=b2")
+		c.Assert(err, IsNil)
+		c.Assert(sv.MateChrom, Equals, s.MateChrom)
+		c.Assert(sv.MatePos, Equals, s.MatePos)
+		c.Assert(sv.Strands, Equals, s.Strands)
+		c.Assert(sv.MateID, Equals, "b2")
+	}
+
+	_, err = bigly.ParseSV("chr1\t301\tb\tN\tN[chr2[\t.\tPASS\tSVTYPE=BND")
+	c.Assert(err, NotNil)
+
+	// sequence-resolved records without SVTYPE.
+	sv, err = bigly.ParseSV("chr1\t100\td\tACGTAC\tA\t.\tPASS\t.")
+	c.Assert(err, IsNil)
+	c.Assert(sv.Type, Equals, bigly.SVDel)
+	c.Assert(sv.Pos, Equals, 99)
+	c.Assert(sv.End, Equals, 104)
+	for _, alt := range []string{"G", "AGGTCA", ".", "*", "A,G"} {
+		sv, err = bigly.ParseSV("chr1\t100\ts\tA\t" + alt + "\t.\tPASS\t.")
+		c.Assert(err, IsNil, Commentf("alt: %s", alt))
+		c.Assert(sv.Type, Equals, bigly.SVType(""), Commentf("alt: %s", alt))
+	}
+	_, err = bigly.ParseSV("chr1\t301")
+	c.Assert(err, NotNil)
+}